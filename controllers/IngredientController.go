@@ -0,0 +1,589 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IngredientParse godoc
+// @Summary Parse free text ingredients
+// @Description Split every line, e.g. "2 1/2 cups flour, sifted" or "bawang putih 3 siung", into amount, unit, item and note.
+// @Description Lines that cannot be parsed are returned with an error instead of failing the whole request.
+// @Tags ingredient
+// @Accept  json
+// @Produce  json
+// @Param text body models.IngredientParse true "one ingredient per line"
+// @Success 200 {object} models.ResponseResult{result=[]models.IngredientParseResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 406 {object} models.ResponseError{error=string}
+// @Router /ingredients/parse [post]
+func IngredientParse(c *gin.Context) {
+	var ingredientParse models.IngredientParse
+
+	if ok, errors := helpers.DefaultValidator(c, &ingredientParse); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	results := []models.IngredientParseResult{}
+	for _, line := range helpers.IngredientLines(ingredientParse.Text) {
+		parsed, err := helpers.ParseIngredientLine(line)
+		result := models.IngredientParseResult{ParsedIngredient: parsed}
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			ingredient := recipeIngredientOf(parsed)
+			result.Ingredient = &ingredient
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: results})
+}
+
+// recipeIngredientOf : a range keeps both bounds, the note stays with the item
+func recipeIngredientOf(parsed helpers.ParsedIngredient) models.RecipeIngridient {
+	return models.RecipeIngridient{
+		Value:    parsed.Value,
+		ValueMax: parsed.ValueMax,
+		Unit:     parsed.Unit,
+		Item:     parsed.RecipeItem(),
+	}
+}
+
+// resolveIngredientsText : fill IngredientsPerServing from IngredientsText when only the text
+// is given. The upper bound of a range must be above its lower bound.
+func resolveIngredientsText(recipeRegister *models.RecipeCreate) error {
+	if len(recipeRegister.IngredientsPerServing) == 0 && recipeRegister.IngredientsText != "" {
+		parsed, err := helpers.ParseIngredientLines(recipeRegister.IngredientsText)
+		if err != nil {
+			return err
+		}
+		if len(parsed) == 0 {
+			return errors.New("ingredientsText has no ingredients")
+		}
+
+		ingredients := make([]models.RecipeIngridient, 0, len(parsed))
+		for _, p := range parsed {
+			ingredients = append(ingredients, recipeIngredientOf(p))
+		}
+		recipeRegister.IngredientsPerServing = ingredients
+	}
+
+	for _, ingredient := range recipeRegister.IngredientsPerServing {
+		if ingredient.ValueMax != 0 && ingredient.ValueMax <= ingredient.Value {
+			return fmt.Errorf("valueMax of %q must be above its value", ingredient.Item)
+		}
+	}
+	return nil
+}
+
+var errIngredientAliasTaken = errors.New("belongs to another ingredient, merge them instead")
+
+// IngredientGetAll godoc
+// @Summary List catalog ingredients
+// @Description Ingredients recipes are linked to, with the number of recipes using each. q matches names, aliases and translations.
+// @Tags ingredient
+// @Produce  json
+// @Param q query string false "part of a name, alias or translation"
+// @Param skip query int false "skip"
+// @Param limit query int false "limit"
+// @Success 200 {object} models.ResponseResult{result=[]models.Ingredient}
+// @Failure 500
+// @Router /ingredients [get]
+func IngredientGetAll(c *gin.Context) {
+	var skip = c.Query("skip")
+	var limit = c.Query("limit")
+	var q = c.Query("q")
+
+	var ingredients []models.Ingredient
+	query := helpers.DB.Model(&ingredients).Order("name asc")
+
+	if key := helpers.IngredientKey(q); key != "" {
+		query.Where("id IN (?)", helpers.DB.Model(&models.IngredientAlias{}).Select("ingredient_id").Where("alias LIKE ?", "%"+key+"%"))
+	}
+
+	if limit != "" {
+		limit_uint64, _ := strconv.ParseInt(limit, 10, 64)
+		query.Limit(int(limit_uint64))
+	}
+
+	if skip != "" {
+		skip_uint64, _ := strconv.ParseInt(skip, 10, 64)
+		query.Offset(int(skip_uint64))
+	}
+
+	if err := query.Find(&ingredients).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	setIngredientRecipeCounts(ingredients)
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: ingredients})
+}
+
+// IngredientGetByIngredientID godoc
+// @Summary Get a catalog ingredient
+// @Description Ingredient with its aliases, translations and the number of recipes using it
+// @Tags ingredient
+// @Produce  json
+// @Param ingredient_id path int true "id ingredient"
+// @Success 200 {object} models.ResponseResult{result=models.Ingredient}
+// @Failure 404
+// @Router /ingredients/{ingredient_id} [get]
+func IngredientGetByIngredientID(c *gin.Context) {
+	var ingredient_id = c.Param("ingredient_id")
+	ingredient_id_uint64, _ := strconv.ParseUint(ingredient_id, 10, 64)
+
+	ingredient, ok := findIngredient(uint(ingredient_id_uint64))
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Ingredient with id " + fmt.Sprint(ingredient_id_uint64) + " not found"})
+		return
+	}
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: ingredient})
+}
+
+// IngredientRecipesGetByIngredientID godoc
+// @Summary List recipes using an ingredient
+// @Tags ingredient
+// @Produce  json
+// @Param ingredient_id path int true "id ingredient"
+// @Param skip query int false "skip"
+// @Param limit query int false "limit"
+// @Success 200 {object} models.ResponseResult{result=[]models.RecipeResultGetAll}
+// @Failure 404
+// @Router /ingredients/{ingredient_id}/recipes [get]
+func IngredientRecipesGetByIngredientID(c *gin.Context) {
+	var ingredient_id = c.Param("ingredient_id")
+	ingredient_id_uint64, _ := strconv.ParseUint(ingredient_id, 10, 64)
+	var skip = c.Query("skip")
+	var limit = c.Query("limit")
+
+	var ingredient models.Ingredient
+	if err := helpers.DB.Where("id = ?", ingredient_id_uint64).First(&ingredient).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Ingredient with id " + fmt.Sprint(ingredient_id_uint64) + " not found"})
+		return
+	}
+
+	var recipes []models.Recipe
+	query := helpers.DB.Model(&recipes).
+		Where("id IN (?)", helpers.DB.Model(&models.RecipeIngridient{}).Select("recipe_id").Where("ingredient_id = ?", ingredient.ID)).
+		Order("n_reaction_like desc").Order("id asc")
+
+	if limit != "" {
+		limit_uint64, _ := strconv.ParseInt(limit, 10, 64)
+		query.Limit(int(limit_uint64))
+	}
+
+	if skip != "" {
+		skip_uint64, _ := strconv.ParseInt(skip, 10, 64)
+		query.Offset(int(skip_uint64))
+	}
+
+	if err := query.Find(&recipes).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: recipeListResults(recipes)})
+}
+
+// IngredientCreate godoc
+// @Summary Add an ingredient to the catalog
+// @Description Name, aliases and translations must not be known as another ingredient
+// @Tags ingredient
+// @Accept  json
+// @Produce  json
+// @Param ingredient body models.IngredientCreate true "ingredient"
+// @Security Bearer
+// @Success 201 {object} models.ResponseResult{result=models.Ingredient}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /ingredients [post]
+func IngredientCreate(c *gin.Context) {
+	var ingredientRegister models.IngredientCreate
+
+	if ok, errors := helpers.DefaultValidator(c, &ingredientRegister); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	if helpers.IngredientKey(ingredientRegister.Name) == "" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "Name is invalid"})
+		return
+	}
+
+	var ingredient = models.Ingredient{
+		Name: strings.Join(strings.Fields(ingredientRegister.Name), " "),
+	}
+	aliases := ingredientAliases(ingredient.Name, ingredientRegister, "")
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkIngredientAliases(tx, 0, aliases); err != nil {
+			return err
+		}
+		if err := tx.Create(&ingredient).Error; err != nil {
+			return err
+		}
+		return saveIngredientNames(tx, ingredient, ingredientRegister, aliases)
+	})
+	if errors.Is(err, errIngredientAliasTaken) {
+		c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+
+	ingredient, _ = findIngredient(ingredient.ID)
+	c.JSON(http.StatusCreated, models.ResponseResult{Success: true, Message: "Success", Data: ingredient})
+}
+
+// IngredientEditByIngredientID godoc
+// @Summary Edit a catalog ingredient
+// @Description Aliases and translations are replaced. A renamed ingredient keeps its previous name as alias, so recipes keep finding it.
+// @Tags ingredient
+// @Accept  json
+// @Produce  json
+// @Param ingredient_id path int true "id ingredient"
+// @Param ingredient body models.IngredientCreate true "ingredient"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.Ingredient}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /ingredients/{ingredient_id} [put]
+func IngredientEditByIngredientID(c *gin.Context) {
+	var ingredient_id = c.Param("ingredient_id")
+	ingredient_id_uint64, _ := strconv.ParseUint(ingredient_id, 10, 64)
+
+	var ingredientRegister models.IngredientCreate
+
+	if ok, errors := helpers.DefaultValidator(c, &ingredientRegister); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	if helpers.IngredientKey(ingredientRegister.Name) == "" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "Name is invalid"})
+		return
+	}
+
+	var ingredient models.Ingredient
+	if err := helpers.DB.Where("id = ?", ingredient_id_uint64).First(&ingredient).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Ingredient with id " + fmt.Sprint(ingredient_id_uint64) + " not found"})
+		return
+	}
+
+	previousName := ingredient.Name
+	ingredient.Name = strings.Join(strings.Fields(ingredientRegister.Name), " ")
+	aliases := ingredientAliases(ingredient.Name, ingredientRegister, previousName)
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkIngredientAliases(tx, ingredient.ID, aliases); err != nil {
+			return err
+		}
+		if err := tx.Model(&ingredient).Update("name", ingredient.Name).Error; err != nil {
+			return err
+		}
+		return saveIngredientNames(tx, ingredient, ingredientRegister, aliases)
+	})
+	if errors.Is(err, errIngredientAliasTaken) {
+		c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+
+	reindexRecipes(recipeIdsUsingIngredients([]uint{ingredient.ID}))
+	ingredient, _ = findIngredient(ingredient.ID)
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: ingredient})
+}
+
+// IngredientMergeByIngredientID godoc
+// @Summary Merge duplicate ingredients
+// @Description The listed ingredients are folded into the one in the path: their recipes, names and aliases move to it,
+// @Description translations move unless it already has one for the locale, then they are removed.
+// @Tags ingredient
+// @Accept  json
+// @Produce  json
+// @Param ingredient_id path int true "id of the ingredient to keep"
+// @Param ingredients body models.IngredientMerge true "ids of the duplicates"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.Ingredient}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 500
+// @Router /ingredients/{ingredient_id}/merge [post]
+func IngredientMergeByIngredientID(c *gin.Context) {
+	var ingredient_id = c.Param("ingredient_id")
+	ingredient_id_uint64, _ := strconv.ParseUint(ingredient_id, 10, 64)
+
+	var ingredientMerge models.IngredientMerge
+
+	if ok, errors := helpers.DefaultValidator(c, &ingredientMerge); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	var target models.Ingredient
+	if err := helpers.DB.Preload("Translations").Where("id = ?", ingredient_id_uint64).First(&target).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Ingredient with id " + fmt.Sprint(ingredient_id_uint64) + " not found"})
+		return
+	}
+
+	sourceIds := []uint{}
+	for _, id := range ingredientMerge.IngredientIds {
+		if id != target.ID {
+			sourceIds = append(sourceIds, id)
+		}
+	}
+	if len(sourceIds) == 0 {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "IngredientIds must name other ingredients"})
+		return
+	}
+
+	var sources []models.Ingredient
+	if err := helpers.DB.Preload("Translations").Where("id IN ?", sourceIds).Find(&sources).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if len(sources) != len(uniqueUints(sourceIds)) {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Some ingredients to merge were not found"})
+		return
+	}
+
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		return mergeIngredients(tx, target, sources)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Merge failed " + err.Error()})
+		return
+	}
+
+	reindexRecipes(recipeIdsUsingIngredients([]uint{target.ID}))
+	target, _ = findIngredient(target.ID)
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: target})
+}
+
+func findIngredient(id uint) (models.Ingredient, bool) {
+	var ingredient models.Ingredient
+	err := helpers.DB.Preload("Aliases", func(db *gorm.DB) *gorm.DB { return db.Order("alias asc") }).
+		Preload("Translations", func(db *gorm.DB) *gorm.DB { return db.Order("locale asc") }).
+		Where("id = ?", id).First(&ingredient).Error
+	if err != nil {
+		return ingredient, false
+	}
+	ingredients := []models.Ingredient{ingredient}
+	setIngredientRecipeCounts(ingredients)
+	return ingredients[0], true
+}
+
+// setIngredientRecipeCounts : fill NRecipe, the number of recipes using every ingredient
+func setIngredientRecipeCounts(ingredients []models.Ingredient) {
+	if len(ingredients) == 0 {
+		return
+	}
+	ids := make([]uint, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		ids = append(ids, ingredient.ID)
+	}
+
+	var counts []struct {
+		IngredientID uint
+		NRecipe      int64
+	}
+	helpers.DB.Model(&models.RecipeIngridient{}).
+		Select("ingredient_id, COUNT(DISTINCT recipe_id) AS n_recipe").
+		Where("ingredient_id IN ?", ids).Group("ingredient_id").Scan(&counts)
+
+	byID := make(map[uint]int64)
+	for _, count := range counts {
+		byID[count.IngredientID] = count.NRecipe
+	}
+	for idx := range ingredients {
+		ingredients[idx].NRecipe = byID[ingredients[idx].ID]
+	}
+}
+
+// ingredientAliases : name, previous name, aliases and translated names of an ingredient, normalized
+func ingredientAliases(name string, ingredientRegister models.IngredientCreate, previousName string) []string {
+	names := []string{name, previousName}
+	names = append(names, ingredientRegister.Aliases...)
+	for _, translation := range ingredientRegister.Translations {
+		names = append(names, translation)
+	}
+
+	aliases := []string{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		key := helpers.IngredientKey(name)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		aliases = append(aliases, key)
+	}
+	return aliases
+}
+
+// checkIngredientAliases : none of aliases may be known as another ingredient than id
+func checkIngredientAliases(tx *gorm.DB, id uint, aliases []string) error {
+	var taken []models.IngredientAlias
+	if err := tx.Where("alias IN ? AND ingredient_id <> ?", aliases, id).Find(&taken).Error; err != nil {
+		return err
+	}
+	if len(taken) > 0 {
+		return fmt.Errorf("%q of ingredient %d %w", taken[0].Alias, taken[0].IngredientID, errIngredientAliasTaken)
+	}
+	return nil
+}
+
+// saveIngredientNames : replace aliases and translations of ingredient, aliases are checked already
+func saveIngredientNames(tx *gorm.DB, ingredient models.Ingredient, ingredientRegister models.IngredientCreate, aliases []string) error {
+	if err := tx.Where("ingredient_id = ?", ingredient.ID).Delete(&models.IngredientAlias{}).Error; err != nil {
+		return err
+	}
+	rows := make([]models.IngredientAlias, 0, len(aliases))
+	for _, alias := range aliases {
+		rows = append(rows, models.IngredientAlias{IngredientID: ingredient.ID, Alias: alias})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("ingredient_id = ?", ingredient.ID).Delete(&models.IngredientTranslation{}).Error; err != nil {
+		return err
+	}
+	translations := []models.IngredientTranslation{}
+	for locale, name := range ingredientRegister.Translations {
+		locale = strings.ToLower(strings.TrimSpace(locale))
+		name = strings.Join(strings.Fields(name), " ")
+		if locale == "" || name == "" {
+			continue
+		}
+		translations = append(translations, models.IngredientTranslation{IngredientID: ingredient.ID, Locale: locale, Name: name})
+	}
+	if len(translations) == 0 {
+		return nil
+	}
+	return tx.Create(&translations).Error
+}
+
+// mergeIngredients : move recipes, aliases and translations of sources to target and remove sources
+func mergeIngredients(tx *gorm.DB, target models.Ingredient, sources []models.Ingredient) error {
+	sourceIds := make([]uint, 0, len(sources))
+	for _, source := range sources {
+		sourceIds = append(sourceIds, source.ID)
+	}
+
+	if err := tx.Model(&models.RecipeIngridient{}).Where("ingredient_id IN ?", sourceIds).Update("ingredient_id", target.ID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.IngredientAlias{}).Where("ingredient_id IN ?", sourceIds).Update("ingredient_id", target.ID).Error; err != nil {
+		return err
+	}
+
+	locales := make(map[string]bool)
+	for _, translation := range target.Translations {
+		locales[translation.Locale] = true
+	}
+	for _, source := range sources {
+		// the name normally is an alias already, unless it was renamed by hand in the database
+		if key := helpers.IngredientKey(source.Name); key != "" {
+			alias := models.IngredientAlias{Alias: key}
+			if err := tx.Where(alias).Attrs(models.IngredientAlias{IngredientID: target.ID}).FirstOrCreate(&alias).Error; err != nil {
+				return err
+			}
+		}
+		for _, translation := range source.Translations {
+			if locales[translation.Locale] {
+				continue
+			}
+			locales[translation.Locale] = true
+			if err := tx.Model(&translation).Update("ingredient_id", target.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Where("ingredient_id IN ?", sourceIds).Delete(&models.IngredientTranslation{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", sourceIds).Delete(&models.Ingredient{}).Error
+}
+
+// recipeIdsUsingIngredients : recipes listing any of ingredientIds
+func recipeIdsUsingIngredients(ingredientIds []uint) []uint {
+	var recipeIds []uint
+	helpers.DB.Model(&models.RecipeIngridient{}).Where("ingredient_id IN ?", ingredientIds).Distinct().Pluck("recipe_id", &recipeIds)
+	return recipeIds
+}
+
+func uniqueUints(values []uint) []uint {
+	seen := make(map[uint]bool)
+	unique := []uint{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
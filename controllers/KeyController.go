@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nadhirfr/codefood/helpers"
+)
+
+// JWKSGet godoc
+// @Summary Public keys to verify access tokens
+// @Description JSON Web Key Set of every key currently accepted for access tokens, HMAC keys are not published
+// @Tags user
+// @Accept */*
+// @Produce  json
+// @Success 200 {object} object
+// @Router /.well-known/jwks.json [get]
+func JWKSGet(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": helpers.ACCESS_KEYS.JWKS()})
+}
@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NutritionFoodGetAll godoc
+// @Summary List foods of the nutrition dataset
+// @Description Foods known to the nutrition calculation, nutrients are per 100 g
+// @Tags nutrition
+// @Produce  json
+// @Param q query string false "filter on names and aliases"
+// @Success 200 {object} models.ResponseResult{result=[]helpers.Food}
+// @Router /nutrition/foods [get]
+func NutritionFoodGetAll(c *gin.Context) {
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: helpers.Foods(c.Query("q"))})
+}
+
+// NutritionFoodGetByFoodID godoc
+// @Summary Get a food of the nutrition dataset
+// @Tags nutrition
+// @Produce  json
+// @Param food_id path string true "id of the food"
+// @Success 200 {object} models.ResponseResult{result=helpers.Food}
+// @Failure 404
+// @Router /nutrition/foods/{food_id} [get]
+func NutritionFoodGetByFoodID(c *gin.Context) {
+	food, ok := helpers.FindFood(c.Param("food_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Food with id " + c.Param("food_id") + " not found"})
+		return
+	}
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: food})
+}
+
+// NutritionMappingGetAll godoc
+// @Summary List ingredient to food corrections
+// @Tags nutrition
+// @Produce  json
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=[]models.IngredientFoodMapping}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Router /nutrition/mappings [get]
+func NutritionMappingGetAll(c *gin.Context) {
+	var mappings []models.IngredientFoodMapping
+	if err := helpers.DB.Order("item asc").Find(&mappings).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: mappings})
+}
+
+// NutritionMappingSave godoc
+// @Summary Correct the food an ingredient item is matched to
+// @Description Every ingredient with this item (compared case and punctuation insensitive) uses foodId from now on.
+// @Description An empty foodId excludes the item from nutrition, e.g. for garnish.
+// @Tags nutrition
+// @Accept  json
+// @Produce  json
+// @Param mapping body models.IngredientFoodMappingCreate true "item and food"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.IngredientFoodMapping}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /nutrition/mappings [put]
+func NutritionMappingSave(c *gin.Context) {
+	var mappingRegister models.IngredientFoodMappingCreate
+
+	if ok, errors := helpers.DefaultValidator(c, &mappingRegister); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	item := helpers.NormalizeIngredientItem(mappingRegister.Item)
+	if item == "" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "item is required"})
+		return
+	}
+	if _, ok := helpers.FindFood(mappingRegister.FoodID); mappingRegister.FoodID != "" && !ok {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "Food with id " + mappingRegister.FoodID + " not found"})
+		return
+	}
+
+	tokenAuth, _ := helpers.GetAccessDetails(c)
+
+	var mapping models.IngredientFoodMapping
+	helpers.DB.Where(models.IngredientFoodMapping{Item: item}).First(&mapping)
+	mapping.Item = item
+	mapping.FoodID = mappingRegister.FoodID
+	mapping.UserID = uint(tokenAuth.UserId)
+
+	if err := helpers.DB.Save(&mapping).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: mapping})
+}
+
+// NutritionMappingDeleteByMappingID godoc
+// @Summary Remove a correction, the item is matched automatically again
+// @Tags nutrition
+// @Produce  json
+// @Param mapping_id path int true "id of the mapping"
+// @Security Bearer
+// @Success 200
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Router /nutrition/mappings/{mapping_id} [delete]
+func NutritionMappingDeleteByMappingID(c *gin.Context) {
+	mapping_id_uint64, _ := strconv.ParseUint(c.Param("mapping_id"), 10, 64)
+
+	var mapping models.IngredientFoodMapping
+	if err := helpers.DB.Where("id = ?", mapping_id_uint64).First(&mapping).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Mapping with id " + fmt.Sprint(mapping_id_uint64) + " not found"})
+		return
+	}
+
+	if err := helpers.DB.Delete(&mapping).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: struct{}{}})
+}
+
+// NutritionUnmatchedGetAll godoc
+// @Summary Ingredient items without a food
+// @Description Items used in recipes that neither match a food automatically nor have a correction, most used first
+// @Tags nutrition
+// @Produce  json
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=[]models.UnmatchedIngredient}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Router /nutrition/unmatched [get]
+func NutritionUnmatchedGetAll(c *gin.Context) {
+	var rows []struct {
+		Item    string
+		Recipes int
+	}
+	err := helpers.DB.Model(&models.RecipeIngridient{}).Select("item, COUNT(DISTINCT recipe_id) AS recipes").Group("item").Scan(&rows).Error
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var items []string
+	for _, row := range rows {
+		items = append(items, row.Item)
+	}
+	mappings := ingredientFoodMappings(items)
+
+	counts := make(map[string]int)
+	for _, row := range rows {
+		item := helpers.NormalizeIngredientItem(row.Item)
+		if _, ok := mappings[item]; ok {
+			continue
+		}
+		if _, ok := helpers.MatchFood(item); ok {
+			continue
+		}
+		counts[item] += row.Recipes
+	}
+
+	unmatched := []models.UnmatchedIngredient{}
+	for item, count := range counts {
+		unmatched = append(unmatched, models.UnmatchedIngredient{Item: item, Recipes: count})
+	}
+	sort.Slice(unmatched, func(i, j int) bool {
+		if unmatched[i].Recipes != unmatched[j].Recipes {
+			return unmatched[i].Recipes > unmatched[j].Recipes
+		}
+		return unmatched[i].Item < unmatched[j].Item
+	})
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: unmatched})
+}
+
+// ingredientFoodMappings : admin corrections for items, keyed by normalized item
+func ingredientFoodMappings(items []string) map[string]models.IngredientFoodMapping {
+	mappings := make(map[string]models.IngredientFoodMapping)
+
+	normalized := []string{}
+	for _, item := range items {
+		normalized = append(normalized, helpers.NormalizeIngredientItem(item))
+	}
+	if len(normalized) == 0 {
+		return mappings
+	}
+
+	var rows []models.IngredientFoodMapping
+	helpers.DB.Where("item IN ?", normalized).Find(&rows)
+	for _, row := range rows {
+		mappings[row.Item] = row
+	}
+	return mappings
+}
+
+// recipeNutrition : nutrients of ingredients as scaled for nServing servings
+func recipeNutrition(ingredients []models.RecipeIngridient, nServing float64) *models.RecipeNutrition {
+	var items []string
+	for _, ingredient := range ingredients {
+		items = append(items, ingredient.Item)
+	}
+	mappings := ingredientFoodMappings(items)
+
+	nutrition := &models.RecipeNutrition{
+		NServing:    nServing,
+		Complete:    true,
+		Ingredients: []models.IngredientNutrition{},
+	}
+	for _, ingredient := range ingredients {
+		result := models.IngredientNutrition{
+			Item:  ingredient.Item,
+			Value: ingredient.Value,
+			Unit:  ingredient.Unit,
+			Match: models.NUTRITION_MATCH_NONE,
+		}
+
+		var food helpers.Food
+		found := false
+		if mapping, ok := mappings[helpers.NormalizeIngredientItem(ingredient.Item)]; ok {
+			result.Match = models.NUTRITION_MATCH_ADMIN
+			food, found = helpers.FindFood(mapping.FoodID)
+		} else if food, found = helpers.MatchFood(ingredient.Item); found {
+			result.Match = models.NUTRITION_MATCH_AUTO
+		}
+
+		if found {
+			result.FoodID = food.ID
+			result.FoodName = food.Name
+			if grams, ok := helpers.IngredientGrams(ingredient.Value, ingredient.Unit, food); ok {
+				nutrients := helpers.NutrientsOf(food, grams)
+				nutrition.Total = nutrition.Total.Add(nutrients)
+				nutrients = nutrients.Rounded()
+				result.Grams = math.Round(grams*10) / 10
+				result.Nutrients = &nutrients
+			}
+		}
+		// an admin excluding the item on purpose does not make the result incomplete
+		excluded := result.Match == models.NUTRITION_MATCH_ADMIN && !found
+		if result.Nutrients == nil && !excluded {
+			nutrition.Complete = false
+		}
+		nutrition.Ingredients = append(nutrition.Ingredients, result)
+	}
+
+	if nServing > 0 {
+		nutrition.PerServing = nutrition.Total.Scale(1 / nServing).Rounded()
+	}
+	nutrition.Total = nutrition.Total.Rounded()
+	return nutrition
+}
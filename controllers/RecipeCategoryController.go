@@ -60,19 +60,56 @@ func RecipeCategoryCreate(c *gin.Context) {
 
 }
 
+// RecipeCategoryGetAll godoc
+// @Summary List recipeCategories
+// @Description The categories stay a plain list, with limit the cursors of the pages around are in the Link header.
+// @Tags recipeCategory
+// @Produce  json
+// @Param sort query string false "name_asc, name_desc, newest or oldest (default)"
+// @Param limit query int false "categories per page, all without"
+// @Param cursor query string false "cursor taken from the Link header"
+// @Success 200 {object} models.ResponseResult{result=[]models.RecipeCategory}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Router /recipe-categories [get]
 func RecipeCategoryGetAll(c *gin.Context) {
 	var recipeCategories []models.RecipeCategory
 
-	err := helpers.DB.Model(&recipeCategories).Find(&recipeCategories).Error
+	page, err := helpers.ParsePagination(c, recipeCategorySorts, "oldest")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	query, err := page.Apply(helpers.DB.Model(&recipeCategories), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	err = query.Find(&recipeCategories).Error
 	if err != nil {
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	} else {
+		page.Finish(c, &recipeCategories, func(i int) (interface{}, uint) {
+			if page.Sort == "name_asc" || page.Sort == "name_desc" {
+				return recipeCategories[i].Name, recipeCategories[i].ID
+			}
+			return recipeCategories[i].CreatedAt, recipeCategories[i].ID
+		})
 		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: recipeCategories})
 	}
 
 }
 
+var recipeCategorySorts = map[string]helpers.SortField{
+	"name_asc":  {Column: "name"},
+	"name_desc": {Column: "name", Desc: true},
+	"newest":    {Column: "created_at", Desc: true, Time: true},
+	"oldest":    {Column: "created_at", Time: true},
+}
+
 // RecipeCategoryEditByRecipeCategoryID godoc
 // @Summary Edit an recipeCategory
 // @Description Edit an recipeCategory
@@ -129,6 +166,7 @@ func RecipeCategoryEditByRecipeCategoryID(c *gin.Context) {
 	if err := helpers.DB.Save(&recipeCategory).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
 	} else {
+		reindexRecipeCategory(recipeCategory.ID)
 		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.RecipeCategoryResult201{
 			ID:        recipeCategory.ID,
 			Name:      recipeCategory.Name,
@@ -165,7 +203,15 @@ func RecipeCategoryDeleteByRecipeCategoryID(c *gin.Context) {
 	if err := helpers.DB.Model(recipeCategory).Delete("ID = ?", recipeCategory_id_uint64).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
 	} else {
+		reindexRecipeCategory(recipeCategory.ID)
 		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: struct{}{}})
 	}
 
 }
+
+// reindexRecipeCategory : recipes are found by the name of their category
+func reindexRecipeCategory(recipeCategoryID uint) {
+	var recipeIds []uint
+	helpers.DB.Model(&models.Recipe{}).Where("recipe_category_id = ?", recipeCategoryID).Pluck("id", &recipeIds)
+	reindexRecipes(recipeIds)
+}
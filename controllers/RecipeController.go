@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -8,8 +10,11 @@ import (
 
 	"github.com/nadhirfr/codefood/helpers"
 	"github.com/nadhirfr/codefood/models"
+	"github.com/nadhirfr/codefood/units"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // RecipeCreate godoc
@@ -45,41 +50,53 @@ func RecipeCreate(c *gin.Context) {
 		return
 	}
 
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		return
+	}
+
 	var recipe = models.Recipe{
 		Name:             recipeRegister.Name,
 		Image:            recipeRegister.Image,
 		RecipeCategoryId: recipeRegister.RecipeCategoryId,
+		UserID:           uint(tokenAuth.UserId),
 		NServing:         recipeRegister.NServing,
 		NReactionLike:    0,
 		NReactionNeutral: 0,
 		NReactionDislike: 0,
 	}
 
-	if err := helpers.DB.Save(&recipe).Error; err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
-	} else {
-		for idx, _ := range recipeRegister.IngredientsPerServing {
-			recipeRegister.IngredientsPerServing[idx].RecipeID = recipe.ID
-		}
-
-		for idx, _ := range recipeRegister.Steps {
-			recipeRegister.Steps[idx].RecipeID = recipe.ID
-		}
+	if err := validateRecipeSteps(recipeRegister.Steps); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
 
-		helpers.DB.Create(recipeRegister.IngredientsPerServing)
-		helpers.DB.Create(recipeRegister.Steps)
+	if err := resolveIngredientsText(&recipeRegister); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
 
+	if err := saveRecipeAggregate(&recipe, recipeRegister.IngredientsPerServing, recipeRegister.Steps, recipeRegister.Tags, recipe.UserID, "created", ""); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+	} else {
 		c.JSON(http.StatusCreated, models.ResponseResult{Success: true, Message: "Success", Data: models.RecipeResult201{
 			ID:                    recipe.ID,
 			Name:                  recipe.Name,
-			Image:                 recipe.Image,
+			Image:                 recipeImageURL(recipe),
 			RecipeCategoryId:      recipe.RecipeCategoryId,
+			UserID:                recipe.UserID,
+			Revision:              recipe.Revision,
+			ActiveTime:            recipe.ActiveTime,
+			PassiveTime:           recipe.PassiveTime,
+			TotalTime:             recipe.TotalTime,
 			NServing:              recipe.NServing,
 			NReactionLike:         recipe.NReactionLike,
 			NReactionNeutral:      recipe.NReactionNeutral,
 			NReactionDislike:      recipe.NReactionDislike,
 			IngredientsPerServing: recipeRegister.IngredientsPerServing,
 			Steps:                 recipeRegister.Steps,
+			Tags:                  recipeTagNames(recipe.ID),
 			CreatedAt:             recipe.CreatedAt,
 			UpdatedAt:             recipe.UpdatedAt,
 		}})
@@ -90,10 +107,13 @@ func RecipeCreate(c *gin.Context) {
 // RecipeGetByRecipeID godoc
 // @Summary Get recipe by recipeID from token
 // @Description Get recipe by recipeID from token
+// @Description Signed in users get allergyWarning with the allergens of the recipe that are in their allergy profile.
 // @Tags recipe
 // @Accept */*
 // @Produce  json
 // @Param recipe_id path int true "id recipe to get"
+// @Param nServing query number false "scale ingredients and nutrition to this many servings"
+// @Param units query string false "original (default), metric, imperial or kitchen"
 // @Security Bearer
 // @Success 200 {object} models.ResponseResult{result=models.RecipeResult200}
 // @Failure 401 {object} models.ResponseError{Error=string}
@@ -103,9 +123,16 @@ func RecipeCreate(c *gin.Context) {
 func RecipeGetByRecipeID(c *gin.Context) {
 	var recipe_id = c.Param("recipe_id")
 	var nServing = c.Query("nServing")
+	var unitSystem = c.Query("units")
 	recipe_id_uint64, _ := strconv.ParseUint(recipe_id, 10, 64)
 	nServing_float64, _ := strconv.ParseFloat(nServing, 10)
 
+	system, ok := units.ParseSystem(unitSystem)
+	if !ok && unitSystem != "" && unitSystem != "original" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "units must be original, metric, imperial or kitchen"})
+		return
+	}
+
 	var recipe models.Recipe
 
 	err := helpers.DB.Model(&recipe).Where(models.Recipe{ID: uint(recipe_id_uint64)}).First(&recipe).Error
@@ -120,85 +147,122 @@ func RecipeGetByRecipeID(c *gin.Context) {
 			c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(recipe_id_uint64) + " has no ingridients"})
 			return
 		} else {
+			scaled := false
 			if recipe.NServing != nServing_float64 && nServing_float64 > 0 {
 				for idx, _ := range ingredientsPerServings {
 					ingredientsPerServings[idx].Value = (nServing_float64 / recipe.NServing) * ingredientsPerServings[idx].Value
+					ingredientsPerServings[idx].ValueMax = (nServing_float64 / recipe.NServing) * ingredientsPerServings[idx].ValueMax
 				}
 				recipe.NServing = nServing_float64
+				scaled = true
 			}
+			nutrition := recipeNutrition(ingredientsPerServings, recipe.NServing)
+			items := make([]string, 0, len(ingredientsPerServings))
+			for _, ingredient := range ingredientsPerServings {
+				items = append(items, ingredient.Item)
+			}
+			dietary := helpers.AnalyzeDietary(items)
+			allergens, _ := models.RecipeAllergens(helpers.DB, []uint{recipe.ID})
+			convertIngredientUnits(ingredientsPerServings, system, scaled)
 
 			var recipeCategory models.RecipeCategory
 			recipeCategory.ID = recipe.RecipeCategoryId
 			helpers.DB.Model(&recipeCategory).Where(models.RecipeCategory{ID: recipe.RecipeCategoryId}).First(&recipeCategory)
 
+			image, thumbnails := recipeImageURLs(recipe)
+			c.Header("ETag", recipeETag(recipe))
 			c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.RecipeResult200{
 				ID:                    recipe.ID,
 				Name:                  recipe.Name,
-				Image:                 recipe.Image,
+				Image:                 image,
+				Thumbnails:            thumbnails,
 				NReactionLike:         recipe.NReactionLike,
 				NReactionNeutral:      recipe.NReactionNeutral,
 				NReactionDislike:      recipe.NReactionDislike,
+				LikeRatio:             recipe.LikeRatio,
+				WilsonScore:           recipe.WilsonScore,
 				RecipeCategoryId:      recipe.RecipeCategoryId,
 				NServing:              recipe.NServing,
 				IngredientsPerServing: ingredientsPerServings,
 				CreatedAt:             recipe.CreatedAt,
 				UpdatedAt:             recipe.UpdatedAt,
 				RecipeCategory:        recipeCategory,
+				UserID:                recipe.UserID,
+				Author:                recipeAuthors([]uint{recipe.UserID})[recipe.UserID],
+				Revision:              recipe.Revision,
+				ActiveTime:            recipe.ActiveTime,
+				PassiveTime:           recipe.PassiveTime,
+				TotalTime:             recipe.TotalTime,
+				Nutrition:             nutrition,
+				Tags:                  recipeTagNames(recipe.ID),
+				Allergens:             nonNilStrings(allergens[recipe.ID]),
+				AllergenItems:         dietary.AllergenItems,
+				Diets:                 recipe.Diets(),
+				AllergyWarning:        allergyWarning(c, allergens[recipe.ID]),
 			}})
 			return
 		}
-
-		// var file models.File
-		// helpers.DB.Model(&file).Where("id = ?", recipe.ImageID).First(&file)
-
-		// url, _ := helpers.GetFileFromBucket(file.Url)
-		// c.JSON(http.StatusOK, models.ResponseResult{Result: models.RecipeResult200{ID: recipe.ID, Judul: recipe.Judul, Image: url, Text: recipe.Text, UndanganID: recipe.UndanganID}})
 	}
 }
 
+// RecipeGetAll godoc
+// @Summary List recipes
+// @Description Recipes matching all filters, with the real total for pagination and facet counts. Filters take comma separated or repeated values,
+// @Description values of categoryId and score are alternatives, every ingredient has to be in the recipe.
+// @Description A facet counts recipes with every filter applied except its own, so alternatives stay visible.
+// @Description Signed in users do not get recipes containing an allergen of their allergy profile unless allergyProfile=false.
+// @Description With limit the response has nextCursor and prevCursor, also given as links in the Link header.
+// @Tags recipe
+// @Produce  json
+// @Param q query string false "full text query, results are ordered by relevance unless sort is given"
+// @Param categoryId query []int false "categories" collectionFormat(csv)
+// @Param authorId query []int false "authors" collectionFormat(csv)
+// @Param ingredientId query []int false "catalog ingredients the recipe contains" collectionFormat(csv)
+// @Param ingredient query []string false "names of ingredients the recipe contains" collectionFormat(csv)
+// @Param score query []string false "reaction score ranges: 90-100, 75-90, 50-75, 0-50" collectionFormat(csv)
+// @Param tagId query []int false "tags the recipe has" collectionFormat(csv)
+// @Param tag query []string false "names of tags the recipe has" collectionFormat(csv)
+// @Param excludeAllergen query []string false "allergens the recipe must not contain: nuts, shellfish, dairy, gluten, egg, soy" collectionFormat(csv)
+// @Param diet query []string false "diets the recipe fits: vegetarian, vegan, halal" collectionFormat(csv)
+// @Param allergyProfile query bool false "false to show recipes the signed in user is allergic to"
+// @Param time query []string false "total time ranges in minutes: 0-15, 15-30, 30-60, 60-120, 120- (two hours or more)" collectionFormat(csv)
+// @Param maxTime query int false "ready in at most this many minutes, recipes without a known time are left out"
+// @Param facets query bool false "include facet counts, true by default"
+// @Param facetLimit query int false "ingredients in the ingredient facet, 20 by default"
+// @Param sort query string false "relevance (with q), name_asc, name_desc, like_asc, like_desc, time_asc, time_desc, score_asc, score_desc (Wilson score of the likes), like_ratio_asc, like_ratio_desc, newest or oldest (default)"
+// @Param limit query int false "recipes per page, all without"
+// @Param cursor query string false "nextCursor or prevCursor of the previous response"
+// @Param skip query int false "skip, prefer cursor"
+// @Success 200 {object} models.ResponseResult{result=models.RecipeListResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Router /recipes [get]
 func RecipeGetAll(c *gin.Context) {
-	var skip = c.Query("skip")
-	var limit = c.Query("limit")
-	var sort = c.Query("sort")
-	var q = c.Query("q")
-	var categoryId = c.Query("categoryId")
-
-	var recipes []models.Recipe
-	var recipesResult []models.RecipeResultGetAll
-
-	query := helpers.DB.Model(&recipes)
-
-	categoryId_uint64, _ := strconv.ParseUint(categoryId, 10, 64)
-	if categoryId_uint64 > 0 {
-		query.Where("recipe_category_id", categoryId_uint64)
+	filters, err := parseRecipeFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
 	}
 
-	if q != "" {
-		query.Where("name LIKE ?", "%"+q+"%")
+	sorts, defaultSort := recipeSorts(filters.searchIds)
+	page, err := helpers.ParsePagination(c, sorts, defaultSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
 	}
 
-	if sort != "" {
-		//name_asc|name_desc|like_desc
-		s := strings.Split(sort, "_")
-
-		if s[0] != "" {
-			if s[0] == "like" {
-				s[0] = "n_reaction_like"
-			}
-		}
-
-		query.Order(s[0] + " " + s[1])
-
-	}
+	var recipes []models.Recipe
 
-	if limit != "" {
-		limit_uint64, _ := strconv.ParseInt(limit, 10, 64)
-		query.Limit(int(limit_uint64))
+	var total int64
+	if err := filters.apply(helpers.DB.Model(&models.Recipe{}), "").Count(&total).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe not found"})
+		return
 	}
 
-	if skip != "" {
-		skip_uint64, _ := strconv.ParseInt(skip, 10, 64)
-		query.Offset(int(skip_uint64))
+	query, err := page.Apply(filters.apply(helpers.DB.Model(&recipes), ""), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
 	}
 
 	query.Find(&recipes)
@@ -207,31 +271,23 @@ func RecipeGetAll(c *gin.Context) {
 		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe not found"})
 		return
 	} else {
-		for _, recipe := range recipes {
-			var recipeCategory models.RecipeCategory
-			recipeCategory.ID = recipe.RecipeCategoryId
-			helpers.DB.Model(&recipeCategory).Where(models.RecipeCategory{ID: recipe.RecipeCategoryId}).First(&recipeCategory)
-
-			recipesResult = append(recipesResult, models.RecipeResultGetAll{
-				ID:               recipe.ID,
-				Name:             recipe.Name,
-				Image:            recipe.Image,
-				NReactionLike:    recipe.NReactionLike,
-				NReactionNeutral: recipe.NReactionNeutral,
-				NReactionDislike: recipe.NReactionDislike,
-				RecipeCategoryId: recipe.RecipeCategoryId,
-				CreatedAt:        recipe.CreatedAt,
-				UpdatedAt:        recipe.UpdatedAt,
-				RecipeCategory:   recipeCategory,
-			})
+		data := models.RecipeListResult{
+			Total:       total,
+			PageCursors: page.Finish(c, &recipes, recipeSortValue(page, &recipes, filters.searchIds)),
 		}
+		data.Recipes = recipeListResults(recipes)
 
-		data := struct {
-			Total   int                         `json:"total"`
-			Recipes []models.RecipeResultGetAll `json:"recipes"`
-		}{
-			Total:   len(recipesResult),
-			Recipes: recipesResult,
+		if c.DefaultQuery("facets", "true") != "false" {
+			facetLimit, err := strconv.Atoi(c.DefaultQuery("facetLimit", strconv.Itoa(defaultFacetLimit)))
+			if err != nil || facetLimit < 0 {
+				facetLimit = defaultFacetLimit
+			}
+			facets, err := recipeFacets(filters, facetLimit)
+			if err != nil {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			data.Facets = &facets
 		}
 
 		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: data})
@@ -240,32 +296,59 @@ func RecipeGetAll(c *gin.Context) {
 
 }
 
+// RecipeSearch godoc
+// @Summary Search recipes as you type
+// @Description Full text search over names, categories, ingredients and steps, tolerating typos and
+// @Description Indonesian or English word forms. The last word also matches as prefix. Popular recipes rank higher among close matches.
+// @Tags search
+// @Produce  json
+// @Param q query string true "query, at least 2 characters"
+// @Param tag query []string false "tags the recipes must all have" collectionFormat(csv)
+// @Param limit query int false "limit, 5 by default"
+// @Success 200 {object} models.ResponseResult{result=[]models.RecipeResultSearch}
+// @Failure 404
+// @Router /search/recipes [get]
 func RecipeSearch(c *gin.Context) {
 	var limit = c.Query("limit")
 	var q = c.Query("q")
 
 	var recipes []models.Recipe
-	var recipesResult []models.RecipeResultSearch
+	var recipesResult = []models.RecipeResultSearch{}
 
-	query := helpers.DB.Model(&recipes).Select("id", "name")
-
-	if q != "" && len(q) >= 2 {
-		query.Where("name LIKE ?", "%"+q+"%")
+	if len(strings.TrimSpace(q)) < 2 {
+		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: recipesResult})
+		return
 	}
 
+	ids, hits := searchRecipes(q, true)
+	if tags := queryList(c, "tag"); len(tags) > 0 {
+		ids = filterRecipesByTags(ids, tags)
+	}
+	limit_int := 5
 	if limit != "" {
 		limit_uint64, _ := strconv.ParseInt(limit, 10, 64)
-		query.Limit(int(limit_uint64))
-	} else {
-		query.Limit(5)
+		limit_int = int(limit_uint64)
+	}
+	if limit_int >= 0 && limit_int < len(ids) {
+		ids = ids[:limit_int]
 	}
 
-	query.Find(&recipesResult)
+	query := helpers.DB.Model(&recipes).Select("id", "name").Where("id IN ?", ids)
+	query.Find(&recipes)
 
 	if query.Error != nil {
 		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe not found"})
 		return
 	} else {
+		names := make(map[uint]string)
+		for _, recipe := range recipes {
+			names[recipe.ID] = recipe.Name
+		}
+		for _, id := range ids {
+			if name, ok := names[id]; ok {
+				recipesResult = append(recipesResult, models.RecipeResultSearch{ID: id, Name: name, Matches: hits[id].Fields})
+			}
+		}
 		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: recipesResult})
 		return
 	}
@@ -359,11 +442,30 @@ func RecipeEditByRecipeID(c *gin.Context) {
 		return
 	}
 
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok || !canManageRecipe(tokenAuth, _recipe) {
+		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+		return
+	}
+
+	if err := validateRecipeSteps(recipeRegister.Steps); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	if err := resolveIngredientsText(&recipeRegister); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	image, imageKey := recipeImageFields(_recipe, recipeRegister.Image)
 	var recipe = models.Recipe{
 		ID:               uint(recipe_id_uint64),
 		Name:             recipeRegister.Name,
-		Image:            recipeRegister.Image,
+		Image:            image,
+		ImageKey:         imageKey,
 		RecipeCategoryId: recipeRegister.RecipeCategoryId,
+		UserID:           _recipe.UserID,
 		NServing:         recipeRegister.NServing,
 		NReactionLike:    _recipe.NReactionLike,
 		NReactionNeutral: _recipe.NReactionNeutral,
@@ -371,48 +473,200 @@ func RecipeEditByRecipeID(c *gin.Context) {
 		CreatedAt:        _recipe.CreatedAt,
 	}
 
-	if err := helpers.DB.Save(&recipe).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
+	if err := saveRecipeAggregate(&recipe, recipeRegister.IngredientsPerServing, recipeRegister.Steps, recipeRegister.Tags, uint(tokenAuth.UserId), "edited", c.GetHeader("If-Match")); err != nil {
+		if errors.Is(err, errRecipeModified) {
+			c.JSON(http.StatusPreconditionFailed, models.ResponseError{Success: false, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
 	} else {
-		err := helpers.DB.Model(&models.RecipeStep{}).Where(models.RecipeStep{RecipeID: recipe.ID}).Unscoped().Delete(&models.RecipeStep{}).Error
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
-		} else {
-			err = helpers.DB.Model(&models.RecipeIngridient{}).Where(models.RecipeIngridient{RecipeID: recipe.ID}).Unscoped().Delete(&models.RecipeIngridient{}).Error
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
-			} else {
-				for idx, _ := range recipeRegister.IngredientsPerServing {
-					recipeRegister.IngredientsPerServing[idx].RecipeID = recipe.ID
-				}
+		c.Header("ETag", recipeETag(recipe))
+		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.RecipeResult201{
+			ID:                    recipe.ID,
+			Name:                  recipe.Name,
+			Image:                 recipeImageURL(recipe),
+			RecipeCategoryId:      recipe.RecipeCategoryId,
+			UserID:                recipe.UserID,
+			Revision:              recipe.Revision,
+			ActiveTime:            recipe.ActiveTime,
+			PassiveTime:           recipe.PassiveTime,
+			TotalTime:             recipe.TotalTime,
+			NServing:              recipe.NServing,
+			NReactionLike:         recipe.NReactionLike,
+			NReactionNeutral:      recipe.NReactionNeutral,
+			NReactionDislike:      recipe.NReactionDislike,
+			IngredientsPerServing: recipeRegister.IngredientsPerServing,
+			Steps:                 recipeRegister.Steps,
+			Tags:                  recipeTagNames(recipe.ID),
+			CreatedAt:             recipe.CreatedAt,
+			UpdatedAt:             recipe.UpdatedAt,
+		}})
+	}
 
-				for idx, _ := range recipeRegister.Steps {
-					recipeRegister.Steps[idx].RecipeID = recipe.ID
-				}
+}
 
-				helpers.DB.Create(recipeRegister.IngredientsPerServing)
-				helpers.DB.Create(recipeRegister.Steps)
-
-				c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.RecipeResult201{
-					ID:                    recipe.ID,
-					Name:                  recipe.Name,
-					Image:                 recipe.Image,
-					RecipeCategoryId:      recipe.RecipeCategoryId,
-					NServing:              recipe.NServing,
-					NReactionLike:         recipe.NReactionLike,
-					NReactionNeutral:      recipe.NReactionNeutral,
-					NReactionDislike:      recipe.NReactionDislike,
-					IngredientsPerServing: recipeRegister.IngredientsPerServing,
-					Steps:                 recipeRegister.Steps,
-					CreatedAt:             recipe.CreatedAt,
-					UpdatedAt:             recipe.UpdatedAt,
-				}})
-			}
+// RecipePatchByRecipeID godoc
+// @Summary Partially edit a recipe
+// @Description Apply a JSON Merge Patch (application/merge-patch+json) or a JSON Patch (application/json-patch+json) to the recipe document of RecipeCreate.
+// @Description Steps are numbered by their place in the patched list, stepOrder is rewritten after the patch.
+// @Description Send the ETag of the recipe in If-Match to make sure nobody changed it in between.
+// @Tags recipe
+// @Accept  application/merge-patch+json,application/json-patch+json
+// @Produce  json
+// @Param recipe_id path int true "id recipe to edit"
+// @Param If-Match header string false "ETag of the recipe"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.RecipeResult201}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 409,412,415 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /recipes/{recipe_id} [patch]
+func RecipePatchByRecipeID(c *gin.Context) {
+	var recipe_id = c.Param("recipe_id")
+	recipe_id_uint64, _ := strconv.ParseUint(recipe_id, 10, 64)
+
+	var _recipe models.Recipe
+	if err := helpers.DB.Model(&_recipe).Where("ID = ?", recipe_id_uint64).First(&_recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(recipe_id_uint64) + " not found"})
+		return
+	}
+
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok || !canManageRecipe(tokenAuth, _recipe) {
+		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+		return
+	}
+
+	patch, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	var ingredients []models.RecipeIngridient
+	var steps []models.RecipeStep
+	helpers.DB.Where(models.RecipeIngridient{RecipeID: _recipe.ID}).Find(&ingredients)
+	helpers.DB.Where(models.RecipeStep{RecipeID: _recipe.ID}).Order("step_order asc").Find(&steps)
+	for idx := range ingredients {
+		// a patched item is linked to the catalog again by its new name
+		ingredients[idx].IngredientID = nil
+	}
 
+	document, _ := json.Marshal(models.RecipeCreate{
+		Name:                  _recipe.Name,
+		RecipeCategoryId:      _recipe.RecipeCategoryId,
+		Image:                 recipeImageURL(_recipe),
+		NServing:              _recipe.NServing,
+		IngredientsPerServing: ingredients,
+		Steps:                 steps,
+		Tags:                  recipeTagNames(_recipe.ID),
+	})
+
+	var patched []byte
+	switch c.ContentType() {
+	case helpers.CONTENT_TYPE_MERGE_PATCH, "application/json":
+		patched, err = helpers.MergePatch(document, patch)
+	case helpers.CONTENT_TYPE_JSON_PATCH:
+		patched, err = helpers.JSONPatch(document, patch)
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, models.ResponseError{Success: false, Message: "Content-Type must be " + helpers.CONTENT_TYPE_MERGE_PATCH + " or " + helpers.CONTENT_TYPE_JSON_PATCH})
+		return
+	}
+	if errors.Is(err, helpers.ErrPatchTestFailed) {
+		c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "Invalid patch " + err.Error()})
+		return
+	}
+
+	var recipeRegister models.RecipeCreate
+	if err := json.Unmarshal(patched, &recipeRegister); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "Invalid patch result " + err.Error()})
+		return
+	}
+	if recipeRegister.IngredientsText != "" {
+		// the document always carries the current ingredients, text set by the patch replaces them
+		recipeRegister.IngredientsPerServing = nil
+	}
+	for idx := range recipeRegister.Steps {
+		// steps are added, moved and removed by their place in the list, it gives their order
+		recipeRegister.Steps[idx].StepOrder = idx + 1
+	}
+
+	if ok, errors := helpers.ValidateStruct(&recipeRegister); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
 		}
 
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	if err := validateRecipeSteps(recipeRegister.Steps); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	if err := resolveIngredientsText(&recipeRegister); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	image, imageKey := recipeImageFields(_recipe, recipeRegister.Image)
+	var recipe = models.Recipe{
+		ID:               _recipe.ID,
+		Name:             recipeRegister.Name,
+		Image:            image,
+		ImageKey:         imageKey,
+		RecipeCategoryId: recipeRegister.RecipeCategoryId,
+		UserID:           _recipe.UserID,
+		NServing:         recipeRegister.NServing,
+		NReactionLike:    _recipe.NReactionLike,
+		NReactionNeutral: _recipe.NReactionNeutral,
+		NReactionDislike: _recipe.NReactionDislike,
+		CreatedAt:        _recipe.CreatedAt,
+	}
+
+	if err := saveRecipeAggregate(&recipe, recipeRegister.IngredientsPerServing, recipeRegister.Steps, recipeRegister.Tags, uint(tokenAuth.UserId), "patched", c.GetHeader("If-Match")); err != nil {
+		if errors.Is(err, errRecipeModified) {
+			c.JSON(http.StatusPreconditionFailed, models.ResponseError{Success: false, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
 	}
 
+	c.Header("ETag", recipeETag(recipe))
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.RecipeResult201{
+		ID:                    recipe.ID,
+		Name:                  recipe.Name,
+		Image:                 recipeImageURL(recipe),
+		RecipeCategoryId:      recipe.RecipeCategoryId,
+		UserID:                recipe.UserID,
+		Revision:              recipe.Revision,
+		ActiveTime:            recipe.ActiveTime,
+		PassiveTime:           recipe.PassiveTime,
+		TotalTime:             recipe.TotalTime,
+		NServing:              recipe.NServing,
+		NReactionLike:         recipe.NReactionLike,
+		NReactionNeutral:      recipe.NReactionNeutral,
+		NReactionDislike:      recipe.NReactionDislike,
+		IngredientsPerServing: recipeRegister.IngredientsPerServing,
+		Steps:                 recipeRegister.Steps,
+		Tags:                  recipeTagNames(recipe.ID),
+		CreatedAt:             recipe.CreatedAt,
+		UpdatedAt:             recipe.UpdatedAt,
+	}})
 }
 
 // RecipeDeleteByRecipeID godoc
@@ -437,22 +691,394 @@ func RecipeDeleteByRecipeID(c *gin.Context) {
 		return
 	}
 
-	//TODO how to edit constraint ON DELETE
-	err := helpers.DB.Model(&models.RecipeStep{}).Where(models.RecipeStep{RecipeID: recipe.ID}).Unscoped().Delete(&models.RecipeStep{}).Error
+	if tokenAuth, ok := helpers.GetAccessDetails(c); !ok || !canManageRecipe(tokenAuth, recipe) {
+		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+		return
+	}
+
+	// steps, ingredients and tags go with the recipe in its AfterDelete hook, inside the same transaction
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Delete(&recipe).Error
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
 	} else {
-		err = helpers.DB.Model(&models.RecipeIngridient{}).Where(models.RecipeIngridient{RecipeID: recipe.ID}).Unscoped().Delete(&models.RecipeIngridient{}).Error
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
-		} else {
-			if err := helpers.DB.Model(recipe).Delete("ID = ?", recipe_id_uint64).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
-			} else {
-				c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: struct{}{}})
+		helpers.RECIPE_INDEX.Remove(recipe.ID)
+		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: struct{}{}})
+	}
+
+}
+
+// convertIngredientUnits : express ingredients in system and fill their display text. Amounts
+// are only moved to another unit when they were scaled or a system was asked for, so an
+// unscaled recipe reads as its author wrote it.
+func convertIngredientUnits(ingredients []models.RecipeIngridient, system units.System, scaled bool) {
+	for idx := range ingredients {
+		quantity := units.Quantity{Value: ingredients[idx].Value, Unit: ingredients[idx].Unit}
+		if scaled || system != "" {
+			quantity = units.Convert(quantity, system)
+		}
+
+		fractions := true
+		if unit, ok := units.Lookup(quantity.Unit); ok {
+			fractions = unit.Fractions
+		}
+		display := units.Format(quantity)
+		if ingredients[idx].ValueMax > 0 && ingredients[idx].Value > 0 {
+			// the upper bound of a range moves to the unit chosen for the lower one
+			upper := quantity.Value * ingredients[idx].ValueMax / ingredients[idx].Value
+			ingredients[idx].ValueMax = units.RoundValue(upper, fractions)
+			display = units.FormatValue(quantity.Value, fractions) + "-" + units.Format(units.Quantity{Value: upper, Unit: quantity.Unit})
+		}
+		ingredients[idx].Value = units.RoundValue(quantity.Value, fractions)
+		ingredients[idx].Unit = quantity.Unit
+		ingredients[idx].Display = display
+	}
+}
+
+// recipeListResults : recipes with their category, author, tags and allergens, the items of recipe lists
+func recipeListResults(recipes []models.Recipe) []models.RecipeResultGetAll {
+	var userIds []uint
+	var recipeIds []uint
+	for _, recipe := range recipes {
+		userIds = append(userIds, recipe.UserID)
+		recipeIds = append(recipeIds, recipe.ID)
+	}
+	authors := recipeAuthors(userIds)
+	tags, _ := models.RecipeTagNames(helpers.DB, recipeIds)
+	allergens, _ := models.RecipeAllergens(helpers.DB, recipeIds)
+
+	recipesResult := []models.RecipeResultGetAll{}
+	for _, recipe := range recipes {
+		var recipeCategory models.RecipeCategory
+		recipeCategory.ID = recipe.RecipeCategoryId
+		helpers.DB.Model(&recipeCategory).Where(models.RecipeCategory{ID: recipe.RecipeCategoryId}).First(&recipeCategory)
+
+		image, thumbnails := recipeImageURLs(recipe)
+		recipesResult = append(recipesResult, models.RecipeResultGetAll{
+			ID:               recipe.ID,
+			Name:             recipe.Name,
+			Image:            image,
+			Thumbnails:       thumbnails,
+			NReactionLike:    recipe.NReactionLike,
+			NReactionNeutral: recipe.NReactionNeutral,
+			NReactionDislike: recipe.NReactionDislike,
+			LikeRatio:        recipe.LikeRatio,
+			WilsonScore:      recipe.WilsonScore,
+			RecipeCategoryId: recipe.RecipeCategoryId,
+			CreatedAt:        recipe.CreatedAt,
+			UpdatedAt:        recipe.UpdatedAt,
+			RecipeCategory:   recipeCategory,
+			UserID:           recipe.UserID,
+			Author:           authors[recipe.UserID],
+			Revision:         recipe.Revision,
+			ActiveTime:       recipe.ActiveTime,
+			PassiveTime:      recipe.PassiveTime,
+			TotalTime:        recipe.TotalTime,
+			Tags:             nonNilStrings(tags[recipe.ID]),
+			Allergens:        nonNilStrings(allergens[recipe.ID]),
+			Diets:            recipe.Diets(),
+		})
+	}
+	return recipesResult
+}
+
+// canManageRecipe : only the owner of a recipe or an admin may change it
+func canManageRecipe(tokenAuth *helpers.AccessDetails, recipe models.Recipe) bool {
+	if tokenAuth.IsAdmin() {
+		return true
+	}
+	return recipe.UserID != 0 && uint64(recipe.UserID) == tokenAuth.UserId
+}
+
+// recipeAuthors : look up the authors of recipes by user id in one query
+func recipeAuthors(userIds []uint) map[uint]*models.RecipeAuthor {
+	authors := make(map[uint]*models.RecipeAuthor)
+
+	var users []models.User
+	if err := helpers.DB.Model(&users).Select("id", "username").Where("id IN ?", userIds).Find(&users).Error; err != nil {
+		return authors
+	}
+
+	for _, user := range users {
+		authors[user.ID] = &models.RecipeAuthor{ID: user.ID, Username: user.Username}
+	}
+	return authors
+}
+
+// validateRecipeSteps : steps are matched by their order on edit, so orders must be unique
+func validateRecipeSteps(steps []models.RecipeStep) error {
+	seen := make(map[int]bool)
+	for _, step := range steps {
+		if seen[step.StepOrder] {
+			return fmt.Errorf("stepOrder %d is used more than once", step.StepOrder)
+		}
+		seen[step.StepOrder] = true
+		if (step.ActiveSeconds != nil && *step.ActiveSeconds < 0) || (step.PassiveSeconds != nil && *step.PassiveSeconds < 0) {
+			return fmt.Errorf("durations of stepOrder %d must not be negative", step.StepOrder)
+		}
+	}
+	return nil
+}
+
+// saveRecipeAggregate : insert or update a recipe together with its ingredients, steps and
+// tags in one transaction, nothing is written when any part fails. Allergens and diets are
+// worked out from the ingredients, durations of steps sent without any from their
+// descriptions and the times of the recipe from the steps on the way. Every save is recorded
+// as a new revision made by editorID. Tags are not part of revisions, nil leaves them alone.
+// An existing recipe is locked for the save, errRecipeModified is returned when it no longer
+// matches ifMatch.
+func saveRecipeAggregate(recipe *models.Recipe, ingredients []models.RecipeIngridient, steps []models.RecipeStep, tags []string, editorID uint, note string, ifMatch string) error {
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if recipe.ID != 0 {
+			if err := lockRecipeIfMatch(tx, recipe.ID, ifMatch); err != nil {
+				return err
+			}
+		}
+		// the reaction counters only move with reactions, an edit must not write back stale ones
+		if err := tx.Omit(models.RECIPE_REACTION_COLUMNS...).Save(recipe).Error; err != nil {
+			return err
+		}
+		if err := replaceRecipeIngredients(tx, recipe.ID, ingredients); err != nil {
+			return err
+		}
+		if err := models.ApplyRecipeDietary(tx, recipe, ingredients); err != nil {
+			return err
+		}
+		models.SetStepDurations(steps)
+		if err := syncRecipeSteps(tx, recipe.ID, steps); err != nil {
+			return err
+		}
+		if err := models.ApplyRecipeTimes(tx, recipe, steps); err != nil {
+			return err
+		}
+		if tags != nil {
+			if err := replaceRecipeTags(tx, recipe.ID, tags); err != nil {
+				return err
+			}
+		}
+		return createRecipeRevision(tx, recipe, ingredients, steps, editorID, note)
+	})
+	if err == nil {
+		reindexRecipes([]uint{recipe.ID})
+	}
+	return err
+}
+
+func createRecipeRevision(tx *gorm.DB, recipe *models.Recipe, ingredients []models.RecipeIngridient, steps []models.RecipeStep, editorID uint, note string) error {
+	var latest int
+	err := tx.Model(&models.RecipeRevision{}).Where(models.RecipeRevision{RecipeID: recipe.ID}).Select("COALESCE(MAX(revision), 0)").Scan(&latest).Error
+	if err != nil {
+		return err
+	}
+
+	revision := models.NewRecipeRevision(*recipe, ingredients, steps)
+	revision.Revision = latest + 1
+	revision.UserID = editorID
+	revision.Note = note
+	if err := tx.Create(&revision).Error; err != nil {
+		return err
+	}
+
+	recipe.Revision = revision.Revision
+	return tx.Model(recipe).UpdateColumn("revision", revision.Revision).Error
+}
+
+// replaceRecipeIngredients : ingredients are not referenced from anywhere else, so they are simply rewritten
+func replaceRecipeIngredients(tx *gorm.DB, recipeID uint, ingredients []models.RecipeIngridient) error {
+	err := tx.Model(&models.RecipeIngridient{}).Where(models.RecipeIngridient{RecipeID: recipeID}).Unscoped().Delete(&models.RecipeIngridient{}).Error
+	if err != nil {
+		return err
+	}
+
+	for idx := range ingredients {
+		ingredients[idx].ID = 0
+		ingredients[idx].RecipeID = recipeID
+	}
+	if len(ingredients) == 0 {
+		return nil
+	}
+	return tx.Create(&ingredients).Error
+}
+
+func replaceRecipeTags(tx *gorm.DB, recipeID uint, tags []string) error {
+	if err := tx.Where(models.RecipeTag{RecipeID: recipeID}).Delete(&models.RecipeTag{}).Error; err != nil {
+		return err
+	}
+
+	tagIds, err := models.RecipeTagIds(tx, tags)
+	if err != nil || len(tagIds) == 0 {
+		return err
+	}
+	recipeTags := make([]models.RecipeTag, 0, len(tagIds))
+	for _, tagId := range tagIds {
+		recipeTags = append(recipeTags, models.RecipeTag{RecipeID: recipeID, TagID: tagId})
+	}
+	return tx.Create(&recipeTags).Error
+}
+
+// syncRecipeSteps : diff steps by StepOrder so steps that are kept keep their id and the
+// serve histories pointing at them, only steps that disappeared are removed
+func syncRecipeSteps(tx *gorm.DB, recipeID uint, steps []models.RecipeStep) error {
+	var existing []models.RecipeStep
+	if err := tx.Where(models.RecipeStep{RecipeID: recipeID}).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	existingByOrder := make(map[int]models.RecipeStep)
+	for _, step := range existing {
+		existingByOrder[step.StepOrder] = step
+	}
+
+	for idx := range steps {
+		steps[idx].RecipeID = recipeID
+		steps[idx].ID = 0
+
+		if old, ok := existingByOrder[steps[idx].StepOrder]; ok {
+			delete(existingByOrder, steps[idx].StepOrder)
+			steps[idx].ID = old.ID
+			steps[idx].CreatedAt = old.CreatedAt
+			if old.Description == steps[idx].Description && sameStepDuration(old, steps[idx]) {
+				continue
+			}
+			err := tx.Model(&steps[idx]).Select("description", "active_seconds", "passive_seconds", "duration_source").Updates(&steps[idx]).Error
+			if err != nil {
+				return err
 			}
+			continue
+		}
+
+		if err := tx.Create(&steps[idx]).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(existingByOrder) == 0 {
+		return nil
+	}
+
+	var removedIds []uint
+	for _, step := range existingByOrder {
+		removedIds = append(removedIds, step.ID)
+	}
+
+	// soft deleted, serve histories keep their progress on removed steps
+	return tx.Where("id IN ?", removedIds).Delete(&models.RecipeStep{}).Error
+}
+
+func sameStepDuration(a models.RecipeStep, b models.RecipeStep) bool {
+	sameSeconds := func(x *int, y *int) bool {
+		return (x == nil && y == nil) || (x != nil && y != nil && *x == *y)
+	}
+	return sameSeconds(a.ActiveSeconds, b.ActiveSeconds) && sameSeconds(a.PassiveSeconds, b.PassiveSeconds) && a.DurationSource == b.DurationSource
+}
+
+// recipeETag : changes whenever the recipe is saved, the revision tells apart saves within the same second
+func recipeETag(recipe models.Recipe) string {
+	return fmt.Sprintf("\"%d-%d-%d\"", recipe.ID, recipe.Revision, recipe.UpdatedAt.Unix())
+}
+
+// errRecipeModified : the recipe was saved since the ETag a request sent in If-Match
+var errRecipeModified = errors.New("Recipe was modified, reload it and try again")
+
+// lockRecipeIfMatch : lock the recipe row until tx ends so saves of the same recipe queue up,
+// then compare it against ifMatch. Without If-Match any state is fine.
+func lockRecipeIfMatch(tx *gorm.DB, recipeID uint, ifMatch string) error {
+	var current models.Recipe
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "revision", "updated_at").Where("id = ?", recipeID).First(&current).Error
+	if err != nil {
+		return err
+	}
+	if !recipeMatchesIfMatch(ifMatch, current) {
+		return errRecipeModified
+	}
+	return nil
+}
+
+// recipeMatchesIfMatch : an empty If-Match is always allowed
+func recipeMatchesIfMatch(ifMatch string, recipe models.Recipe) bool {
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+
+	etag := recipeETag(recipe)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return true
 		}
+	}
+	return false
+}
+
+// unknownRecipeTime stands in for the total time of recipes without one when sorting by time
+const (
+	unknownRecipeTime = 2147483647
+	recipeTimeSortSQL = "COALESCE(NULLIF(total_time, 0), 2147483647)"
+)
 
+// recipeSorts : sort keys of recipe listings, relevance (the default) only with a full text query
+func recipeSorts(searchIds []uint) (map[string]helpers.SortField, string) {
+	sorts := map[string]helpers.SortField{
+		"name_asc":  {Column: "name"},
+		"name_desc": {Column: "name", Desc: true},
+		"like_asc":  {Column: "n_reaction_like"},
+		"like_desc": {Column: "n_reaction_like", Desc: true},
+		"newest":    {Column: "created_at", Desc: true, Time: true},
+		"oldest":    {Column: "created_at", Time: true},
+		// recipes without a known time come last either way
+		"time_asc":  {Column: recipeTimeSortSQL},
+		"time_desc": {Column: "total_time", Desc: true},
+
+		// both are 0 for recipes without reactions
+		"score_asc":       {Column: "wilson_score"},
+		"score_desc":      {Column: "wilson_score", Desc: true},
+		"like_ratio_asc":  {Column: "like_ratio"},
+		"like_ratio_desc": {Column: "like_ratio", Desc: true},
+	}
+	if searchIds == nil {
+		return sorts, "oldest"
 	}
 
+	// position in the search result, the ids come from the index and not from the request
+	positions := "id"
+	if len(searchIds) > 0 {
+		ids := make([]string, 0, len(searchIds))
+		for _, id := range searchIds {
+			ids = append(ids, strconv.FormatUint(uint64(id), 10))
+		}
+		positions = "FIELD(id," + strings.Join(ids, ",") + ")"
+	}
+	sorts["relevance"] = helpers.SortField{Column: positions}
+	return sorts, "relevance"
+}
+
+// recipeSortValue : value of the sort field of the i-th recipe, for the page cursors
+func recipeSortValue(page helpers.Pagination, recipes *[]models.Recipe, searchIds []uint) func(i int) (interface{}, uint) {
+	positions := make(map[uint]int)
+	for position, id := range searchIds {
+		positions[id] = position + 1
+	}
+	return func(i int) (interface{}, uint) {
+		recipe := (*recipes)[i]
+		switch page.Sort {
+		case "name_asc", "name_desc":
+			return recipe.Name, recipe.ID
+		case "like_asc", "like_desc":
+			return recipe.NReactionLike, recipe.ID
+		case "relevance":
+			return positions[recipe.ID], recipe.ID
+		case "time_asc":
+			if recipe.TotalTime == 0 {
+				return unknownRecipeTime, recipe.ID
+			}
+			return recipe.TotalTime, recipe.ID
+		case "time_desc":
+			return recipe.TotalTime, recipe.ID
+		case "score_asc", "score_desc":
+			return recipe.WilsonScore, recipe.ID
+		case "like_ratio_asc", "like_ratio_desc":
+			return recipe.LikeRatio, recipe.ID
+		}
+		return recipe.CreatedAt, recipe.ID
+	}
 }
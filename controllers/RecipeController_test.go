@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+)
+
+func TestRecipePatchSteps(t *testing.T) {
+	useTestDB(t)
+	user := testUser(t)
+
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"insert", `[{"op": "add", "path": "/steps/1", "value": {"description": "Kocok telur"}}]`, "1:Tumis bumbu 2:Kocok telur 3:Masukkan nasi 4:Aduk rata"},
+		{"append", `[{"op": "add", "path": "/steps/-", "value": {"description": "Sajikan"}}]`, "1:Tumis bumbu 2:Masukkan nasi 3:Aduk rata 4:Sajikan"},
+		{"move", `[{"op": "move", "from": "/steps/2", "path": "/steps/0"}]`, "1:Aduk rata 2:Tumis bumbu 3:Masukkan nasi"},
+		{"remove", `[{"op": "remove", "path": "/steps/0"}]`, "1:Masukkan nasi 2:Aduk rata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipe := testRecipe(t, user, []models.RecipeStep{
+				{StepOrder: 1, Description: "Tumis bumbu"},
+				{StepOrder: 2, Description: "Masukkan nasi"},
+				{StepOrder: 3, Description: "Aduk rata"},
+			})
+
+			status := testRequest(t, testRouter(user.ID), http.MethodPatch, fmt.Sprintf("/recipes/%d", recipe.ID), helpers.CONTENT_TYPE_JSON_PATCH, tt.patch, nil)
+			if status != http.StatusOK {
+				t.Fatalf("PATCH /recipes/%d = %d, want %d", recipe.ID, status, http.StatusOK)
+			}
+
+			var steps []models.RecipeStep
+			helpers.DB.Where(models.RecipeStep{RecipeID: recipe.ID}).Order("step_order asc").Find(&steps)
+			var got []string
+			for _, step := range steps {
+				got = append(got, fmt.Sprintf("%d:%s", step.StepOrder, step.Description))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("steps = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,481 @@
+package controllers
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	FACET_CATEGORY   = "category"
+	FACET_INGREDIENT = "ingredient"
+	FACET_SCORE      = "score"
+	FACET_TAG        = "tag"
+	FACET_TIME       = "time"
+)
+
+// ingredients and tags shown in their facets unless facetLimit says otherwise
+const defaultFacetLimit = 20
+
+// recipeFilters : filters of recipe listings read from the query string. Values of a filter
+// on a single valued attribute are alternatives (categoryId=1,2 is either), ingredients
+// and tags all have to be on the recipe. searchIds is nil without a full text query.
+type recipeFilters struct {
+	searchIds     []uint
+	authorIds     []uint
+	categoryIds   []uint
+	ingredientIds []uint
+	tagIds        []uint
+	scoreRanges   []models.RecipeScoreRange
+	timeRanges    []models.RecipeTimeRange
+	// maxTime : total time in minutes the recipe must be ready in, 0 for any
+	maxTime int
+	// allergens the recipe must not contain and diets it must fit
+	excludedAllergens []string
+	diets             []string
+}
+
+// parseRecipeFilters : every filter takes comma separated values or repeats, "categoryId=1,2" or "categoryId=1&categoryId=2"
+func parseRecipeFilters(c *gin.Context) (recipeFilters, error) {
+	var filters recipeFilters
+	var err error
+
+	if filters.authorIds, err = queryUints(c, "authorId"); err != nil {
+		return filters, err
+	}
+	if filters.categoryIds, err = queryUints(c, "categoryId"); err != nil {
+		return filters, err
+	}
+	if filters.ingredientIds, err = queryUints(c, "ingredientId"); err != nil {
+		return filters, err
+	}
+
+	if filters.tagIds, err = queryUints(c, "tagId"); err != nil {
+		return filters, err
+	}
+	if names := queryList(c, "tag"); len(names) > 0 {
+		ids, ok := tagIdsOf(names)
+		if !ok {
+			// a tag nobody uses, nothing can match
+			ids = append(ids, 0)
+		}
+		filters.tagIds = uniqueUints(append(filters.tagIds, ids...))
+	}
+
+	if names := queryList(c, "ingredient"); len(names) > 0 {
+		ids, unknown := catalogIngredientIds(names)
+		if len(unknown) > 0 {
+			// an ingredient no recipe uses, nothing can match
+			ids = append(ids, 0)
+		}
+		filters.ingredientIds = uniqueUints(append(filters.ingredientIds, ids...))
+	}
+
+	for _, key := range queryList(c, "score") {
+		scoreRange, ok := recipeScoreRange(key)
+		if !ok {
+			return filters, errors.New("score must be one of " + recipeScoreRangeKeys())
+		}
+		filters.scoreRanges = append(filters.scoreRanges, scoreRange)
+	}
+
+	for _, key := range queryList(c, "time") {
+		timeRange, ok := recipeTimeRange(key)
+		if !ok {
+			return filters, errors.New("time must be one of " + recipeTimeRangeKeys())
+		}
+		filters.timeRanges = append(filters.timeRanges, timeRange)
+	}
+	if maxTime := c.Query("maxTime"); maxTime != "" {
+		if filters.maxTime, err = strconv.Atoi(maxTime); err != nil || filters.maxTime <= 0 {
+			return filters, errors.New("maxTime must be a number of minutes")
+		}
+	}
+
+	allergens := queryList(c, "excludeAllergen")
+	if c.Query("allergyProfile") != "false" {
+		allergens = append(allergens, callerAllergens(c)...)
+	}
+	for _, allergen := range allergens {
+		allergen = strings.ToLower(allergen)
+		if !helpers.IsAllergen(allergen) {
+			return filters, errors.New("excludeAllergen must be one of " + strings.Join(helpers.ALLERGENS, ", "))
+		}
+		filters.excludedAllergens = append(filters.excludedAllergens, allergen)
+	}
+	for _, diet := range queryList(c, "diet") {
+		diet = strings.ToLower(diet)
+		if !helpers.IsDiet(diet) {
+			return filters, errors.New("diet must be one of " + strings.Join(helpers.DIETS, ", "))
+		}
+		filters.diets = append(filters.diets, diet)
+	}
+
+	if q := c.Query("q"); q != "" {
+		filters.searchIds, _ = searchRecipes(q, false)
+	}
+	return filters, nil
+}
+
+// apply : add the filters to a query on recipes, leaving out the filter of facet except
+func (f recipeFilters) apply(query *gorm.DB, except string) *gorm.DB {
+	if f.searchIds != nil {
+		query = query.Where("id IN ?", f.searchIds)
+	}
+	if len(f.authorIds) > 0 {
+		query = query.Where("user_id IN ?", f.authorIds)
+	}
+	if len(f.categoryIds) > 0 && except != FACET_CATEGORY {
+		query = query.Where("recipe_category_id IN ?", f.categoryIds)
+	}
+	if except != FACET_INGREDIENT {
+		for _, id := range f.ingredientIds {
+			query = query.Where("id IN (?)", helpers.DB.Model(&models.RecipeIngridient{}).Select("recipe_id").Where("ingredient_id = ?", id))
+		}
+	}
+	if except != FACET_TAG {
+		for _, id := range f.tagIds {
+			query = query.Where("id IN (?)", taggedRecipeIds(id))
+		}
+	}
+	if len(f.scoreRanges) > 0 && except != FACET_SCORE {
+		conditions := helpers.DB
+		for _, scoreRange := range f.scoreRanges {
+			conditions = conditions.Or(recipeScoreRangeSQL(scoreRange), scoreRange.Min, scoreRange.Max)
+		}
+		query = query.Where(conditions)
+	}
+	if len(f.timeRanges) > 0 && except != FACET_TIME {
+		conditions := helpers.DB
+		for _, timeRange := range f.timeRanges {
+			sql, vars := recipeTimeRangeSQL(timeRange)
+			conditions = conditions.Or(sql, vars...)
+		}
+		query = query.Where(conditions)
+	}
+	if f.maxTime > 0 {
+		// recipes without a known time can not be said to be ready in time
+		query = query.Where("total_time > 0 AND total_time <= ?", f.maxTime*60)
+	}
+	if len(f.excludedAllergens) > 0 {
+		query = query.Where("id NOT IN (?)", helpers.DB.Model(&models.RecipeAllergen{}).Select("recipe_id").Where("allergen IN ?", f.excludedAllergens))
+	}
+	for _, diet := range f.diets {
+		// diet went through helpers.IsDiet, the columns are named after the diets
+		query = query.Where(diet+" = ?", true)
+	}
+	return query
+}
+
+// recipeFacets : recipe counts per category, ingredient, tag, reaction score range and total time range
+func recipeFacets(f recipeFilters, facetLimit int) (models.RecipeFacets, error) {
+	facets := models.RecipeFacets{}
+	var err error
+	if facets.Categories, err = categoryFacet(f); err != nil {
+		return facets, err
+	}
+	if facets.Ingredients, err = ingredientFacet(f, facetLimit); err != nil {
+		return facets, err
+	}
+	if facets.Scores, err = scoreFacet(f); err != nil {
+		return facets, err
+	}
+	if facets.Tags, err = tagFacet(f, facetLimit); err != nil {
+		return facets, err
+	}
+	if facets.Times, err = timeFacet(f); err != nil {
+		return facets, err
+	}
+	return facets, nil
+}
+
+func categoryFacet(f recipeFilters) ([]models.RecipeFacetValue, error) {
+	var rows []struct {
+		RecipeCategoryId uint
+		Count            int64
+	}
+	err := f.apply(helpers.DB.Model(&models.Recipe{}), FACET_CATEGORY).
+		Select("recipe_category_id, COUNT(*) AS count").Group("recipe_category_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64)
+	for _, row := range rows {
+		counts[row.RecipeCategoryId] = row.Count
+	}
+	selected := make(map[uint]bool)
+	for _, id := range f.categoryIds {
+		selected[id] = true
+	}
+
+	var categories []models.RecipeCategory
+	if err := helpers.DB.Order("name asc").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	values := []models.RecipeFacetValue{}
+	for _, category := range categories {
+		if counts[category.ID] == 0 && !selected[category.ID] {
+			continue
+		}
+		values = append(values, models.RecipeFacetValue{ID: category.ID, Name: category.Name, Count: counts[category.ID], Selected: selected[category.ID]})
+	}
+	sortFacetValues(values)
+	return values, nil
+}
+
+// ingredientFacet : the ingredients used most by the matching recipes. Ingredients narrow
+// the listing down, so their counts are taken with the selected ingredients applied.
+func ingredientFacet(f recipeFilters, facetLimit int) ([]models.RecipeFacetValue, error) {
+	var rows []struct {
+		IngredientID uint
+		Count        int64
+	}
+	err := helpers.DB.Model(&models.RecipeIngridient{}).
+		Select("ingredient_id, COUNT(DISTINCT recipe_id) AS count").
+		Where("ingredient_id IS NOT NULL").
+		Where("recipe_id IN (?)", f.apply(helpers.DB.Model(&models.Recipe{}), "").Select("id")).
+		Group("ingredient_id").Order("count desc").Order("ingredient_id asc").Limit(facetLimit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uint{}
+	for _, row := range rows {
+		ids = append(ids, row.IngredientID)
+	}
+	names := catalogIngredientNames(append(ids, f.ingredientIds...))
+	selected := make(map[uint]bool)
+	for _, id := range f.ingredientIds {
+		selected[id] = true
+	}
+
+	values := []models.RecipeFacetValue{}
+	listed := make(map[uint]bool)
+	for _, row := range rows {
+		listed[row.IngredientID] = true
+		values = append(values, models.RecipeFacetValue{ID: row.IngredientID, Name: names[row.IngredientID], Count: row.Count, Selected: selected[row.IngredientID]})
+	}
+	for _, id := range f.ingredientIds {
+		if name, ok := names[id]; ok && !listed[id] {
+			values = append(values, models.RecipeFacetValue{ID: id, Name: name, Selected: true})
+		}
+	}
+	sortFacetValues(values)
+	return values, nil
+}
+
+// tagFacet : the tags used most by the matching recipes, counted like ingredients
+func tagFacet(f recipeFilters, facetLimit int) ([]models.RecipeFacetValue, error) {
+	var rows []struct {
+		TagID uint
+		Count int64
+	}
+	err := helpers.DB.Model(&models.RecipeTag{}).
+		Select("tag_id, COUNT(*) AS count").
+		Where("recipe_id IN (?)", f.apply(helpers.DB.Model(&models.Recipe{}), "").Select("id")).
+		Group("tag_id").Order("count desc").Order("tag_id asc").Limit(facetLimit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []models.Tag
+	ids := append([]uint{}, f.tagIds...)
+	for _, row := range rows {
+		ids = append(ids, row.TagID)
+	}
+	if err := helpers.DB.Where("id IN ?", uniqueUints(ids)).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string)
+	for _, tag := range tags {
+		names[tag.ID] = tag.Name
+	}
+	selected := make(map[uint]bool)
+	for _, id := range f.tagIds {
+		selected[id] = true
+	}
+
+	values := []models.RecipeFacetValue{}
+	listed := make(map[uint]bool)
+	for _, row := range rows {
+		listed[row.TagID] = true
+		values = append(values, models.RecipeFacetValue{ID: row.TagID, Name: names[row.TagID], Count: row.Count, Selected: selected[row.TagID]})
+	}
+	for _, id := range f.tagIds {
+		if name, ok := names[id]; ok && !listed[id] {
+			values = append(values, models.RecipeFacetValue{ID: id, Name: name, Selected: true})
+		}
+	}
+	sortFacetValues(values)
+	return values, nil
+}
+
+func scoreFacet(f recipeFilters) ([]models.RecipeFacetValue, error) {
+	bucket := "CASE"
+	vars := []interface{}{}
+	for _, scoreRange := range models.RECIPE_SCORE_RANGES {
+		bucket += " WHEN " + recipeScoreRangeSQL(scoreRange) + " THEN ?"
+		vars = append(vars, scoreRange.Min, scoreRange.Max, scoreRange.Key)
+	}
+	bucket += " END"
+
+	var rows []struct {
+		Bucket string
+		Count  int64
+	}
+	err := f.apply(helpers.DB.Model(&models.Recipe{}), FACET_SCORE).
+		Select(bucket+" AS bucket, COUNT(*) AS count", vars...).
+		Where(models.RECIPE_SCORE_SQL + " IS NOT NULL").
+		Group("bucket").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		counts[row.Bucket] = row.Count
+	}
+	selected := make(map[string]bool)
+	for _, scoreRange := range f.scoreRanges {
+		selected[scoreRange.Key] = true
+	}
+
+	values := []models.RecipeFacetValue{}
+	for _, scoreRange := range models.RECIPE_SCORE_RANGES {
+		values = append(values, models.RecipeFacetValue{Key: scoreRange.Key, Name: scoreRange.Key + "%", Count: counts[scoreRange.Key], Selected: selected[scoreRange.Key]})
+	}
+	return values, nil
+}
+
+func recipeScoreRangeSQL(scoreRange models.RecipeScoreRange) string {
+	if scoreRange.Max >= 100 {
+		return models.RECIPE_SCORE_SQL + " >= ? AND " + models.RECIPE_SCORE_SQL + " <= ?"
+	}
+	return models.RECIPE_SCORE_SQL + " >= ? AND " + models.RECIPE_SCORE_SQL + " < ?"
+}
+
+func recipeScoreRange(key string) (models.RecipeScoreRange, bool) {
+	for _, scoreRange := range models.RECIPE_SCORE_RANGES {
+		if scoreRange.Key == key {
+			return scoreRange, true
+		}
+	}
+	return models.RecipeScoreRange{}, false
+}
+
+func recipeScoreRangeKeys() string {
+	keys := []string{}
+	for _, scoreRange := range models.RECIPE_SCORE_RANGES {
+		keys = append(keys, scoreRange.Key)
+	}
+	return strings.Join(keys, ", ")
+}
+
+// timeFacet : recipes per total time range, recipes without a known time are not counted
+func timeFacet(f recipeFilters) ([]models.RecipeFacetValue, error) {
+	bucket := "CASE"
+	vars := []interface{}{}
+	for _, timeRange := range models.RECIPE_TIME_RANGES {
+		sql, rangeVars := recipeTimeRangeSQL(timeRange)
+		bucket += " WHEN " + sql + " THEN ?"
+		vars = append(append(vars, rangeVars...), timeRange.Key)
+	}
+	bucket += " END"
+
+	var rows []struct {
+		Bucket string
+		Count  int64
+	}
+	err := f.apply(helpers.DB.Model(&models.Recipe{}), FACET_TIME).
+		Select(bucket+" AS bucket, COUNT(*) AS count", vars...).
+		Where("total_time > 0").
+		Group("bucket").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		counts[row.Bucket] = row.Count
+	}
+	selected := make(map[string]bool)
+	for _, timeRange := range f.timeRanges {
+		selected[timeRange.Key] = true
+	}
+
+	values := []models.RecipeFacetValue{}
+	for _, timeRange := range models.RECIPE_TIME_RANGES {
+		name := timeRange.Key + " min"
+		if timeRange.Max == 0 {
+			name = strconv.Itoa(timeRange.Min) + "+ min"
+		}
+		values = append(values, models.RecipeFacetValue{Key: timeRange.Key, Name: name, Count: counts[timeRange.Key], Selected: selected[timeRange.Key]})
+	}
+	return values, nil
+}
+
+// recipeTimeRangeSQL : the range is in minutes, total_time in seconds
+func recipeTimeRangeSQL(timeRange models.RecipeTimeRange) (string, []interface{}) {
+	if timeRange.Max == 0 {
+		return "total_time >= ?", []interface{}{timeRange.Min * 60}
+	}
+	return "total_time > 0 AND total_time >= ? AND total_time < ?", []interface{}{timeRange.Min * 60, timeRange.Max * 60}
+}
+
+func recipeTimeRange(key string) (models.RecipeTimeRange, bool) {
+	for _, timeRange := range models.RECIPE_TIME_RANGES {
+		if timeRange.Key == key {
+			return timeRange, true
+		}
+	}
+	return models.RecipeTimeRange{}, false
+}
+
+func recipeTimeRangeKeys() string {
+	keys := []string{}
+	for _, timeRange := range models.RECIPE_TIME_RANGES {
+		keys = append(keys, timeRange.Key)
+	}
+	return strings.Join(keys, ", ")
+}
+
+// sortFacetValues : most recipes first, then by name
+func sortFacetValues(values []models.RecipeFacetValue) {
+	sort.SliceStable(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Name < values[j].Name
+	})
+}
+
+// queryList : values of a query parameter given comma separated, repeated or both
+func queryList(c *gin.Context, name string) []string {
+	values := []string{}
+	for _, value := range c.QueryArray(name) {
+		values = append(values, splitQueryList(value)...)
+	}
+	return values
+}
+
+func queryUints(c *gin.Context, name string) ([]uint, error) {
+	ids := []uint{}
+	for _, value := range queryList(c, name) {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, errors.New(name + " must be a list of ids")
+		}
+		ids = append(ids, uint(id))
+	}
+	return uniqueUints(ids), nil
+}
@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twinj/uuid"
+	"gorm.io/gorm"
+)
+
+// RecipeImageUpload godoc
+// @Summary Upload the picture of a recipe
+// @Description Upload a jpeg, png or gif picture as multipart form field "image". The type is detected from the content,
+// @Description thumbnails are generated and the returned links expire. Uploading is recorded as a new revision.
+// @Tags recipe
+// @Accept  multipart/form-data
+// @Produce  json
+// @Param recipe_id path int true "id recipe"
+// @Param image formData file true "picture of the recipe"
+// @Param If-Match header string false "ETag of the recipe"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.RecipeImageResult200}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 412,413,415 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /recipes/{recipe_id}/image [post]
+func RecipeImageUpload(c *gin.Context) {
+	var recipe_id = c.Param("recipe_id")
+	recipe_id_uint64, _ := strconv.ParseUint(recipe_id, 10, 64)
+
+	var recipe models.Recipe
+	if err := helpers.DB.Model(&recipe).Where("ID = ?", recipe_id_uint64).First(&recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(recipe_id_uint64) + " not found"})
+		return
+	}
+
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok || !canManageRecipe(tokenAuth, recipe) {
+		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+		return
+	}
+
+	data, contentType, img, ok := readImageUpload(c, "image")
+	if !ok {
+		return
+	}
+
+	imageKey := fmt.Sprintf("recipes/%d/%s%s", recipe.ID, uuid.NewV4().String(), helpers.IMAGE_TYPES[contentType])
+	storedKeys, err := storeImage(imageKey, data, contentType, img)
+	if err != nil {
+		removeStoredObjects(storedKeys)
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Upload failed " + err.Error()})
+		return
+	}
+
+	// older pictures are kept, revisions may still point at them
+	err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockRecipeIfMatch(tx, recipe.ID, c.GetHeader("If-Match")); err != nil {
+			return err
+		}
+		recipe.Image = ""
+		recipe.ImageKey = imageKey
+		if err := tx.Model(&recipe).Select("image", "image_key", "updated_at").Updates(&recipe).Error; err != nil {
+			return err
+		}
+
+		var ingredients []models.RecipeIngridient
+		var steps []models.RecipeStep
+		if err := tx.Where(models.RecipeIngridient{RecipeID: recipe.ID}).Find(&ingredients).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(models.RecipeStep{RecipeID: recipe.ID}).Find(&steps).Error; err != nil {
+			return err
+		}
+		return createRecipeRevision(tx, &recipe, ingredients, steps, uint(tokenAuth.UserId), "image uploaded")
+	})
+	if err != nil {
+		removeStoredObjects(storedKeys)
+		if errors.Is(err, errRecipeModified) {
+			c.JSON(http.StatusPreconditionFailed, models.ResponseError{Success: false, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+
+	imageURL, thumbnails := recipeImageURLs(recipe)
+	c.Header("ETag", recipeETag(recipe))
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.RecipeImageResult200{
+		Image:      imageURL,
+		Thumbnails: thumbnails,
+		Revision:   recipe.Revision,
+	}})
+}
+
+// MediaGet godoc
+// @Summary Download a stored file
+// @Description Serves files of the filesystem storage, only links returned by the API with a valid signature work
+// @Tags media
+// @Produce  image/jpeg,image/png,image/gif
+// @Param key path string true "key of the file"
+// @Param expires query int true "expiry of the link, unix time"
+// @Param signature query string true "signature of the link"
+// @Success 200
+// @Failure 403,404
+// @Router /media/{key} [get]
+func MediaGet(c *gin.Context) {
+	storage, ok := helpers.STORAGE.(*helpers.FileStorage)
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Not found"})
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !storage.Verify(key, c.Query("expires"), c.Query("signature")) {
+		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Link is invalid or expired"})
+		return
+	}
+
+	reader, err := storage.Open(key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Not found"})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Cache-Control", "private, max-age="+fmt.Sprint(int(helpers.StorageURLTTL().Seconds())))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, -1, helpers.ContentTypeByKey(key), reader, nil)
+}
+
+// readImageUpload : the picture sent in multipart field, checked to be a jpeg, png or gif of
+// at most IMAGE_MAX_BYTES. Otherwise the error response is written.
+func readImageUpload(c *gin.Context, field string) ([]byte, string, image.Image, bool) {
+	maxBytes := helpers.ImageMaxBytes()
+	// leave room for the multipart boundaries and headers around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64<<10)
+
+	fileHeader, err := c.FormFile(field)
+	if err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			c.JSON(http.StatusRequestEntityTooLarge, models.ResponseError{Success: false, Message: "Image is larger than " + fmt.Sprint(maxBytes) + " bytes"})
+			return nil, "", nil, false
+		}
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: field + " file is required"})
+		return nil, "", nil, false
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return nil, "", nil, false
+	}
+	defer file.Close()
+
+	data, err := helpers.ReadAllLimited(file, maxBytes)
+	if errors.Is(err, helpers.ErrFileTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, models.ResponseError{Success: false, Message: "Image is larger than " + fmt.Sprint(maxBytes) + " bytes"})
+		return nil, "", nil, false
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return nil, "", nil, false
+	}
+
+	contentType, err := helpers.SniffImage(data)
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, models.ResponseError{Success: false, Message: err.Error()})
+		return nil, "", nil, false
+	}
+
+	img, err := helpers.DecodeImage(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "Invalid image " + err.Error()})
+		return nil, "", nil, false
+	}
+	return data, contentType, img, true
+}
+
+// storeImage : write the original picture and its thumbnails, returns every key written so far
+func storeImage(imageKey string, data []byte, contentType string, img image.Image) ([]string, error) {
+	stored := []string{}
+	if err := helpers.STORAGE.Put(imageKey, data, contentType); err != nil {
+		return stored, err
+	}
+	stored = append(stored, imageKey)
+
+	thumbnails, err := helpers.Thumbnails(img)
+	if err != nil {
+		return stored, err
+	}
+	for _, size := range helpers.THUMBNAIL_SIZES {
+		key := helpers.ThumbnailKey(imageKey, size.Name)
+		if err := helpers.STORAGE.Put(key, thumbnails[size.Name], "image/jpeg"); err != nil {
+			return stored, err
+		}
+		stored = append(stored, key)
+	}
+	return stored, nil
+}
+
+// storedImageKeys : keys of the picture imageKey and its thumbnails
+func storedImageKeys(imageKey string) []string {
+	keys := []string{imageKey}
+	for _, size := range helpers.THUMBNAIL_SIZES {
+		keys = append(keys, helpers.ThumbnailKey(imageKey, size.Name))
+	}
+	return keys
+}
+
+func removeStoredObjects(keys []string) {
+	for _, key := range keys {
+		if err := helpers.STORAGE.Delete(key); err != nil {
+			log.Printf("removing %s: %v", key, err)
+		}
+	}
+}
+
+// recipeImageURLs : uploaded pictures are linked through expiring URLs, other recipes keep their image URL
+func recipeImageURLs(recipe models.Recipe) (string, map[string]string) {
+	if imageURL, thumbnails, ok := storedImageURLs(recipe.ImageKey); ok {
+		return imageURL, thumbnails
+	}
+	return recipe.Image, nil
+}
+
+// storedImageURLs : expiring links to the stored picture imageKey and its thumbnails, false
+// without a picture or storage
+func storedImageURLs(imageKey string) (string, map[string]string, bool) {
+	if imageKey == "" || helpers.STORAGE == nil {
+		return "", nil, false
+	}
+
+	ttl := helpers.StorageURLTTL()
+	imageURL, err := helpers.STORAGE.URL(imageKey, ttl)
+	if err != nil {
+		return "", nil, false
+	}
+	thumbnails := make(map[string]string)
+	for _, size := range helpers.THUMBNAIL_SIZES {
+		if url, err := helpers.STORAGE.URL(helpers.ThumbnailKey(imageKey, size.Name), ttl); err == nil {
+			thumbnails[size.Name] = url
+		}
+	}
+	return imageURL, thumbnails, true
+}
+
+// recipeImageURL : link to the full size picture of recipe
+func recipeImageURL(recipe models.Recipe) string {
+	imageURL, _ := recipeImageURLs(recipe)
+	return imageURL
+}
+
+// recipeImageFields : image and image key to save when a recipe is edited. The uploaded picture
+// stays unless the edit sets another image URL, an empty image or a link to the uploaded picture
+// itself, as returned by GET, keeps it.
+func recipeImageFields(current models.Recipe, image string) (string, string) {
+	if current.ImageKey == "" {
+		return image, ""
+	}
+	if image == "" || image == current.Image || strings.Contains(image, current.ImageKey) {
+		return current.Image, current.ImageKey
+	}
+	return image, ""
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecipeRevisionGetAll godoc
+// @Summary List revisions of a recipe
+// @Description List revisions of a recipe, newest first
+// @Tags recipe
+// @Accept */*
+// @Produce  json
+// @Param recipe_id path int true "id recipe"
+// @Success 200 {object} models.ResponseResult{result=[]models.RecipeRevisionSummary}
+// @Failure 404
+// @Router /recipes/{recipe_id}/revisions [get]
+func RecipeRevisionGetAll(c *gin.Context) {
+	var recipe_id = c.Param("recipe_id")
+	recipe_id_uint64, _ := strconv.ParseUint(recipe_id, 10, 64)
+
+	var recipe models.Recipe
+	if err := helpers.DB.Model(&recipe).Where("ID = ?", recipe_id_uint64).First(&recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(recipe_id_uint64) + " not found"})
+		return
+	}
+
+	var revisions []models.RecipeRevisionSummary
+	err := helpers.DB.Model(&models.RecipeRevision{}).
+		Select("revision", "name", "user_id", "note", "created_at").
+		Where(models.RecipeRevision{RecipeID: recipe.ID}).
+		Order("revision desc").
+		Find(&revisions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: revisions})
+}
+
+// RecipeRevisionGetByRevision godoc
+// @Summary Get one revision of a recipe
+// @Description Get the full snapshot of a recipe revision
+// @Tags recipe
+// @Accept */*
+// @Produce  json
+// @Param recipe_id path int true "id recipe"
+// @Param revision path int true "revision number"
+// @Success 200 {object} models.ResponseResult{result=models.RecipeRevision}
+// @Failure 404
+// @Router /recipes/{recipe_id}/revisions/{revision} [get]
+func RecipeRevisionGetByRevision(c *gin.Context) {
+	revision, ok := findRecipeRevision(c, c.Param("revision"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: revision})
+}
+
+// RecipeRevisionDiff godoc
+// @Summary Compare two revisions of a recipe
+// @Description Structured diff going from revision "from" (default previous revision) to revision
+// @Description Changed steps carry the step before and after, a change of their durations alone counts too
+// @Tags recipe
+// @Accept */*
+// @Produce  json
+// @Param recipe_id path int true "id recipe"
+// @Param revision path int true "revision number"
+// @Param from query int false "revision to compare with"
+// @Success 200 {object} models.ResponseResult{result=models.RecipeRevisionDiff}
+// @Failure 404
+// @Router /recipes/{recipe_id}/revisions/{revision}/diff [get]
+func RecipeRevisionDiff(c *gin.Context) {
+	to, ok := findRecipeRevision(c, c.Param("revision"))
+	if !ok {
+		return
+	}
+
+	from_revision := c.Query("from")
+	if from_revision == "" {
+		from_revision = fmt.Sprint(to.Revision - 1)
+	}
+
+	from, ok := findRecipeRevision(c, from_revision)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.DiffRecipeRevisions(from, to)})
+}
+
+// RecipeRevisionRestore godoc
+// @Summary Restore a revision of a recipe
+// @Description Make an old revision current again, this is recorded as a new revision
+// @Tags recipe
+// @Accept */*
+// @Produce  json
+// @Param recipe_id path int true "id recipe"
+// @Param revision path int true "revision number"
+// @Param If-Match header string false "ETag of the recipe"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.RecipeResult201}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 412 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /recipes/{recipe_id}/revisions/{revision}/restore [post]
+func RecipeRevisionRestore(c *gin.Context) {
+	revision, ok := findRecipeRevision(c, c.Param("revision"))
+	if !ok {
+		return
+	}
+
+	var _recipe models.Recipe
+	if err := helpers.DB.Model(&_recipe).Where("ID = ?", revision.RecipeID).First(&_recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(revision.RecipeID) + " not found"})
+		return
+	}
+
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok || !canManageRecipe(tokenAuth, _recipe) {
+		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+		return
+	}
+
+	var recipe = models.Recipe{
+		ID:               _recipe.ID,
+		Name:             revision.Name,
+		Image:            revision.Image,
+		ImageKey:         revision.ImageKey,
+		RecipeCategoryId: revision.RecipeCategoryId,
+		UserID:           _recipe.UserID,
+		NServing:         revision.NServing,
+		NReactionLike:    _recipe.NReactionLike,
+		NReactionNeutral: _recipe.NReactionNeutral,
+		NReactionDislike: _recipe.NReactionDislike,
+		CreatedAt:        _recipe.CreatedAt,
+	}
+	ingredients := revision.RecipeIngridients()
+	steps := revision.RecipeSteps()
+
+	note := "restored from revision " + fmt.Sprint(revision.Revision)
+	if err := saveRecipeAggregate(&recipe, ingredients, steps, nil, uint(tokenAuth.UserId), note, c.GetHeader("If-Match")); err != nil {
+		if errors.Is(err, errRecipeModified) {
+			c.JSON(http.StatusPreconditionFailed, models.ResponseError{Success: false, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Restore failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.RecipeResult201{
+		ID:                    recipe.ID,
+		Name:                  recipe.Name,
+		Image:                 recipeImageURL(recipe),
+		RecipeCategoryId:      recipe.RecipeCategoryId,
+		UserID:                recipe.UserID,
+		Revision:              recipe.Revision,
+		ActiveTime:            recipe.ActiveTime,
+		PassiveTime:           recipe.PassiveTime,
+		TotalTime:             recipe.TotalTime,
+		NServing:              recipe.NServing,
+		NReactionLike:         recipe.NReactionLike,
+		NReactionNeutral:      recipe.NReactionNeutral,
+		NReactionDislike:      recipe.NReactionDislike,
+		IngredientsPerServing: ingredients,
+		Steps:                 steps,
+		Tags:                  recipeTagNames(recipe.ID),
+		CreatedAt:             recipe.CreatedAt,
+		UpdatedAt:             recipe.UpdatedAt,
+	}})
+}
+
+// findRecipeRevision : load revision of the recipe in the path, responds 404 when missing
+func findRecipeRevision(c *gin.Context, revision string) (models.RecipeRevision, bool) {
+	recipe_id_uint64, _ := strconv.ParseUint(c.Param("recipe_id"), 10, 64)
+	revision_int, _ := strconv.Atoi(revision)
+
+	var recipeRevision models.RecipeRevision
+	err := helpers.DB.Where(models.RecipeRevision{RecipeID: uint(recipe_id_uint64), Revision: revision_int}).First(&recipeRevision).Error
+	if err != nil || revision_int <= 0 {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Revision " + fmt.Sprint(revision) + " of recipe with id " + fmt.Sprint(recipe_id_uint64) + " not found"})
+		return recipeRevision, false
+	}
+	return recipeRevision, true
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+	"github.com/nadhirfr/codefood/search"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RecipeSearchByIngredients godoc
+// @Summary Find recipes to cook with the ingredients at hand
+// @Description Recipes using at least one ingredient of have, ranked by the share of their ingredients the user has.
+// @Description Ingredients are matched through the catalog, so aliases and translations work ("egg" finds "telur").
+// @Description Recipes with any ingredient of exclude are left out, exclusions are matched through the catalog as well.
+// @Tags search
+// @Produce  json
+// @Param have query string true "comma separated ingredients at hand"
+// @Param missingMax query int false "most ingredients a recipe may lack, no limit by default"
+// @Param exclude query string false "comma separated ingredients recipes must not contain"
+// @Param tag query []string false "tags the recipes must all have" collectionFormat(csv)
+// @Param skip query int false "skip"
+// @Param limit query int false "limit, 20 by default"
+// @Success 200 {object} models.ResponseResult{result=models.RecipeByIngredientsResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /search/recipes/by-ingredients [get]
+func RecipeSearchByIngredients(c *gin.Context) {
+	var skip = c.Query("skip")
+	var limit = c.DefaultQuery("limit", "20")
+	var missingMax = c.Query("missingMax")
+
+	have := splitQueryList(c.Query("have"))
+	if len(have) == 0 {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "have is required"})
+		return
+	}
+
+	maxMissing := -1
+	if missingMax != "" {
+		missingMax_int64, err := strconv.ParseInt(missingMax, 10, 64)
+		if err != nil || missingMax_int64 < 0 {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "missingMax is invalid"})
+			return
+		}
+		maxMissing = int(missingMax_int64)
+	}
+
+	haveIds, unknown := catalogIngredientIds(have)
+	result := models.RecipeByIngredientsResult{Unknown: unknown, Recipes: []models.RecipeResultByIngredients{}}
+	tagIds, tagsKnown := tagIdsOf(queryList(c, "tag"))
+	if len(haveIds) == 0 || !tagsKnown {
+		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+		return
+	}
+
+	// ingredients outside the catalog have no id, they count by their item
+	nIngredient := "COUNT(DISTINCT recipe_ingridients.ingredient_id) + COUNT(DISTINCT CASE WHEN recipe_ingridients.ingredient_id IS NULL THEN recipe_ingridients.item END)"
+	nHave := "COUNT(DISTINCT CASE WHEN recipe_ingridients.ingredient_id IN ? THEN recipe_ingridients.ingredient_id END)"
+	candidates := helpers.DB.Model(&models.RecipeIngridient{}).Select("recipe_id").Where("ingredient_id IN ?", haveIds)
+	matching := func() *gorm.DB {
+		query := helpers.DB.Model(&models.RecipeIngridient{}).
+			Select("recipe_ingridients.recipe_id AS recipe_id, recipes.n_reaction_like AS n_reaction_like, "+nIngredient+" AS n_ingredient, "+nHave+" AS n_have", haveIds).
+			Joins("INNER JOIN recipes ON recipes.id = recipe_ingridients.recipe_id").
+			Where("recipe_ingridients.recipe_id IN (?)", candidates).
+			Group("recipe_ingridients.recipe_id").
+			Group("recipes.n_reaction_like")
+		if excluded := excludedRecipeIds(splitQueryList(c.Query("exclude"))); excluded != nil {
+			query.Where("recipe_ingridients.recipe_id NOT IN (?)", excluded)
+		}
+		for _, tagId := range tagIds {
+			query.Where("recipe_ingridients.recipe_id IN (?)", taggedRecipeIds(tagId))
+		}
+		if maxMissing >= 0 {
+			query.Having("n_ingredient - n_have <= ?", maxMissing)
+		}
+		return helpers.DB.Table("(?) AS matches", query)
+	}
+
+	var total int64
+	if err := matching().Count(&total).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	result.Total = int(total)
+
+	// best coverage first, then the recipe needing the fewest extra ingredients, then the most liked
+	page := matching().Select("recipe_id").Order("n_have / n_ingredient DESC, n_ingredient - n_have ASC, n_reaction_like DESC, recipe_id ASC")
+	skip_int64, _ := strconv.ParseInt(skip, 10, 64)
+	if skip_int64 > 0 {
+		page.Offset(int(skip_int64))
+	}
+	if limit_int64, err := strconv.ParseInt(limit, 10, 64); err == nil && limit_int64 >= 0 {
+		page.Limit(int(limit_int64))
+	}
+	var recipeIds []uint
+	if err := page.Pluck("recipe_id", &recipeIds).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if len(recipeIds) == 0 {
+		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+		return
+	}
+
+	var rows []models.RecipeIngridient
+	if err := helpers.DB.Select("recipe_id", "ingredient_id", "item").Where("recipe_id IN ?", recipeIds).Find(&rows).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	matches := matchRecipeIngredients(rows, haveIds)
+
+	var recipes []models.Recipe
+	if err := helpers.DB.Where("id IN ?", recipeIds).Find(&recipes).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	position := make(map[uint]int)
+	for idx, recipeId := range recipeIds {
+		position[recipeId] = idx
+	}
+	sort.Slice(recipes, func(i, j int) bool { return position[recipes[i].ID] < position[recipes[j].ID] })
+
+	for _, recipe := range recipeListResults(recipes) {
+		match := matches[recipe.ID]
+		match.RecipeResultGetAll = recipe
+		result.Recipes = append(result.Recipes, match)
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+}
+
+// matchRecipeIngredients : the ingredients of every recipe in rows the user has and lacks
+func matchRecipeIngredients(rows []models.RecipeIngridient, haveIds []uint) map[uint]models.RecipeResultByIngredients {
+	haveSet := make(map[uint]bool)
+	for _, id := range haveIds {
+		haveSet[id] = true
+	}
+
+	ingredientIds := []uint{}
+	for _, row := range rows {
+		if row.IngredientID != nil {
+			ingredientIds = append(ingredientIds, *row.IngredientID)
+		}
+	}
+	names := catalogIngredientNames(ingredientIds)
+
+	matches := make(map[uint]models.RecipeResultByIngredients)
+	seen := make(map[uint]map[string]bool)
+	for _, row := range rows {
+		name := helpers.IngredientName(row.Item)
+		key := "item:" + helpers.IngredientKey(row.Item)
+		if row.IngredientID != nil {
+			key = "id:" + strconv.FormatUint(uint64(*row.IngredientID), 10)
+			if catalogName, ok := names[*row.IngredientID]; ok {
+				name = catalogName
+			}
+		}
+		if seen[row.RecipeID] == nil {
+			seen[row.RecipeID] = make(map[string]bool)
+		}
+		// the same ingredient listed twice, e.g. for the dough and the filling, counts once
+		if seen[row.RecipeID][key] {
+			continue
+		}
+		seen[row.RecipeID][key] = true
+
+		match := matches[row.RecipeID]
+		match.NIngredient++
+		if row.IngredientID != nil && haveSet[*row.IngredientID] {
+			match.NHave++
+			match.Have = append(match.Have, name)
+		} else {
+			match.NMissing++
+			match.Missing = append(match.Missing, name)
+		}
+		matches[row.RecipeID] = match
+	}
+
+	for recipeId, match := range matches {
+		if match.Missing == nil {
+			match.Missing = []string{}
+			matches[recipeId] = match
+		}
+	}
+	return matches
+}
+
+// catalogIngredientIds : ids of the catalog ingredients known by names, names the catalog does not know are returned apart
+func catalogIngredientIds(names []string) ([]uint, []string) {
+	keys := []string{}
+	for _, name := range names {
+		if key := helpers.IngredientKey(name); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return []uint{}, names
+	}
+
+	var aliases []models.IngredientAlias
+	helpers.DB.Where("alias IN ?", keys).Find(&aliases)
+	idsByAlias := make(map[string]uint)
+	for _, alias := range aliases {
+		idsByAlias[alias.Alias] = alias.IngredientID
+	}
+
+	ids := []uint{}
+	unknown := []string{}
+	for _, name := range names {
+		if id, ok := idsByAlias[helpers.IngredientKey(name)]; ok {
+			ids = append(ids, id)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return uniqueUints(ids), unknown
+}
+
+func catalogIngredientNames(ids []uint) map[uint]string {
+	names := make(map[uint]string)
+	if len(ids) == 0 {
+		return names
+	}
+	var ingredients []models.Ingredient
+	helpers.DB.Select("id", "name").Where("id IN ?", uniqueUints(ids)).Find(&ingredients)
+	for _, ingredient := range ingredients {
+		names[ingredient.ID] = ingredient.Name
+	}
+	return names
+}
+
+// excludedRecipeIds : subquery of recipes containing any of names, matched through the catalog
+// so "egg" leaves "eggplant" alone. Nil when none of names is a known ingredient, no recipe has
+// an ingredient outside the catalog.
+func excludedRecipeIds(names []string) *gorm.DB {
+	ids, _ := catalogIngredientIds(names)
+	if len(ids) == 0 {
+		return nil
+	}
+	return helpers.DB.Model(&models.RecipeIngridient{}).Select("recipe_id").Where("ingredient_id IN ?", ids)
+}
+
+// splitQueryList : values of a comma separated query parameter
+func splitQueryList(value string) []string {
+	values := []string{}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// searchRecipes : ids of the recipes matching q in the full text index, the most relevant first
+// after boosting popular recipes. Recipes gone from the database are skipped.
+func searchRecipes(q string, prefix bool) ([]uint, map[uint]search.Hit) {
+	hits := helpers.RECIPE_INDEX.Search(q, prefix)
+	hitsById := make(map[uint]search.Hit)
+	ids := make([]uint, 0, len(hits))
+	for _, hit := range hits {
+		hitsById[hit.ID] = hit
+		ids = append(ids, hit.ID)
+	}
+	if len(ids) == 0 {
+		return ids, hitsById
+	}
+
+	var recipes []models.Recipe
+	helpers.DB.Model(&models.Recipe{}).Select("id", "n_reaction_like").Where("id IN ?", ids).Find(&recipes)
+
+	ids = ids[:0]
+	scores := make(map[uint]float64)
+	for _, recipe := range recipes {
+		ids = append(ids, recipe.ID)
+		scores[recipe.ID] = helpers.SearchLikeBoost(hitsById[recipe.ID].Score, recipe.NReactionLike)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	for id, hit := range hitsById {
+		hit.Score = scores[id]
+		hitsById[id] = hit
+	}
+	return ids, hitsById
+}
+
+// reindexRecipes : bring the full text index up to date with recipeIds after they changed
+func reindexRecipes(recipeIds []uint) {
+	if len(recipeIds) == 0 {
+		return
+	}
+	documents, err := models.RecipeSearchDocuments(helpers.DB, recipeIds)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	found := make(map[uint]bool)
+	for _, document := range documents {
+		found[document.ID] = true
+		helpers.RECIPE_INDEX.Put(document)
+	}
+	for _, id := range recipeIds {
+		if !found[id] {
+			helpers.RECIPE_INDEX.Remove(id)
+		}
+	}
+}
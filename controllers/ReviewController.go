@@ -0,0 +1,575 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twinj/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errReviewReported = errors.New("review is reported already")
+
+// ServeReviewEditByServeID godoc
+// @Summary Write the review of a serve history
+// @Description The cook of a finished serve history that has a reaction writes a review of it, sending it again edits it.
+// @Description difficulty goes from 1 (easy) to 5 (hard), 0 leaves it unrated. A hidden review stays hidden when edited.
+// @Tags serve
+// @Accept  json
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Param review body models.ReviewEdit true "review"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ReviewResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 406 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /serve-histories/{serve_id}/review [put]
+func ServeReviewEditByServeID(c *gin.Context) {
+	var reviewEdit models.ReviewEdit
+	if ok, errors := helpers.DefaultValidator(c, &reviewEdit); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	if reviewEdit.Difficulty != 0 && (reviewEdit.Difficulty < models.REVIEW_DIFFICULTY_MIN || reviewEdit.Difficulty > models.REVIEW_DIFFICULTY_MAX) {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "difficulty must be between " + fmt.Sprint(models.REVIEW_DIFFICULTY_MIN) + " and " + fmt.Sprint(models.REVIEW_DIFFICULTY_MAX)})
+		return
+	}
+
+	serve, ok := reviewableServe(c)
+	if !ok {
+		return
+	}
+
+	var review models.Review
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if review, err = serveReview(tx, serve); err != nil {
+			return err
+		}
+		review.Text = reviewEdit.Text
+		review.Difficulty = reviewEdit.Difficulty
+		return tx.Model(&review).Select("text", "difficulty", "updated_at").Updates(&review).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: reviewResults([]models.Review{review}, false)[0]})
+}
+
+// ServeReviewPhotoUpload godoc
+// @Summary Upload a photo of what was cooked
+// @Description Attach a jpeg, png or gif photo as multipart form field "photo" to the review of a serve history, the review is started when there is none.
+// @Description A photo uploaded before is replaced. The returned links expire.
+// @Tags serve
+// @Accept  multipart/form-data
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Param photo formData file true "photo of the dish"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ReviewResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 413,415 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /serve-histories/{serve_id}/review/photo [post]
+func ServeReviewPhotoUpload(c *gin.Context) {
+	serve, ok := reviewableServe(c)
+	if !ok {
+		return
+	}
+
+	data, contentType, img, ok := readImageUpload(c, "photo")
+	if !ok {
+		return
+	}
+
+	photoKey := fmt.Sprintf("reviews/%d/%s%s", serve.ID, uuid.NewV4().String(), helpers.IMAGE_TYPES[contentType])
+	storedKeys, err := storeImage(photoKey, data, contentType, img)
+	if err != nil {
+		removeStoredObjects(storedKeys)
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Upload failed " + err.Error()})
+		return
+	}
+
+	var review models.Review
+	var previousKey string
+	err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if review, err = serveReview(tx, serve); err != nil {
+			return err
+		}
+		previousKey = review.PhotoKey
+		review.PhotoKey = photoKey
+		return tx.Model(&review).Select("photo_key", "updated_at").Updates(&review).Error
+	})
+	if err != nil {
+		removeStoredObjects(storedKeys)
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+
+	// unlike recipe pictures no revision points at the replaced photo
+	if previousKey != "" {
+		removeStoredObjects(storedImageKeys(previousKey))
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: reviewResults([]models.Review{review}, false)[0]})
+}
+
+// RecipeReviewGetAll godoc
+// @Summary Reviews of a recipe
+// @Description Reviews written by the cooks of a recipe with their reaction, hidden reviews and reviews of serve histories whose reaction was removed are left out.
+// @Description The author of the recipe and admins see them with includeHidden=true, with the number of reports.
+// @Description With limit the response has nextCursor and prevCursor, also given as links in the Link header.
+// @Tags recipe
+// @Produce  json
+// @Param recipe_id path int true "id recipe"
+// @Param reaction query string false "like, neutral or dislike"
+// @Param withPhoto query bool false "only reviews with a photo"
+// @Param includeHidden query bool false "also hidden reviews, for the author of the recipe and admins"
+// @Param sort query string false "newest (default), oldest, difficulty_asc or difficulty_desc"
+// @Param limit query int false "reviews per page, all without"
+// @Param cursor query string false "nextCursor or prevCursor of the previous response"
+// @Param skip query int false "skip, prefer cursor"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ReviewListResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Router /recipes/{recipe_id}/reviews [get]
+func RecipeReviewGetAll(c *gin.Context) {
+	var recipe_id = c.Param("recipe_id")
+	recipe_id_uint64, _ := strconv.ParseUint(recipe_id, 10, 64)
+
+	var recipe models.Recipe
+	if err := helpers.DB.Model(&recipe).Where("ID = ?", recipe_id_uint64).First(&recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(recipe_id_uint64) + " not found"})
+		return
+	}
+
+	page, err := helpers.ParsePagination(c, reviewSorts, "newest")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	reaction := models.GetReactionId(c.Query("reaction"))
+	if c.Query("reaction") != "" && reaction == models.ReactionUnknown {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "reaction is invalid"})
+		return
+	}
+
+	moderator := false
+	if c.Query("includeHidden") == "true" {
+		tokenAuth, ok := helpers.GetAccessDetails(c)
+		if !ok || !canManageRecipe(tokenAuth, recipe) {
+			c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+			return
+		}
+		moderator = true
+	}
+
+	filter := func(query *gorm.DB) *gorm.DB {
+		query = query.Where(models.Review{RecipeID: recipe.ID})
+		if !moderator {
+			query = query.Where("hidden = ?", false)
+		}
+		if reaction != models.ReactionUnknown {
+			query = query.Where("serve_id IN (?)", helpers.DB.Model(&models.Serve{}).Select("id").Where("reaction = ?", reaction))
+		} else if !moderator {
+			// the cook removed the reaction, the review is back once the serve history is rated again
+			query = query.Where("serve_id IN (?)", helpers.DB.Model(&models.Serve{}).Select("id").Where("reaction <> ?", models.ReactionUnknown))
+		}
+		if c.Query("withPhoto") == "true" {
+			query = query.Where("photo_key <> ?", "")
+		}
+		return query
+	}
+
+	var total int64
+	var difficulty float64
+	if err := filter(helpers.DB.Model(&models.Review{})).Count(&total).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	row := filter(helpers.DB.Model(&models.Review{})).Select("COALESCE(AVG(NULLIF(difficulty, 0)), 0)").Row()
+	if err := row.Scan(&difficulty); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var reviews []models.Review
+	query, err := page.Apply(filter(helpers.DB.Model(&reviews)), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+	if err := query.Find(&reviews).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	data := models.ReviewListResult{
+		Total:       int(total),
+		Difficulty:  difficulty,
+		PageCursors: page.Finish(c, &reviews, reviewSortValue(page, &reviews)),
+	}
+	data.Reviews = reviewResults(reviews, moderator)
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: data})
+}
+
+// ReviewHideByReviewID godoc
+// @Summary Hide or show a review
+// @Description For the author of the recipe and admins. Showing a review again dismisses the reports it got.
+// @Tags review
+// @Accept  json
+// @Produce  json
+// @Param review_id path int true "id review"
+// @Param hidden body models.ReviewHide true "hidden"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ReviewResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 406 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /reviews/{review_id}/hidden [put]
+func ReviewHideByReviewID(c *gin.Context) {
+	var reviewHide models.ReviewHide
+	if ok, errors := helpers.DefaultValidator(c, &reviewHide); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	review, ok := findReview(c)
+	if !ok {
+		return
+	}
+
+	var recipe models.Recipe
+	helpers.DB.Model(&recipe).Where("ID = ?", review.RecipeID).First(&recipe)
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok || !canManageRecipe(tokenAuth, recipe) {
+		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+		return
+	}
+
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		review.Hidden = *reviewHide.Hidden
+		if review.Hidden {
+			return tx.Model(&review).Select("hidden").Updates(&review).Error
+		}
+		review.NReport = 0
+		if err := tx.Where(models.ReviewReport{ReviewID: review.ID}).Delete(&models.ReviewReport{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&review).Select("hidden", "n_report").Updates(&review).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: reviewResults([]models.Review{review}, true)[0]})
+}
+
+// ReviewReportByReviewID godoc
+// @Summary Report an abusive review
+// @Description Every user reports a review once, reviews reported by REVIEW_REPORT_HIDE_THRESHOLD users are hidden until a moderator shows them again.
+// @Tags review
+// @Accept  json
+// @Produce  json
+// @Param review_id path int true "id review"
+// @Param report body models.ReviewReportCreate true "report"
+// @Security Bearer
+// @Success 201 {object} models.ResponseResult{result=models.ReviewReport}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 406 {object} models.ResponseError{error=string}
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /reviews/{review_id}/report [post]
+func ReviewReportByReviewID(c *gin.Context) {
+	var reportCreate models.ReviewReportCreate
+	if ok, errors := helpers.DefaultValidator(c, &reportCreate); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	review, ok := findReview(c)
+	if !ok {
+		return
+	}
+
+	if uint64(review.UserID) == tokenAuth.UserId {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "Own reviews can not be reported"})
+		return
+	}
+
+	report := models.ReviewReport{ReviewID: review.ID, UserID: uint(tokenAuth.UserId), Reason: reportCreate.Reason}
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		// two reports sent at once both pass a check before inserting, the unique index tells
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errReviewReported
+		}
+
+		if err := tx.Model(&review).UpdateColumn("n_report", gorm.Expr("n_report + 1")).Error; err != nil {
+			return err
+		}
+		if threshold := helpers.ReviewReportHideThreshold(); threshold > 0 {
+			return tx.Model(&review).Where("n_report >= ?", threshold).UpdateColumn("hidden", true).Error
+		}
+		return nil
+	})
+	if errors.Is(err, errReviewReported) {
+		c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ResponseResult{Success: true, Message: "Success", Data: report})
+}
+
+// ReviewReportedGetAll godoc
+// @Summary Reported reviews
+// @Description Reviews reported at least once with the reasons given, the most reported first. Admin only.
+// @Tags review
+// @Produce  json
+// @Param sort query string false "reports_desc (default), newest or oldest"
+// @Param limit query int false "reviews per page, all without"
+// @Param cursor query string false "nextCursor or prevCursor of the previous response"
+// @Param skip query int false "skip, prefer cursor"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ReviewListResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /reviews/reported [get]
+func ReviewReportedGetAll(c *gin.Context) {
+	page, err := helpers.ParsePagination(c, reportedReviewSorts, "reports_desc")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	var total int64
+	if err := helpers.DB.Model(&models.Review{}).Where("n_report > ?", 0).Count(&total).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var reviews []models.Review
+	query, err := page.Apply(helpers.DB.Model(&reviews).Where("n_report > ?", 0), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+	if err := query.Find(&reviews).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	data := models.ReviewListResult{
+		Total:       int(total),
+		PageCursors: page.Finish(c, &reviews, reviewSortValue(page, &reviews)),
+	}
+	data.Reviews = reviewResults(reviews, true)
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: data})
+}
+
+var reviewSorts = map[string]helpers.SortField{
+	"newest":          {Column: "created_at", Desc: true, Time: true},
+	"oldest":          {Column: "created_at", Time: true},
+	"difficulty_asc":  {Column: "difficulty"},
+	"difficulty_desc": {Column: "difficulty", Desc: true},
+}
+
+var reportedReviewSorts = map[string]helpers.SortField{
+	"reports_desc": {Column: "n_report", Desc: true},
+	"newest":       {Column: "created_at", Desc: true, Time: true},
+	"oldest":       {Column: "created_at", Time: true},
+}
+
+// reviewSortValue : value of the sort field of the i-th review, for the page cursors
+func reviewSortValue(page helpers.Pagination, reviews *[]models.Review) func(i int) (interface{}, uint) {
+	return func(i int) (interface{}, uint) {
+		review := (*reviews)[i]
+		switch page.Sort {
+		case "difficulty_asc", "difficulty_desc":
+			return review.Difficulty, review.ID
+		case "reports_desc":
+			return review.NReport, review.ID
+		}
+		return review.CreatedAt, review.ID
+	}
+}
+
+// reviewableServe : the serve history of the serve_id param if the caller owns it and
+// reacted to it, otherwise the error response is written
+func reviewableServe(c *gin.Context) (models.Serve, bool) {
+	serve, ok := ownedServe(c)
+	if !ok {
+		return serve, false
+	}
+	if serve.Reaction == models.ReactionUnknown {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "Invalid status, status need to be done"})
+		return serve, false
+	}
+	return serve, true
+}
+
+// serveReview : the review of serve, started when there is none yet. A review and its photo
+// sent at once may both start it, the insert skips a review that exists and the review is
+// read back locked so the one that was committed first is seen.
+func serveReview(tx *gorm.DB, serve models.Serve) (models.Review, error) {
+	var review models.Review
+	started := models.Review{ServeID: serve.ID, RecipeID: serve.RecipeID, RecipeRevision: serve.RecipeRevision, UserID: serve.UserID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&started).Error; err != nil {
+		return review, err
+	}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(models.Review{ServeID: serve.ID}).First(&review).Error
+	return review, err
+}
+
+// serveReviewResult : the review of a serve history, nil when none was written
+func serveReviewResult(serveID uint) *models.ReviewResult {
+	var review models.Review
+	if err := helpers.DB.Where(models.Review{ServeID: serveID}).First(&review).Error; err != nil {
+		return nil
+	}
+	return &reviewResults([]models.Review{review}, false)[0]
+}
+
+// findReview : the review of the review_id param, otherwise the error response is written
+func findReview(c *gin.Context) (models.Review, bool) {
+	var review_id = c.Param("review_id")
+	review_id_uint64, _ := strconv.ParseUint(review_id, 10, 64)
+
+	var review models.Review
+	if err := helpers.DB.Where("ID = ?", review_id_uint64).First(&review).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Review with id " + fmt.Sprint(review_id_uint64) + " not found"})
+		return review, false
+	}
+	return review, true
+}
+
+// reviewResults : reviews with their authors, reactions and photo links looked up together.
+// Moderators also get the reports.
+func reviewResults(reviews []models.Review, moderator bool) []models.ReviewResult {
+	results := []models.ReviewResult{}
+	if len(reviews) == 0 {
+		return results
+	}
+
+	userIds := make([]uint, 0, len(reviews))
+	serveIds := make([]uint, 0, len(reviews))
+	reviewIds := make([]uint, 0, len(reviews))
+	for _, review := range reviews {
+		userIds = append(userIds, review.UserID)
+		serveIds = append(serveIds, review.ServeID)
+		reviewIds = append(reviewIds, review.ID)
+	}
+	authors := recipeAuthors(userIds)
+
+	var serves []models.Serve
+	helpers.DB.Select("id", "reaction").Where("id IN ?", serveIds).Find(&serves)
+	reactions := make(map[uint]models.Reaction)
+	for _, serve := range serves {
+		reactions[serve.ID] = serve.Reaction
+	}
+
+	reasons := make(map[uint][]string)
+	if moderator {
+		var reports []models.ReviewReport
+		helpers.DB.Where("review_id IN ?", reviewIds).Order("id asc").Find(&reports)
+		for _, report := range reports {
+			reasons[report.ReviewID] = append(reasons[report.ReviewID], report.Reason)
+		}
+	}
+
+	for _, review := range reviews {
+		result := models.ReviewResult{
+			ID:             review.ID,
+			ServeID:        review.ServeID,
+			RecipeID:       review.RecipeID,
+			RecipeRevision: review.RecipeRevision,
+			UserID:         review.UserID,
+			Author:         authors[review.UserID],
+			Reaction:       reactions[review.ServeID].String(),
+			Text:           review.Text,
+			Difficulty:     review.Difficulty,
+			Hidden:         review.Hidden,
+			CreatedAt:      review.CreatedAt,
+			UpdatedAt:      review.UpdatedAt,
+		}
+		result.Photo, result.PhotoThumbnails, _ = storedImageURLs(review.PhotoKey)
+		if moderator {
+			result.NReport = review.NReport
+			result.ReportReasons = reasons[review.ID]
+		}
+		results = append(results, result)
+	}
+	return results
+}
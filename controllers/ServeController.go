@@ -5,11 +5,14 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nadhirfr/codefood/helpers"
 	"github.com/nadhirfr/codefood/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ServeCreate godoc
@@ -45,8 +48,8 @@ func ServeCreate(c *gin.Context) {
 		return
 	}
 
-	tokenAuth, err := helpers.ExtractTokenMetadata(c.Request)
-	if err != nil {
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
 		return
 	}
@@ -61,16 +64,19 @@ func ServeCreate(c *gin.Context) {
 	}
 
 	var serve = models.Serve{
-		NServing: *serveRegister.NServing,
-		UserID:   uint(tokenAuth.UserId),
-		RecipeID: serveRegister.RecipeID,
+		NServing:       *serveRegister.NServing,
+		UserID:         uint(tokenAuth.UserId),
+		RecipeID:       serveRegister.RecipeID,
+		RecipeRevision: recipe.Revision,
+		State:          models.SERVE_STATE_IN_PROGRESS,
+		ActiveAt:       helpers.DB.NowFunc(),
 	}
 
 	if err := helpers.DB.Save(&serve).Error; err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 	} else {
 		var steps []models.RecipeStep
-		err := helpers.DB.Model(&steps).Where(models.RecipeStep{RecipeID: serveRegister.RecipeID}).Find(&steps).Error
+		err := helpers.DB.Model(&steps).Where(models.RecipeStep{RecipeID: serveRegister.RecipeID}).Order("step_order asc").Find(&steps).Error
 		if err != nil {
 			c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(serveRegister.RecipeID) + " has no steps"})
 			return
@@ -78,25 +84,63 @@ func ServeCreate(c *gin.Context) {
 			var serveSteps []models.ServeStep
 			var serveStepResults []models.ServeStepResult
 
+			// the first step is done right away and the cook moves on to the second
+			now := helpers.DB.NowFunc()
 			for idx, val := range steps {
-				done := false
-				if idx == 0 {
-					done = true
-				}
-				serveSteps = append(serveSteps, models.ServeStep{
+				serveStep := models.ServeStep{
 					ServeID:      serve.ID,
 					RecipeStepID: val.ID,
-					Done:         done,
-				})
-
-				serveStepResults = append(serveStepResults, models.ServeStepResult{
-					StepOrder:   val.StepOrder,
-					Description: val.Description,
-					Done:        done,
-				})
+				}
+				if idx == 0 {
+					serveStep.Done = true
+					serveStep.DoneAt = &now
+				}
+				if idx <= 1 {
+					serveStep.StartedAt = &now
+				}
+				serveSteps = append(serveSteps, serveStep)
+
+				serveStepResults = append(serveStepResults, serveStepResult(models.ServeRecipeStep{
+					Done:           serveStep.Done,
+					Description:    val.Description,
+					StepOrder:      val.StepOrder,
+					StartedAt:      serveStep.StartedAt,
+					DoneAt:         serveStep.DoneAt,
+					ActiveSeconds:  val.ActiveSeconds,
+					PassiveSeconds: val.PassiveSeconds,
+				}))
 			}
 
-			helpers.DB.Create(serveSteps)
+			logs := []models.ServeLog{{ServeID: serve.ID, Type: models.SERVE_LOG_CREATED, CreatedAt: now}}
+			for _, result := range serveStepResults {
+				if result.Done {
+					logs = append(logs, models.NewServeStepLog(serve.ID, models.SERVE_EVENT_STEP_DONE, result.StepOrder, now))
+				} else if result.StartedAt != nil {
+					logs = append(logs, models.NewServeStepLog(serve.ID, models.SERVE_EVENT_STEP_STARTED, result.StepOrder, now))
+				}
+			}
+			err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+				if len(serveSteps) > 0 {
+					if err := tx.Create(serveSteps).Error; err != nil {
+						return err
+					}
+				}
+				if err := models.LogServe(tx, logs...); err != nil {
+					return err
+				}
+				// a recipe of a single step is done with the first step
+				if len(serveSteps) <= 1 {
+					return models.TransitionServe(tx, &serve, models.SERVE_STATE_COMPLETED, now)
+				}
+				return nil
+			})
+			if err != nil {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			for _, result := range serveStepResults {
+				scheduleServeStepTimer(serve, result)
+			}
 
 			var recipeCategory models.RecipeCategory
 			recipeCategory.ID = recipe.RecipeCategoryId
@@ -106,16 +150,18 @@ func ServeCreate(c *gin.Context) {
 				ID:                 serve.ID,
 				UserID:             serve.UserID,
 				RecipeID:           serve.RecipeID,
+				RecipeRevision:     serve.RecipeRevision,
 				RecipeName:         recipe.Name,
 				RecipeCategoryName: recipeCategory.Name,
-				RecipeImage:        recipe.Image,
+				RecipeImage:        recipeImageURL(recipe),
 				RecipeCategoryId:   recipe.RecipeCategoryId,
 				NServing:           serve.NServing,
 				NStep:              float64(len(serveStepResults)),
 				NStepDone:          1,
 				Reaction:           serve.Reaction,
 				Steps:              serveStepResults,
-				Status:             "progress",
+				Status:             models.ServeStatus(serve.State),
+				State:              serve.State,
 				CreatedAt:          serve.CreatedAt,
 				UpdatedAt:          serve.UpdatedAt,
 			}})
@@ -136,14 +182,13 @@ func ServeCreate(c *gin.Context) {
 // @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
 // @Failure 400 {object} models.ResponseError{error=models.ServeError400}
 // @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
 // @Failure 406 {object} models.ResponseError{error=string}
 // @Failure 404
+// @Failure 409 {object} models.ResponseError{error=string}
 // @Failure 500
 // @Router /serve-histories/{serve_id}/done-step [post]
 func ServeEditStepByServeID(c *gin.Context) {
-	var serve_id = c.Param("serve_id")
-	serve_id_uint64, _ := strconv.ParseUint(serve_id, 10, 64)
-
 	var serveUpdatestep models.ServeUpdateStep
 
 	if ok, errors := helpers.ValidateServe(c, &serveUpdatestep); !ok {
@@ -162,131 +207,149 @@ func ServeEditStepByServeID(c *gin.Context) {
 		return
 	}
 
-	tokenAuth, err := helpers.ExtractTokenMetadata(c.Request)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
-		return
-	}
-
-	var serve = models.Serve{
-		ID: uint(serve_id_uint64),
-	}
-
-	if err := helpers.DB.Model(serve).Where("ID = ?", serve_id).First(&serve).Error; err != nil {
-		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Serve history with id " + fmt.Sprint(serve_id) + " not found"})
+	serve, ok := ownedServe(c)
+	if !ok {
 		return
 	}
 
-	if tokenAuth.UserId != uint64(serve.UserID) {
-		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+	if !serveInProgress(c, serve) {
 		return
 	}
 
-	var steps []models.ServeRecipeStep
-	var serveSteps []models.ServeStep
-	err = helpers.DB.Model(&serveSteps).
-		Select("serve_steps.*", "recipe_steps.step_order", "recipe_steps.description").
-		Joins("INNER JOIN recipe_steps ON serve_steps.recipe_step_id = recipe_steps.id").
-		Where(models.ServeStep{ServeID: serve.ID}).
-		Find(&steps).
-		Order("step_order asc").Error
+	steps, err := serveRecipeSteps(serve)
 	fmt.Println(steps)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Serve history with id " + fmt.Sprint(serve.ID) + " has no steps"})
 		return
 	} else {
-		var updateId uint
-		for _, val := range steps {
+		var updated *models.ServeRecipeStep
+		for idx := range steps {
+			if steps[idx].StepOrder == serveUpdatestep.StepOrder {
+				updated = &steps[idx]
+			}
+		}
+		if updated == nil {
+			c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Step " + fmt.Sprint(serveUpdatestep.StepOrder) + " not found"})
+			return
+		}
 
-			if val.StepOrder < serveUpdatestep.StepOrder && !val.Done {
-				c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: "Some steps before " + fmt.Sprint(serveUpdatestep.StepOrder) + " is not done yet"})
-				return
+		now := helpers.DB.NowFunc()
+		var next *models.ServeRecipeStep
+		err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+			if err := lockServeSteps(tx, &serve, steps); err != nil {
+				return err
+			}
+			if serve.State != models.SERVE_STATE_IN_PROGRESS {
+				return serveConflict("Serve history is " + serve.State + ", its steps can not change")
+			}
+			if updated.Done {
+				return serveConflict("Step " + fmt.Sprint(serveUpdatestep.StepOrder) + " is done already")
+			}
+			var completed = true
+			for _, val := range steps {
+				if val.StepOrder < serveUpdatestep.StepOrder && !val.Done {
+					return serveConflict("Some steps before " + fmt.Sprint(serveUpdatestep.StepOrder) + " is not done yet")
+				}
+				if val.StepOrder != serveUpdatestep.StepOrder && !val.Done {
+					completed = false
+				}
 			}
 
-			if val.StepOrder == serveUpdatestep.StepOrder && !val.Done {
-				updateId = val.ID
+			err := tx.Model(&models.ServeStep{ID: updated.ID}).Updates(map[string]interface{}{
+				"done":       true,
+				"done_at":    now,
+				"started_at": gorm.Expr("COALESCE(started_at, ?)", now),
+			}).Error
+			if err != nil {
+				return err
+			}
+			if next, err = startNextServeStep(tx, steps, serveUpdatestep.StepOrder, now); err != nil {
+				return err
 			}
 
-		}
+			logs := []models.ServeLog{models.NewServeStepLog(serve.ID, models.SERVE_EVENT_STEP_DONE, serveUpdatestep.StepOrder, now)}
+			if next != nil {
+				logs = append(logs, models.NewServeStepLog(serve.ID, models.SERVE_EVENT_STEP_STARTED, next.StepOrder, now))
+			}
+			if err := models.LogServe(tx, logs...); err != nil {
+				return err
+			}
+			if completed {
+				return models.TransitionServe(tx, &serve, models.SERVE_STATE_COMPLETED, now)
+			}
+			return models.TouchServe(tx, &serve, now)
+		})
+		if err != nil {
+			if serveStateConflict(c, err) {
+				return
+			}
+			c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Failed to update"})
+			return
+		} else {
+			var recipe = models.Recipe{
+				ID: serve.RecipeID,
+			}
+
+			if err := helpers.DB.Model(recipe).Where("ID = ?", serve.RecipeID).First(&recipe).Error; err != nil {
+				c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(serve.RecipeID) + " not found"})
+				return
+			}
 
-		if updateId > 0 {
-			var serveStep = models.ServeStep{ID: updateId}
+			stepsUpdated, err := serveRecipeSteps(serve)
+			fmt.Println(stepsUpdated)
 
-			err = helpers.DB.Model(&serveStep).Update("done", true).Error
 			if err != nil {
-				c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Failed to update"})
+				c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(recipe.ID) + " has no steps"})
 				return
 			} else {
-				var recipe = models.Recipe{
-					ID: serve.RecipeID,
-				}
+				var serveStepResults []models.ServeStepResult
 
-				if err := helpers.DB.Model(recipe).Where("ID = ?", serve.RecipeID).First(&recipe).Error; err != nil {
-					c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(serve.RecipeID) + " not found"})
-					return
-				}
+				var undoneCount = 0
+				for _, val := range stepsUpdated {
+					serveStepResults = append(serveStepResults, serveStepResult(val))
 
-				var stepsUpdated []models.ServeRecipeStep
-				var serveStepsUpdated []models.ServeStep
-				err = helpers.DB.Model(&serveStepsUpdated).
-					Select("serve_steps.*", "recipe_steps.step_order", "recipe_steps.description").
-					Joins("INNER JOIN recipe_steps ON serve_steps.recipe_step_id = recipe_steps.id").
-					Where(models.ServeStep{ServeID: serve.ID}).
-					Find(&stepsUpdated).
-					Order("step_order asc").Error
-				fmt.Println(stepsUpdated)
-
-				if err != nil {
-					c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(recipe.ID) + " has no steps"})
-					return
-				} else {
-					var serveStepResults []models.ServeStepResult
-
-					var undoneCount = 0
-					for _, val := range stepsUpdated {
-						serveStepResults = append(serveStepResults, models.ServeStepResult{
-							StepOrder:   val.StepOrder,
-							Description: val.Description,
-							Done:        val.Done,
-						})
-
-						if !val.Done {
-							undoneCount++
-						}
+					if !val.Done {
+						undoneCount++
 					}
+				}
 
-					var recipeCategory models.RecipeCategory
-					recipeCategory.ID = recipe.RecipeCategoryId
-					helpers.DB.Model(&recipeCategory).Where(models.RecipeCategory{ID: recipe.RecipeCategoryId}).First(&recipeCategory)
-
-					nStep := float64(len(stepsUpdated))
-					nStepDone := float64(len(stepsUpdated) - undoneCount)
-					var status string
-					if nStepDone >= nStep {
-						status = "done"
-					} else {
-						status = "progress"
+				var recipeCategory models.RecipeCategory
+				recipeCategory.ID = recipe.RecipeCategoryId
+				helpers.DB.Model(&recipeCategory).Where(models.RecipeCategory{ID: recipe.RecipeCategoryId}).First(&recipeCategory)
+
+				nStep := float64(len(stepsUpdated))
+				nStepDone := float64(len(stepsUpdated) - undoneCount)
+
+				result := models.ServeResult201{
+					ID:                 serve.ID,
+					UserID:             serve.UserID,
+					RecipeID:           serve.RecipeID,
+					RecipeRevision:     serve.RecipeRevision,
+					RecipeName:         recipe.Name,
+					RecipeCategoryName: recipeCategory.Name,
+					RecipeImage:        recipeImageURL(recipe),
+					RecipeCategoryId:   recipe.RecipeCategoryId,
+					NServing:           serve.NServing,
+					NStep:              nStep,
+					NStepDone:          nStepDone,
+					Reaction:           serve.Reaction,
+					Steps:              serveStepResults,
+					Status:             models.ServeStatus(serve.State),
+					State:              serve.State,
+					CreatedAt:          serve.CreatedAt,
+					UpdatedAt:          serve.UpdatedAt,
+				}
+				for idx := range serveStepResults {
+					switch {
+					case serveStepResults[idx].StepOrder == serveUpdatestep.StepOrder:
+						publishServeEvent(models.ServeEvent{Type: models.SERVE_EVENT_STEP_DONE, ServeID: serve.ID, Step: &serveStepResults[idx], Serve: &result})
+					case next != nil && serveStepResults[idx].StepOrder == next.StepOrder:
+						publishServeEvent(models.ServeEvent{Type: models.SERVE_EVENT_STEP_STARTED, ServeID: serve.ID, Step: &serveStepResults[idx], Serve: &result})
+						scheduleServeStepTimer(serve, serveStepResults[idx])
 					}
-
-					c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.ServeResult201{
-						ID:                 serve.ID,
-						UserID:             serve.UserID,
-						RecipeID:           serve.RecipeID,
-						RecipeName:         recipe.Name,
-						RecipeCategoryName: recipeCategory.Name,
-						RecipeImage:        recipe.Image,
-						RecipeCategoryId:   recipe.RecipeCategoryId,
-						NServing:           serve.NServing,
-						NStep:              nStep,
-						NStepDone:          nStepDone,
-						Reaction:           serve.Reaction,
-						Steps:              serveStepResults,
-						Status:             status,
-						CreatedAt:          serve.CreatedAt,
-						UpdatedAt:          serve.UpdatedAt,
-					}})
 				}
 
+				c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
 			}
 
 		}
@@ -295,27 +358,154 @@ func ServeEditStepByServeID(c *gin.Context) {
 
 }
 
-func ServeGetByServeID(c *gin.Context) {
-	var serve_id = c.Param("serve_id")
-	serve_id_uint64, _ := strconv.ParseUint(serve_id, 10, 64)
+// ServeStartStepByServeID godoc
+// @Summary Start the timer of a step
+// @Description A step starts on its own when the step before is done, starting it again restarts its timer. Steps with a passive part may be started ahead, e.g. to marinate while cooking on.
+// @Tags serve
+// @Accept  json
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Param stepOrder body models.ServeUpdateStep true "stepOrder"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
+// @Failure 400 {object} models.ResponseError{error=models.ServeError400}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /serve-histories/{serve_id}/start-step [put]
+func ServeStartStepByServeID(c *gin.Context) {
+	var serveUpdatestep models.ServeUpdateStep
+
+	if ok, errors := helpers.ValidateServe(c, &serveUpdatestep); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	serve, ok := ownedServe(c)
+	if !ok {
+		return
+	}
+
+	if !serveInProgress(c, serve) {
+		return
+	}
 
-	tokenAuth, err := helpers.ExtractTokenMetadata(c.Request)
+	var recipe models.Recipe
+	if err := helpers.DB.Model(&recipe).Where("ID = ?", serve.RecipeID).First(&recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(serve.RecipeID) + " not found"})
+		return
+	}
+
+	steps, err := serveRecipeSteps(serve)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	var serve = models.Serve{
-		ID: uint(serve_id_uint64),
+	var started *models.ServeRecipeStep
+	for idx := range steps {
+		if steps[idx].StepOrder == serveUpdatestep.StepOrder {
+			started = &steps[idx]
+		}
+	}
+	if started == nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Step " + fmt.Sprint(serveUpdatestep.StepOrder) + " not found"})
+		return
+	}
+	if started.Done {
+		c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: "Step " + fmt.Sprint(serveUpdatestep.StepOrder) + " is done already"})
+		return
 	}
 
-	if err := helpers.DB.Model(serve).Where("ID = ?", serve_id).First(&serve).Error; err != nil {
-		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Serve history with id " + fmt.Sprint(serve_id) + " not found"})
+	now := helpers.DB.NowFunc()
+	err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ServeStep{ID: started.ID}).Update("started_at", now).Error; err != nil {
+			return err
+		}
+		if err := models.LogServe(tx, models.NewServeStepLog(serve.ID, models.SERVE_EVENT_STEP_STARTED, started.StepOrder, now)); err != nil {
+			return err
+		}
+		return models.TouchServe(tx, &serve, now)
+	})
+	if err != nil {
+		if serveStateConflict(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Failed to update"})
 		return
 	}
+	started.StartedAt = &now
+
+	pinServeRevision(serve, &recipe)
+
+	var serveStepResults []models.ServeStepResult
+	nStepDone := 0
+	for _, val := range steps {
+		serveStepResults = append(serveStepResults, serveStepResult(val))
+		if val.Done {
+			nStepDone++
+		}
+	}
+
+	var recipeCategory models.RecipeCategory
+	helpers.DB.Model(&recipeCategory).Where(models.RecipeCategory{ID: recipe.RecipeCategoryId}).First(&recipeCategory)
+
+	result := models.ServeResult201{
+		ID:                 serve.ID,
+		UserID:             serve.UserID,
+		RecipeID:           serve.RecipeID,
+		RecipeRevision:     serve.RecipeRevision,
+		RecipeName:         recipe.Name,
+		RecipeCategoryName: recipeCategory.Name,
+		RecipeImage:        recipeImageURL(recipe),
+		RecipeCategoryId:   recipe.RecipeCategoryId,
+		NServing:           serve.NServing,
+		NStep:              float64(len(steps)),
+		NStepDone:          float64(nStepDone),
+		Reaction:           serve.Reaction,
+		Steps:              serveStepResults,
+		Status:             models.ServeStatus(serve.State),
+		State:              serve.State,
+		CreatedAt:          serve.CreatedAt,
+		UpdatedAt:          serve.UpdatedAt,
+	}
+	for idx := range serveStepResults {
+		if serveStepResults[idx].StepOrder == started.StepOrder {
+			publishServeEvent(models.ServeEvent{Type: models.SERVE_EVENT_STEP_STARTED, ServeID: serve.ID, Step: &serveStepResults[idx], Serve: &result})
+			scheduleServeStepTimer(serve, serveStepResults[idx])
+		}
+	}
 
-	if tokenAuth.UserId != uint64(serve.UserID) {
-		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+}
+
+// ServeGetByServeID godoc
+// @Summary Get a serve history
+// @Description Only the cook and admins see a history, for anyone else it is not found.
+// @Tags serve
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Router /serve-histories/{serve_id} [get]
+func ServeGetByServeID(c *gin.Context) {
+	serve, ok := visibleServe(c)
+	if !ok {
 		return
 	}
 
@@ -328,29 +518,20 @@ func ServeGetByServeID(c *gin.Context) {
 		return
 	}
 
-	var stepsUpdated []models.ServeRecipeStep
-	var serveStepsUpdated []models.ServeStep
-	err = helpers.DB.Model(&serveStepsUpdated).
-		Select("serve_steps.*", "recipe_steps.step_order", "recipe_steps.description").
-		Joins("INNER JOIN recipe_steps ON serve_steps.recipe_step_id = recipe_steps.id").
-		Where(models.ServeStep{ServeID: serve.ID}).
-		Find(&stepsUpdated).
-		Order("step_order asc").Error
+	stepsUpdated, err := serveRecipeSteps(serve)
 	fmt.Println(stepsUpdated)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(recipe.ID) + " has no steps"})
 		return
 	} else {
+		pinServeRevision(serve, &recipe)
+
 		var serveStepResults []models.ServeStepResult
 
 		var undoneCount = 0
 		for _, val := range stepsUpdated {
-			serveStepResults = append(serveStepResults, models.ServeStepResult{
-				StepOrder:   val.StepOrder,
-				Description: val.Description,
-				Done:        val.Done,
-			})
+			serveStepResults = append(serveStepResults, serveStepResult(val))
 
 			if !val.Done {
 				undoneCount++
@@ -363,179 +544,277 @@ func ServeGetByServeID(c *gin.Context) {
 
 		nStep := float64(len(stepsUpdated))
 		nStepDone := float64(len(stepsUpdated) - undoneCount)
-		var status string
-		if nStepDone >= nStep {
-			if serve.Reaction == models.ReactionUnknown {
-				status = "need-rating"
-			} else {
-				status = "done"
-			}
-		} else {
-			status = "progress"
-		}
 
 		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.ServeResult201{
 			ID:                 serve.ID,
 			UserID:             serve.UserID,
 			RecipeID:           serve.RecipeID,
+			RecipeRevision:     serve.RecipeRevision,
 			RecipeName:         recipe.Name,
 			RecipeCategoryName: recipeCategory.Name,
-			RecipeImage:        recipe.Image,
+			RecipeImage:        recipeImageURL(recipe),
 			RecipeCategoryId:   recipe.RecipeCategoryId,
 			NServing:           serve.NServing,
 			NStep:              nStep,
 			NStepDone:          nStepDone,
 			Reaction:           serve.Reaction,
 			Steps:              serveStepResults,
-			Status:             status,
+			Status:             models.ServeStatus(serve.State),
+			State:              serve.State,
+			Review:             serveReviewResult(serve.ID),
 			CreatedAt:          serve.CreatedAt,
 			UpdatedAt:          serve.UpdatedAt,
 		}})
 	}
 }
 
+// ServeGetAll godoc
+// @Summary List serve histories
+// @Description Histories of the caller. With limit the response has nextCursor and prevCursor, also given as links in the Link header.
+// @Tags serve
+// @Produce  json
+// @Param q query string false "part of the recipe name"
+// @Param categoryId query int false "category of the recipe"
+// @Param status query string false "in-progress, paused, abandoned, completed or rated, comma separated for several. progress (in-progress or paused), need-rating (completed) and done (rated) still work."
+// @Param sort query string false "newest (default), oldest, nserve_asc or nserve_desc"
+// @Param limit query int false "histories per page, all without"
+// @Param cursor query string false "nextCursor or prevCursor of the previous response"
+// @Param skip query int false "skip, prefer cursor"
+// @Param userId query string false "admins only, histories of this user or all for every user"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeListResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Router /serve-histories [get]
 func ServeGetAll(c *gin.Context) {
-	var skip = c.Query("skip")
-	var limit = c.Query("limit")
-	var sort = c.Query("sort")
 	var q = c.Query("q")
 	var statusFilter = c.Query("status")
 	var categoryId = c.Query("categoryId")
+	var userId = c.Query("userId")
 
-	var serves []models.Serve
-	var servesResult []models.ServeResultGetAll
-	var servesResultFiltered []models.ServeResultGetAll
-
-	query := helpers.DB.Model(&serves).
-		Select(
-			"serves.id as id", "serves.n_serving as n_serving", "serves.reaction as reaction", "serves.created_at as created_at", "serves.updated_at as updated_at",
-			"recipes.id as recipe_id", "recipes.name as recipe_name", "recipes.image as recipe_image", "recipes.recipe_category_id as recipe_category_id",
-			"recipe_categories.name as recipe_category_name",
-		).
-		Joins("INNER JOIN recipes ON serves.recipe_id = recipes.id").
-		Joins("INNER JOIN recipe_categories ON recipes.recipe_category_id = recipe_categories.id")
-
-	categoryId_uint64, _ := strconv.ParseUint(categoryId, 10, 64)
-	if categoryId_uint64 > 0 {
-		query.Where("recipes.recipe_category_id", categoryId_uint64)
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		return
 	}
 
-	if q != "" {
-		query.Where("recipes.name LIKE ?", "%"+q+"%")
+	// other users cook in private, only admins look across them
+	var userId_uint64 = tokenAuth.UserId
+	if userId != "" && userId != fmt.Sprint(tokenAuth.UserId) {
+		if !tokenAuth.IsAdmin() {
+			c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+			return
+		}
+		userId_uint64, _ = strconv.ParseUint(userId, 10, 64)
+		if userId_uint64 == 0 && userId != "all" {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "userId is invalid"})
+			return
+		}
 	}
 
-	if sort != "" {
-		//newest|oldest|nserve_asc|nserve_desc
-		s := strings.Split(sort, "_")
+	page, err := helpers.ParsePagination(c, serveSorts, "newest")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
 
-		if s[0] != "" {
-			if s[0] == "nserve" {
-				s[0] = "serves.n_serving"
-				query.Order(s[0] + " " + s[1])
-			} else {
-				s[0] = "created_at"
-				if s[0] == "oldest" {
-					query.Order(s[0] + " desc")
-				} else {
-					query.Order(s[0] + " asc")
-				}
+	var states []string
+	if statusFilter != "" {
+		for _, status := range strings.Split(statusFilter, ",") {
+			statusStates := models.ServeStatusStates(strings.TrimSpace(status))
+			if statusStates == nil {
+				c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "status " + status + " is invalid"})
+				return
 			}
+			states = append(states, statusStates...)
 		}
+	}
 
+	categoryId_uint64, _ := strconv.ParseUint(categoryId, 10, 64)
+	filter := func(query *gorm.DB) *gorm.DB {
+		query = query.
+			Joins("INNER JOIN recipes ON serves.recipe_id = recipes.id").
+			Joins("INNER JOIN recipe_categories ON recipes.recipe_category_id = recipe_categories.id")
+		if userId_uint64 > 0 {
+			query = query.Where("serves.user_id = ?", userId_uint64)
+		}
+		if categoryId_uint64 > 0 {
+			query = query.Where("recipes.recipe_category_id", categoryId_uint64)
+		}
+		if q != "" {
+			query = query.Where("recipes.name LIKE ?", "%"+q+"%")
+		}
+		if states != nil {
+			query = query.Where("serves.state IN ?", states)
+		}
+		return query
 	}
 
-	if limit != "" {
-		limit_uint64, _ := strconv.ParseInt(limit, 10, 64)
-		query.Limit(int(limit_uint64))
+	var serves []models.Serve
+	var servesResult []models.ServeResultGetAll
+
+	var total int64
+	if err := filter(helpers.DB.Model(&serves)).Count(&total).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
 
-	if skip != "" {
-		skip_uint64, _ := strconv.ParseInt(skip, 10, 64)
-		query.Offset(int(skip_uint64))
+	query := filter(helpers.DB.Model(&serves)).
+		Select(
+			"serves.id as id", "serves.user_id as user_id", "serves.recipe_revision as recipe_revision", "serves.n_serving as n_serving", "serves.reaction as reaction", "serves.state as state", "serves.created_at as created_at", "serves.updated_at as updated_at",
+			"recipes.id as recipe_id", "recipes.name as recipe_name", "recipes.image as recipe_image", "recipes.recipe_category_id as recipe_category_id",
+			"recipe_categories.name as recipe_category_name",
+		)
+
+	query, err = page.Apply(query, "serves.id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
 	}
 
 	query.Find(&servesResult)
 
 	fmt.Println(servesResult)
 
+	cursors := page.Finish(c, &servesResult, func(i int) (interface{}, uint) {
+		if page.Sort == "nserve_asc" || page.Sort == "nserve_desc" {
+			return servesResult[i].NServing, servesResult[i].ID
+		}
+		return servesResult[i].CreatedAt, servesResult[i].ID
+	})
+
 	if query.Error != nil {
 		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe not found"})
 		return
 	} else {
-		for idx, serveResult := range servesResult {
-			var steps []models.ServeRecipeStep
-			var serveSteps []models.ServeStep
+		if err := fillServeListResults(servesResult); err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
 
-			err := helpers.DB.Model(&serveSteps).
-				Select("serve_steps.*", "recipe_steps.step_order", "recipe_steps.description").
-				Joins("INNER JOIN recipe_steps ON serve_steps.recipe_step_id = recipe_steps.id").
-				Where(models.ServeStep{ServeID: serveResult.ID}).
-				Find(&steps).
-				Order("step_order asc").Error
-			if err != nil {
-				c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Serve history with id " + fmt.Sprint(serveResult.ID) + " has no steps"})
-				return
-			} else {
-				var recipe = models.Recipe{
-					ID: serveResult.RecipeID,
-				}
+		data := models.ServeListResult{
+			Total:       int(total),
+			History:     servesResult,
+			PageCursors: cursors,
+		}
 
-				if err := helpers.DB.Model(recipe).Where("ID = ?", serveResult.RecipeID).First(&recipe).Error; err != nil {
-					c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(serveResult.RecipeID) + " not found"})
-					return
-				}
+		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: data})
+		return
+	}
+}
 
-				var nStep = len(steps)
-				var nStepDone = 0
+// fillServeListResults : step counts, status and the recipe name and image as cooked for a page
+// of serve histories, with one query for the steps, one for the recipes and one for the pinned
+// revisions of the whole page
+func fillServeListResults(servesResult []models.ServeResultGetAll) error {
+	if len(servesResult) == 0 {
+		return nil
+	}
 
-				for _, val := range steps {
-					if val.Done {
-						nStepDone++
-					}
-				}
+	serveIds := make([]uint, 0, len(servesResult))
+	recipeIds := make([]uint, 0, len(servesResult))
+	pinned := make([][]interface{}, 0, len(servesResult))
+	for _, serveResult := range servesResult {
+		serveIds = append(serveIds, serveResult.ID)
+		recipeIds = append(recipeIds, serveResult.RecipeID)
+		if serveResult.RecipeRevision > 0 {
+			pinned = append(pinned, []interface{}{serveResult.RecipeID, serveResult.RecipeRevision})
+		}
+	}
 
-				status := ""
-				if nStepDone >= nStep {
-					if serveResult.Reaction == models.ReactionUnknown {
-						status = "need-rating"
-					} else {
-						status = "done"
-					}
-				} else {
-					status = "progress"
-				}
+	var stepCounts []struct {
+		ServeID   uint
+		NStep     int
+		NStepDone int
+	}
+	err := helpers.DB.Model(&models.ServeStep{}).
+		Select("serve_id, COUNT(*) AS n_step, COALESCE(SUM(done), 0) AS n_step_done").
+		Where("serve_id IN ?", serveIds).
+		Group("serve_id").
+		Find(&stepCounts).Error
+	if err != nil {
+		return err
+	}
 
-				servesResult[idx].NStep = float64(nStep)
-				servesResult[idx].NStepDone = float64(nStepDone)
-				servesResult[idx].Status = status
+	var recipes []models.Recipe
+	if err := helpers.DB.Select("id", "name", "image", "image_key", "revision").Where("id IN ?", recipeIds).Find(&recipes).Error; err != nil {
+		return err
+	}
 
-				if statusFilter != "" {
-					if statusFilter == status {
-						servesResultFiltered = append(servesResultFiltered, servesResult[idx])
-					}
-				} else {
-					servesResultFiltered = append(servesResultFiltered, servesResult[idx])
-				}
-			}
+	var revisions []models.RecipeRevision
+	if len(pinned) > 0 {
+		err := helpers.DB.Select("recipe_id", "revision", "name", "image", "image_key").Where("(recipe_id, revision) IN ?", pinned).Find(&revisions).Error
+		if err != nil {
+			return err
 		}
+	}
+
+	countsByServe := make(map[uint]int)
+	for idx, count := range stepCounts {
+		countsByServe[count.ServeID] = idx
+	}
+	recipesById := make(map[uint]models.Recipe)
+	for _, recipe := range recipes {
+		recipesById[recipe.ID] = recipe
+	}
+	type revisionKey struct {
+		recipeID uint
+		revision int
+	}
+	revisionsByKey := make(map[revisionKey]models.RecipeRevision)
+	for _, revision := range revisions {
+		revisionsByKey[revisionKey{revision.RecipeID, revision.Revision}] = revision
+	}
 
-		data := struct {
-			Total   int                        `json:"total"`
-			History []models.ServeResultGetAll `json:"history"`
-		}{
-			Total:   len(servesResultFiltered),
-			History: servesResultFiltered,
+	for idx := range servesResult {
+		servesResult[idx].Status = models.ServeStatus(servesResult[idx].State)
+		if countIdx, ok := countsByServe[servesResult[idx].ID]; ok {
+			servesResult[idx].NStep = float64(stepCounts[countIdx].NStep)
+			servesResult[idx].NStepDone = float64(stepCounts[countIdx].NStepDone)
 		}
 
-		c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: data})
-		return
+		recipe, ok := recipesById[servesResult[idx].RecipeID]
+		if !ok {
+			continue
+		}
+		if servesResult[idx].RecipeRevision != recipe.Revision {
+			if revision, ok := revisionsByKey[revisionKey{recipe.ID, servesResult[idx].RecipeRevision}]; ok {
+				pinRecipeRevision(&recipe, revision)
+			}
+		}
+		servesResult[idx].RecipeName = recipe.Name
+		servesResult[idx].RecipeImage = recipeImageURL(recipe)
 	}
+	return nil
 }
 
-func ServeCreateReactionByServeID(c *gin.Context) {
-	var serve_id = c.Param("serve_id")
-	serve_id_uint64, _ := strconv.ParseUint(serve_id, 10, 64)
+var serveSorts = map[string]helpers.SortField{
+	"newest":      {Column: "serves.created_at", Desc: true, Time: true},
+	"oldest":      {Column: "serves.created_at", Time: true},
+	"nserve_asc":  {Column: "serves.n_serving"},
+	"nserve_desc": {Column: "serves.n_serving", Desc: true},
+}
 
+// ServeCreateReactionByServeID godoc
+// @Summary React to a finished serve history
+// @Description like, neutral or dislike once every step is done. Posting another reaction changes it, the counters of the recipe follow.
+// @Tags serve
+// @Accept  json
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Param reaction body models.ServeUpdateReaction true "reaction"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 406 {object} models.ResponseError{error=string}
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /serve-histories/{serve_id}/reaction [post]
+func ServeCreateReactionByServeID(c *gin.Context) {
 	var serveUpdateReaction models.ServeUpdateReaction
 	if ok, errors := helpers.ValidateServe(c, &serveUpdateReaction); !ok {
 		if _, ok := errors.(gin.H); !ok {
@@ -558,34 +837,12 @@ func ServeCreateReactionByServeID(c *gin.Context) {
 		return
 	}
 
-	tokenAuth, err := helpers.ExtractTokenMetadata(c.Request)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
-		return
-	}
-
-	var serve = models.Serve{
-		ID: uint(serve_id_uint64),
-	}
-
-	if err := helpers.DB.Model(serve).Where("ID = ?", serve_id).First(&serve).Error; err != nil {
-		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Serve history with id " + fmt.Sprint(serve_id) + " not found"})
+	serve, ok := ownedServe(c)
+	if !ok {
 		return
 	}
 
-	if tokenAuth.UserId != uint64(serve.UserID) {
-		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
-		return
-	}
-
-	var steps []models.ServeRecipeStep
-	var serveSteps []models.ServeStep
-	err = helpers.DB.Model(&serveSteps).
-		Select("serve_steps.*", "recipe_steps.step_order", "recipe_steps.description").
-		Joins("INNER JOIN recipe_steps ON serve_steps.recipe_step_id = recipe_steps.id").
-		Where(models.ServeStep{ServeID: serve.ID}).
-		Find(&steps).
-		Order("step_order asc").Error
+	steps, err := serveRecipeSteps(serve)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Serve history with id " + fmt.Sprint(serve.ID) + " has no steps"})
 		return
@@ -599,6 +856,8 @@ func ServeCreateReactionByServeID(c *gin.Context) {
 			return
 		}
 
+		pinServeRevision(serve, &recipe)
+
 		var serveStepResults []models.ServeStepResult
 		for _, val := range steps {
 			if !val.Done {
@@ -606,41 +865,407 @@ func ServeCreateReactionByServeID(c *gin.Context) {
 				return
 			}
 
-			serveStepResults = append(serveStepResults, models.ServeStepResult{
-				StepOrder:   val.StepOrder,
-				Description: val.Description,
-				Done:        val.Done,
-			})
+			serveStepResults = append(serveStepResults, serveStepResult(val))
 
 		}
 
-		serve.Reaction = models.GetReactionId(serveUpdateReaction.Reaction)
-		if err := helpers.DB.Save(&serve).Error; err != nil {
+		if err := models.SetServeReaction(helpers.DB, &serve, models.GetReactionId(serveUpdateReaction.Reaction)); err != nil {
+			if serveStateConflict(c, err) {
+				return
+			}
 			c.AbortWithStatus(http.StatusInternalServerError)
 		} else {
 			var recipeCategory models.RecipeCategory
 			recipeCategory.ID = recipe.RecipeCategoryId
 			helpers.DB.Model(&recipeCategory).Where(models.RecipeCategory{ID: recipe.RecipeCategoryId}).First(&recipeCategory)
 
-			c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.ServeResult201{
+			result := models.ServeResult201{
 				ID:                 serve.ID,
 				UserID:             serve.UserID,
 				RecipeID:           serve.RecipeID,
+				RecipeRevision:     serve.RecipeRevision,
 				RecipeName:         recipe.Name,
 				RecipeCategoryName: recipeCategory.Name,
-				RecipeImage:        recipe.Image,
+				RecipeImage:        recipeImageURL(recipe),
 				RecipeCategoryId:   recipe.RecipeCategoryId,
 				NServing:           serve.NServing,
-				NStep:              float64(len(serveSteps)),
-				NStepDone:          float64(len(serveSteps)),
+				NStep:              float64(len(steps)),
+				NStepDone:          float64(len(steps)),
+				Reaction:           serve.Reaction,
 				Steps:              serveStepResults,
-				Status:             "done",
+				Status:             models.ServeStatus(serve.State),
+				State:              serve.State,
 				CreatedAt:          serve.CreatedAt,
 				UpdatedAt:          serve.UpdatedAt,
-			}})
+			}
+			publishServeEvent(models.ServeEvent{Type: models.SERVE_EVENT_REACTION, ServeID: serve.ID, Reaction: serve.Reaction.String(), Serve: &result})
+
+			c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+
+		}
+
+	}
+
+}
+
+// ServeUndoStepByServeID godoc
+// @Summary Undo a step marked done by mistake
+// @Description Steps are undone in the reverse order they were done, only the last step done can be undone. A step that started
+// @Description on its own when the undone step was done has not started after all. Remove the reaction of a rated serve history first,
+// @Description a completed serve history is in progress again.
+// @Tags serve
+// @Accept  json
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Param stepOrder body models.ServeUpdateStep true "stepOrder"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
+// @Failure 400 {object} models.ResponseError{error=models.ServeError400}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /serve-histories/{serve_id}/undo-step [put]
+func ServeUndoStepByServeID(c *gin.Context) {
+	var serveUpdatestep models.ServeUpdateStep
+
+	if ok, errors := helpers.ValidateServe(c, &serveUpdatestep); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	serve, ok := ownedServe(c)
+	if !ok {
+		return
+	}
+
+	var recipe models.Recipe
+	if err := helpers.DB.Model(&recipe).Where("ID = ?", serve.RecipeID).First(&recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(serve.RecipeID) + " not found"})
+		return
+	}
+
+	steps, err := serveRecipeSteps(serve)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var undone *models.ServeRecipeStep
+	for idx := range steps {
+		if steps[idx].StepOrder == serveUpdatestep.StepOrder {
+			undone = &steps[idx]
+		}
+	}
+	if undone == nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Step " + fmt.Sprint(serveUpdatestep.StepOrder) + " not found"})
+		return
+	}
+
+	now := helpers.DB.NowFunc()
+	err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockServeSteps(tx, &serve, steps); err != nil {
+			return err
+		}
+		if !undone.Done {
+			return serveConflict("Step " + fmt.Sprint(serveUpdatestep.StepOrder) + " is not done")
+		}
+		for _, val := range steps {
+			if val.StepOrder > serveUpdatestep.StepOrder && val.Done {
+				return serveConflict("Some steps after " + fmt.Sprint(serveUpdatestep.StepOrder) + " are done, undo them first")
+			}
+		}
+		if serve.Reaction != models.ReactionUnknown {
+			return serveConflict("Serve history is rated already, remove the reaction first")
+		}
+		if serve.State != models.SERVE_STATE_COMPLETED && serve.State != models.SERVE_STATE_IN_PROGRESS {
+			return serveConflict("Serve history is " + serve.State + ", its steps can not change")
+		}
+
+		err := tx.Model(&models.ServeStep{ID: undone.ID}).Updates(map[string]interface{}{
+			"done":    false,
+			"done_at": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		logs := []models.ServeLog{models.NewServeStepLog(serve.ID, models.SERVE_EVENT_STEP_UNDONE, undone.StepOrder, now)}
+
+		for idx := range steps {
+			step := &steps[idx]
+			if step.StepOrder <= undone.StepOrder || step.StartedAt == nil || undone.DoneAt == nil || step.StartedAt.Before(*undone.DoneAt) {
+				continue
+			}
+			if err := tx.Model(&models.ServeStep{ID: step.ID}).Update("started_at", nil).Error; err != nil {
+				return err
+			}
+			step.StartedAt = nil
+			logs = append(logs, models.NewServeStepLog(serve.ID, models.SERVE_LOG_STEP_RESET, step.StepOrder, now))
+		}
+		if err := models.LogServe(tx, logs...); err != nil {
+			return err
+		}
+		if serve.State == models.SERVE_STATE_COMPLETED {
+			return models.TransitionServe(tx, &serve, models.SERVE_STATE_IN_PROGRESS, now)
+		}
+		return models.TouchServe(tx, &serve, now)
+	})
+	if err != nil {
+		if serveStateConflict(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Failed to update"})
+		return
+	}
+	undone.Done = false
+	undone.DoneAt = nil
+
+	pinServeRevision(serve, &recipe)
+	result := serveResult(serve, recipe, steps)
+	for idx := range result.Steps {
+		if result.Steps[idx].StepOrder == undone.StepOrder {
+			publishServeEvent(models.ServeEvent{Type: models.SERVE_EVENT_STEP_UNDONE, ServeID: serve.ID, Step: &result.Steps[idx], Serve: &result})
+		}
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+}
+
+// ServeDeleteReactionByServeID godoc
+// @Summary Remove the reaction of a serve history
+// @Description The reaction is taken off the counters of the recipe and the serve history needs a rating again. To change a reaction post the new one instead.
+// @Description A review of the serve history leaves the reviews of the recipe until the serve history is rated again.
+// @Tags serve
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /serve-histories/{serve_id}/reaction [delete]
+func ServeDeleteReactionByServeID(c *gin.Context) {
+	serve, ok := ownedServe(c)
+	if !ok {
+		return
+	}
+
+	var recipe models.Recipe
+	if err := helpers.DB.Model(&recipe).Where("ID = ?", serve.RecipeID).First(&recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(serve.RecipeID) + " not found"})
+		return
+	}
+
+	steps, err := serveRecipeSteps(serve)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := models.SetServeReaction(helpers.DB, &serve, models.ReactionUnknown); err != nil {
+		if serveStateConflict(c, err) {
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	pinServeRevision(serve, &recipe)
+	result := serveResult(serve, recipe, steps)
+	publishServeEvent(models.ServeEvent{Type: models.SERVE_EVENT_REACTION, ServeID: serve.ID, Serve: &result})
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+}
+
+// ServeLogGetByServeID godoc
+// @Summary Log of a serve history
+// @Description Every change of the serve history in the order it happened: created, step-started, step-done, step-undone, step-reset (a step that started on its own was undone with the step before), reaction and state.
+// @Tags serve
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=[]models.ServeLog}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 500
+// @Router /serve-histories/{serve_id}/log [get]
+func ServeLogGetByServeID(c *gin.Context) {
+	serve, ok := visibleServe(c)
+	if !ok {
+		return
+	}
+
+	logs := []models.ServeLog{}
+	if err := helpers.DB.Where(models.ServeLog{ServeID: serve.ID}).Order("id asc").Find(&logs).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: logs})
+}
+
+// serveResult : serve history with its steps
+func serveResult(serve models.Serve, recipe models.Recipe, steps []models.ServeRecipeStep) models.ServeResult201 {
+	serveStepResults := []models.ServeStepResult{}
+	nStepDone := 0
+	for _, val := range steps {
+		serveStepResults = append(serveStepResults, serveStepResult(val))
+		if val.Done {
+			nStepDone++
+		}
+	}
+
+	var recipeCategory models.RecipeCategory
+	helpers.DB.Model(&recipeCategory).Where(models.RecipeCategory{ID: recipe.RecipeCategoryId}).First(&recipeCategory)
+
+	return models.ServeResult201{
+		ID:                 serve.ID,
+		UserID:             serve.UserID,
+		RecipeID:           serve.RecipeID,
+		RecipeRevision:     serve.RecipeRevision,
+		RecipeName:         recipe.Name,
+		RecipeCategoryName: recipeCategory.Name,
+		RecipeImage:        recipeImageURL(recipe),
+		RecipeCategoryId:   recipe.RecipeCategoryId,
+		NServing:           serve.NServing,
+		NStep:              float64(len(steps)),
+		NStepDone:          float64(nStepDone),
+		Reaction:           serve.Reaction,
+		Steps:              serveStepResults,
+		Status:             models.ServeStatus(serve.State),
+		State:              serve.State,
+		CreatedAt:          serve.CreatedAt,
+		UpdatedAt:          serve.UpdatedAt,
+	}
+}
+
+// pinServeRevision : show the recipe name and image as they were in the revision that was
+// cooked, rather than what the recipe has become since
+func pinServeRevision(serve models.Serve, recipe *models.Recipe) {
+	if serve.RecipeRevision == 0 || serve.RecipeRevision == recipe.Revision {
+		return
+	}
+
+	var revision models.RecipeRevision
+	err := helpers.DB.Where(models.RecipeRevision{RecipeID: serve.RecipeID, Revision: serve.RecipeRevision}).First(&revision).Error
+	if err != nil {
+		return
+	}
+	pinRecipeRevision(recipe, revision)
+}
+
+func pinRecipeRevision(recipe *models.Recipe, revision models.RecipeRevision) {
+	recipe.Name = revision.Name
+	recipe.Image = revision.Image
+	recipe.ImageKey = revision.ImageKey
+}
 
+// serveRecipeSteps : the steps of a serve in their order, described and timed as in the
+// revision that was cooked. Edits to the recipe since do not change them.
+func serveRecipeSteps(serve models.Serve) ([]models.ServeRecipeStep, error) {
+	var steps []models.ServeRecipeStep
+	err := helpers.DB.Model(&models.ServeStep{}).
+		Select("serve_steps.*", "recipe_steps.step_order", "recipe_steps.description", "recipe_steps.active_seconds", "recipe_steps.passive_seconds").
+		Joins("INNER JOIN recipe_steps ON serve_steps.recipe_step_id = recipe_steps.id").
+		Where(models.ServeStep{ServeID: serve.ID}).
+		Order("recipe_steps.step_order asc").
+		Find(&steps).Error
+	if err != nil || serve.RecipeRevision == 0 {
+		return steps, err
+	}
+
+	var revision models.RecipeRevision
+	err = helpers.DB.Where(models.RecipeRevision{RecipeID: serve.RecipeID, Revision: serve.RecipeRevision}).Limit(1).Find(&revision).Error
+	if err != nil {
+		return nil, err
+	}
+	for idx := range steps {
+		if step, ok := revision.Step(steps[idx].StepOrder); ok {
+			steps[idx].Description = step.Description
+			steps[idx].ActiveSeconds = step.ActiveSeconds
+			steps[idx].PassiveSeconds = step.PassiveSeconds
+		}
+	}
+	return steps, nil
+}
+
+// startNextServeStep : the step after the one just done starts now, unless it was started
+// before. The step started is returned, nil when none was.
+func startNextServeStep(tx *gorm.DB, steps []models.ServeRecipeStep, doneOrder int, now time.Time) (*models.ServeRecipeStep, error) {
+	var next *models.ServeRecipeStep
+	for idx := range steps {
+		if steps[idx].StepOrder > doneOrder && !steps[idx].Done && (next == nil || steps[idx].StepOrder < next.StepOrder) {
+			next = &steps[idx]
 		}
+	}
+	if next == nil || next.StartedAt != nil {
+		return nil, nil
+	}
+	if err := tx.Model(&models.ServeStep{ID: next.ID}).Update("started_at", now).Error; err != nil {
+		return nil, err
+	}
+	next.StartedAt = &now
+	return next, nil
+}
 
+// lockServeSteps : lock serve and its steps until tx ends and bring both up to date, steps
+// done or a reaction given meanwhile from another device are seen after locking
+func lockServeSteps(tx *gorm.DB, serve *models.Serve, steps []models.ServeRecipeStep) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", serve.ID).First(serve).Error; err != nil {
+		return err
 	}
+	var serveSteps []models.ServeStep
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(models.ServeStep{ServeID: serve.ID}).Find(&serveSteps).Error; err != nil {
+		return err
+	}
+	current := make(map[uint]models.ServeStep)
+	for _, serveStep := range serveSteps {
+		current[serveStep.ID] = serveStep
+	}
+	for idx := range steps {
+		if serveStep, ok := current[steps[idx].ID]; ok {
+			steps[idx].Done, steps[idx].StartedAt, steps[idx].DoneAt = serveStep.Done, serveStep.StartedAt, serveStep.DoneAt
+		}
+	}
+	return nil
+}
 
+// serveStepResult : a step of a serve with the time its timer rings, known once the step
+// was started and has a duration
+func serveStepResult(step models.ServeRecipeStep) models.ServeStepResult {
+	result := models.ServeStepResult{
+		StepOrder:      step.StepOrder,
+		Description:    step.Description,
+		Done:           step.Done,
+		ActiveSeconds:  step.ActiveSeconds,
+		PassiveSeconds: step.PassiveSeconds,
+		StartedAt:      step.StartedAt,
+		DoneAt:         step.DoneAt,
+	}
+	if step.StartedAt != nil && (step.ActiveSeconds != nil || step.PassiveSeconds != nil) {
+		seconds := 0
+		if step.ActiveSeconds != nil {
+			seconds += *step.ActiveSeconds
+		}
+		if step.PassiveSeconds != nil {
+			seconds += *step.PassiveSeconds
+		}
+		endsAt := step.StartedAt.Add(time.Duration(seconds) * time.Second)
+		result.EndsAt = &endsAt
+	}
+	return result
 }
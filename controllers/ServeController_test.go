@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/includes"
+	"github.com/nadhirfr/codefood/models"
+	"github.com/twinj/uuid"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBOnce sync.Once
+var testDBErr error
+
+// useTestDB : migrated database in MYSQL_TEST_HOST, MYSQL_TEST_PORT, MYSQL_TEST_USER,
+// MYSQL_TEST_PASSWORD and MYSQL_TEST_DBNAME, the test is skipped without a host
+func useTestDB(t *testing.T) {
+	t.Helper()
+	host := os.Getenv("MYSQL_TEST_HOST")
+	if host == "" {
+		t.Skip("MYSQL_TEST_HOST is not set")
+	}
+	testDBOnce.Do(func() {
+		config := helpers.DBConfig{
+			Host:     host,
+			Port:     os.Getenv("MYSQL_TEST_PORT"),
+			User:     os.Getenv("MYSQL_TEST_USER"),
+			Password: os.Getenv("MYSQL_TEST_PASSWORD"),
+			DBName:   os.Getenv("MYSQL_TEST_DBNAME"),
+		}
+		if config.Port == "" {
+			config.Port = "3306"
+		}
+		helpers.DB, testDBErr = gorm.Open(mysql.New(helpers.DbURL(&config)), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Silent),
+			NowFunc: func() time.Time {
+				return time.Now().Truncate(time.Second)
+			},
+		})
+		if testDBErr == nil && !includes.Migrate() {
+			testDBErr = errors.New("migration failed")
+		}
+		helpers.EVENTS = helpers.NewMemoryEventHub()
+	})
+	if testDBErr != nil {
+		t.Fatal(testDBErr)
+	}
+}
+
+// testRouter : the routes under test, requests are made as the given user, 0 is anonymous
+func testRouter(userID uint) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if userID > 0 {
+			c.Set(helpers.ACCESS_DETAILS_KEY, &helpers.AccessDetails{UserId: uint64(userID), UserRole: helpers.ROLE_PERSONAL})
+		}
+	})
+	r.POST("/recipes", RecipeCreate)
+	r.PUT("/recipes/:recipe_id", RecipeEditByRecipeID)
+	r.PATCH("/recipes/:recipe_id", RecipePatchByRecipeID)
+	r.GET("/recipes/:recipe_id/steps", RecipeStepsGetByRecipeID)
+	r.POST("/serve-histories", ServeCreate)
+	r.GET("/serve-histories/shared/:share_token", ServeSharedGet)
+	r.PUT("/serve-histories/:serve_id/done-step", ServeEditStepByServeID)
+	r.POST("/serve-histories/:serve_id/reaction", ServeCreateReactionByServeID)
+	r.POST("/serve-histories/:serve_id/share", ServeShareCreateByServeID)
+	r.PUT("/serve-histories/:serve_id/review", ServeReviewEditByServeID)
+	return r
+}
+
+// testRequest : send body as JSON, or as is when it is a string, and decode the data of the response
+func testRequest(t *testing.T, r *gin.Engine, method string, path string, contentType string, body interface{}, data interface{}) int {
+	t.Helper()
+	payload, ok := body.(string)
+	if !ok && body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = string(encoded)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if data != nil && w.Code < 300 {
+		result := models.ResponseResult{Data: data}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("%s %s: %v in %s", method, path, err, w.Body)
+		}
+	}
+	return w.Code
+}
+
+// testUser : a new personal user
+func testUser(t *testing.T) models.User {
+	t.Helper()
+	user := models.User{Username: "test-" + uuid.NewV4().String(), Password: "12345678"}
+	if err := helpers.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// testRecipe : a new recipe of user with the given steps
+func testRecipe(t *testing.T, user models.User, steps []models.RecipeStep) models.RecipeResult201 {
+	t.Helper()
+	category := models.RecipeCategory{Name: "Test"}
+	if err := helpers.DB.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var recipe models.RecipeResult201
+	status := testRequest(t, testRouter(user.ID), http.MethodPost, "/recipes", "application/json", models.RecipeCreate{
+		Name:                  "Nasi goreng",
+		RecipeCategoryId:      category.ID,
+		NServing:              1,
+		IngredientsPerServing: []models.RecipeIngridient{{Value: 1, Unit: "piring", Item: "nasi"}},
+		Steps:                 steps,
+	}, &recipe)
+	if status != http.StatusCreated {
+		t.Fatalf("POST /recipes = %d, want %d", status, http.StatusCreated)
+	}
+	return recipe
+}
+
+// testServe : a new serve history of user cooking recipe
+func testServe(t *testing.T, user models.User, recipeID uint) models.ServeResult201 {
+	t.Helper()
+	nServing := 1.0
+	var serve models.ServeResult201
+	status := testRequest(t, testRouter(user.ID), http.MethodPost, "/serve-histories", "application/json", models.ServeCreate{RecipeID: recipeID, NServing: &nServing}, &serve)
+	if status != http.StatusCreated {
+		t.Fatalf("POST /serve-histories = %d, want %d", status, http.StatusCreated)
+	}
+	return serve
+}
+
+func serveStepStates(steps []models.ServeStepResult) string {
+	states := ""
+	for _, step := range steps {
+		state := "todo"
+		if step.Done {
+			state = "done"
+		} else if step.StartedAt != nil {
+			state = "started"
+		}
+		states += fmt.Sprintf("%d:%s:%s ", step.StepOrder, step.Description, state)
+	}
+	return states
+}
+
+func TestServeCreateStartsFirstSteps(t *testing.T) {
+	useTestDB(t)
+	user := testUser(t)
+	recipe := testRecipe(t, user, []models.RecipeStep{
+		{StepOrder: 2, Description: "Tumis bumbu"},
+		{StepOrder: 3, Description: "Masukkan nasi"},
+	})
+
+	// the step inserted in front is stored after the others
+	status := testRequest(t, testRouter(user.ID), http.MethodPut, fmt.Sprintf("/recipes/%d", recipe.ID), "application/json", models.RecipeCreate{
+		Name:                  recipe.Name,
+		RecipeCategoryId:      recipe.RecipeCategoryId,
+		NServing:              recipe.NServing,
+		IngredientsPerServing: recipe.IngredientsPerServing,
+		Steps: []models.RecipeStep{
+			{StepOrder: 1, Description: "Haluskan bumbu"},
+			{StepOrder: 2, Description: "Tumis bumbu"},
+			{StepOrder: 3, Description: "Masukkan nasi"},
+		},
+	}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("PUT /recipes/%d = %d, want %d", recipe.ID, status, http.StatusOK)
+	}
+
+	serve := testServe(t, user, recipe.ID)
+	want := "1:Haluskan bumbu:done 2:Tumis bumbu:started 3:Masukkan nasi:todo "
+	if got := serveStepStates(serve.Steps); got != want {
+		t.Errorf("steps = %q, want %q", got, want)
+	}
+}
+
+func TestServeEditStep(t *testing.T) {
+	useTestDB(t)
+	user := testUser(t)
+	recipe := testRecipe(t, user, []models.RecipeStep{
+		{StepOrder: 1, Description: "Haluskan bumbu"},
+		{StepOrder: 2, Description: "Tumis bumbu"},
+		{StepOrder: 3, Description: "Masukkan nasi"},
+	})
+	serve := testServe(t, user, recipe.ID)
+	path := fmt.Sprintf("/serve-histories/%d/done-step", serve.ID)
+
+	tests := []struct {
+		name      string
+		stepOrder int
+		want      int
+	}{
+		{"unknown step", 4, http.StatusNotFound},
+		{"done already", 1, http.StatusConflict},
+		{"step before not done", 3, http.StatusConflict},
+		{"next step", 2, http.StatusOK},
+		{"done twice", 2, http.StatusConflict},
+		{"last step", 3, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := testRequest(t, testRouter(user.ID), http.MethodPut, path, "application/json", models.ServeUpdateStep{StepOrder: tt.stepOrder}, &serve)
+			if status != tt.want {
+				t.Errorf("PUT %s step %d = %d, want %d", path, tt.stepOrder, status, tt.want)
+			}
+		})
+	}
+
+	if serve.State != models.SERVE_STATE_COMPLETED {
+		t.Errorf("state = %s, want %s", serve.State, models.SERVE_STATE_COMPLETED)
+	}
+	if got, want := serveStepStates(serve.Steps), "1:Haluskan bumbu:done 2:Tumis bumbu:done 3:Masukkan nasi:done "; got != want {
+		t.Errorf("steps = %q, want %q", got, want)
+	}
+}
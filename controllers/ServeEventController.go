@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// streams send a ping this often so proxies do not close them for being idle
+const serveEventHeartbeat = 25 * time.Second
+
+var serveEventUpgrader = websocket.Upgrader{
+	// the token was checked before upgrading, there is no cookie another origin could ride on
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// ServeEventsStream godoc
+// @Summary Live updates of a serve history as Server-Sent Events
+// @Description Pushes step-started, step-done, timer-ended and reaction events while the history is cooked on another device, the event name is the type of the event.
+// @Description A ready event is sent once subscribed, load the history after it to miss nothing. A ping comment every 25 seconds keeps proxies from closing the stream.
+// @Tags serve
+// @Produce  text/event-stream
+// @Param serve_id path int true "id of the serve history"
+// @Param access_token query string false "access token for clients that can not set the Authorization header, like EventSource"
+// @Security Bearer
+// @Success 200 {object} models.ServeEvent
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Router /serve-histories/{serve_id}/events [get]
+func ServeEventsStream(c *gin.Context) {
+	serve, ok := visibleServe(c)
+	if !ok {
+		return
+	}
+
+	events, cancel := helpers.EVENTS.Subscribe(helpers.ServeEventTopic(serve.ID))
+	defer cancel()
+
+	c.Header("Cache-Control", "no-cache")
+	// nginx would hold the stream back in its buffer
+	c.Header("X-Accel-Buffering", "no")
+	ready, _ := json.Marshal(models.ServeEvent{Type: models.SERVE_EVENT_READY, ServeID: serve.ID, At: time.Now()})
+	c.SSEvent(models.SERVE_EVENT_READY, string(ready))
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(serveEventHeartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case payload, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(serveEventType(payload), string(payload))
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// ServeEventsSocket godoc
+// @Summary Live updates of a serve history over a WebSocket
+// @Description The same events as /serve-histories/{serve_id}/events, one JSON text message per event and a ping event every 25 seconds. Messages from the client are ignored.
+// @Tags serve
+// @Param serve_id path int true "id of the serve history"
+// @Param access_token query string false "access token for clients that can not set the Authorization header, like browsers"
+// @Security Bearer
+// @Success 101 {object} models.ServeEvent
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Router /serve-histories/{serve_id}/ws [get]
+func ServeEventsSocket(c *gin.Context) {
+	serve, ok := visibleServe(c)
+	if !ok {
+		return
+	}
+
+	// a failed upgrade was answered with an error already
+	ws, err := serveEventUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	events, cancel := helpers.EVENTS.Subscribe(helpers.ServeEventTopic(serve.ID))
+	defer cancel()
+
+	closed := make(chan struct{})
+	go func() {
+		// nothing is expected from the client, reading tells when it went away
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				break
+			}
+		}
+		close(closed)
+	}()
+
+	send := func(eventType string) error {
+		payload, _ := json.Marshal(models.ServeEvent{Type: eventType, ServeID: serve.ID, At: time.Now()})
+		return ws.WriteMessage(websocket.TextMessage, payload)
+	}
+	if send(models.SERVE_EVENT_READY) != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(serveEventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case payload, ok := <-events:
+			if !ok || ws.WriteMessage(websocket.TextMessage, payload) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if send(models.SERVE_EVENT_PING) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// visibleServe : the serve history of the serve_id param if the caller owns it or is an admin,
+// otherwise the error response is written. Histories of other users are not found, they can not
+// be told from missing ones.
+func visibleServe(c *gin.Context) (models.Serve, bool) {
+	var serve_id = c.Param("serve_id")
+	serve_id_uint64, _ := strconv.ParseUint(serve_id, 10, 64)
+
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		return models.Serve{}, false
+	}
+
+	var serve models.Serve
+	err := helpers.DB.Where("ID = ?", serve_id_uint64).First(&serve).Error
+	if err != nil || (tokenAuth.UserId != uint64(serve.UserID) && !tokenAuth.IsAdmin()) {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Serve history with id " + fmt.Sprint(serve_id) + " not found"})
+		return models.Serve{}, false
+	}
+	return serve, true
+}
+
+// ownedServe : like visibleServe for changes, admins may look at the history of another user
+// but get a 403 changing it
+func ownedServe(c *gin.Context) (models.Serve, bool) {
+	serve, ok := visibleServe(c)
+	if !ok {
+		return serve, false
+	}
+
+	if tokenAuth, _ := helpers.GetAccessDetails(c); tokenAuth.UserId != uint64(serve.UserID) {
+		c.JSON(http.StatusForbidden, models.ResponseError{Success: false, Message: "Forbidden"})
+		return serve, false
+	}
+	return serve, true
+}
+
+// publishServeEvent : push event to everyone following the serve history, live updates are
+// best effort and never fail the request that caused them
+func publishServeEvent(event models.ServeEvent) {
+	if helpers.EVENTS == nil {
+		return
+	}
+	event.At = time.Now()
+	payload, err := json.Marshal(event)
+	if err == nil {
+		err = helpers.EVENTS.Publish(helpers.ServeEventTopic(event.ServeID), payload)
+	}
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// scheduleServeStepTimer : publish timer-ended when the timer of a started step rings, unless
+// the step was done or started again in the meantime. Timers are lost on restart, clients
+// count down to endsAt on their own anyway.
+func scheduleServeStepTimer(serve models.Serve, step models.ServeStepResult) {
+	if step.StartedAt == nil || step.EndsAt == nil {
+		return
+	}
+	startedAt := *step.StartedAt
+	time.AfterFunc(time.Until(*step.EndsAt), func() {
+		steps, err := serveRecipeSteps(serve)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		for _, current := range steps {
+			if current.StepOrder != step.StepOrder {
+				continue
+			}
+			if current.Done || current.StartedAt == nil || !current.StartedAt.Equal(startedAt) {
+				return
+			}
+			result := serveStepResult(current)
+			publishServeEvent(models.ServeEvent{Type: models.SERVE_EVENT_TIMER_ENDED, ServeID: serve.ID, Step: &result})
+		}
+	})
+}
+
+func serveEventType(payload []byte) string {
+	var event struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(payload, &event)
+	return event.Type
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ServePauseByServeID godoc
+// @Summary Pause a serve history
+// @Description Steps can not be started, done or undone while paused. Timers of started steps keep running, start the step again after resuming to restart its timer.
+// @Tags serve
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /serve-histories/{serve_id}/pause [put]
+func ServePauseByServeID(c *gin.Context) {
+	transitionOwnedServe(c, models.SERVE_STATE_PAUSED)
+}
+
+// ServeResumeByServeID godoc
+// @Summary Resume a paused serve history
+// @Tags serve
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /serve-histories/{serve_id}/resume [put]
+func ServeResumeByServeID(c *gin.Context) {
+	transitionOwnedServe(c, models.SERVE_STATE_IN_PROGRESS)
+}
+
+// ServeAbandonByServeID godoc
+// @Summary Give up on a serve history
+// @Description Serve histories in progress or paused can be abandoned, for good. Those left untouched for SERVE_ABANDON_AFTER are abandoned on their own.
+// @Tags serve
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /serve-histories/{serve_id}/abandon [put]
+func ServeAbandonByServeID(c *gin.Context) {
+	transitionOwnedServe(c, models.SERVE_STATE_ABANDONED)
+}
+
+// ServeDeleteByServeID godoc
+// @Summary Delete a serve history
+// @Description Deletes the serve history with its steps, log and review for good. Its reaction is taken off the counters of the recipe.
+// @Tags serve
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Security Bearer
+// @Success 200
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 500
+// @Router /serve-histories/{serve_id} [delete]
+func ServeDeleteByServeID(c *gin.Context) {
+	serve, ok := ownedServe(c)
+	if !ok {
+		return
+	}
+
+	photoKey, err := models.DeleteServe(helpers.DB, serve.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Serve history with id " + fmt.Sprint(serve.ID) + " not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
+		return
+	}
+	if photoKey != "" && helpers.STORAGE != nil {
+		removeStoredObjects(storedImageKeys(photoKey))
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: struct{}{}})
+}
+
+// transitionOwnedServe : move the serve history of the caller to state to and publish it
+func transitionOwnedServe(c *gin.Context, to string) {
+	serve, ok := ownedServe(c)
+	if !ok {
+		return
+	}
+
+	var recipe models.Recipe
+	if err := helpers.DB.Model(&recipe).Where("ID = ?", serve.RecipeID).First(&recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(serve.RecipeID) + " not found"})
+		return
+	}
+
+	steps, err := serveRecipeSteps(serve)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+		return models.TransitionServe(tx, &serve, to, helpers.DB.NowFunc())
+	})
+	if err != nil {
+		if serveStateConflict(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Failed to update"})
+		return
+	}
+
+	pinServeRevision(serve, &recipe)
+	result := serveResult(serve, recipe, steps)
+	publishServeEvent(models.ServeEvent{Type: models.SERVE_EVENT_STATE, ServeID: serve.ID, Serve: &result})
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+}
+
+// serveInProgress : steps only change while the serve history is in progress, otherwise the
+// conflict is written
+func serveInProgress(c *gin.Context, serve models.Serve) bool {
+	if serve.State != models.SERVE_STATE_IN_PROGRESS {
+		c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: "Serve history is " + serve.State + ", its steps can not change"})
+		return false
+	}
+	return true
+}
+
+// serveConflict : a change the serve history does not allow as it was found once locked
+type serveConflict string
+
+func (e serveConflict) Error() string {
+	return string(e)
+}
+
+// serveStateConflict : write the conflict when err is a models.ServeStateError or a serveConflict
+func serveStateConflict(c *gin.Context, err error) bool {
+	var stateErr models.ServeStateError
+	var conflict serveConflict
+	if !errors.As(err, &stateErr) && !errors.As(err, &conflict) {
+		return false
+	}
+	c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: err.Error()})
+	return true
+}
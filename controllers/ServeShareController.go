@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ServeShareCreateByServeID godoc
+// @Summary Share a serve history
+// @Description Serve histories are private. Sharing hands out a public read only link with an unguessable token, sharing again returns the same link.
+// @Tags serve
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.ServeShareResult}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 500
+// @Router /serve-histories/{serve_id}/share [post]
+func ServeShareCreateByServeID(c *gin.Context) {
+	serve, ok := ownedServe(c)
+	if !ok {
+		return
+	}
+
+	if serve.ShareToken == nil {
+		token, err := helpers.NewShareToken()
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+			// a request sharing the same history at the same time may have won
+			result := tx.Model(&models.Serve{}).Where("id = ? AND share_token IS NULL", serve.ID).UpdateColumn("share_token", token)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return tx.Where("id = ?", serve.ID).First(&serve).Error
+			}
+			serve.ShareToken = &token
+			return models.LogServe(tx, models.ServeLog{ServeID: serve.ID, Type: models.SERVE_LOG_SHARED})
+		})
+		if err != nil || serve.ShareToken == nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.ServeShareResult{
+		ShareToken: *serve.ShareToken,
+		ShareURL:   helpers.ServeShareURL(*serve.ShareToken),
+	}})
+}
+
+// ServeShareDeleteByServeID godoc
+// @Summary Stop sharing a serve history
+// @Description The shared link stops working, sharing again hands out a new one.
+// @Tags serve
+// @Produce  json
+// @Param serve_id path int true "id of the serve history"
+// @Security Bearer
+// @Success 200
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 500
+// @Router /serve-histories/{serve_id}/share [delete]
+func ServeShareDeleteByServeID(c *gin.Context) {
+	serve, ok := ownedServe(c)
+	if !ok {
+		return
+	}
+
+	if serve.ShareToken != nil {
+		err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Serve{}).Where("id = ?", serve.ID).UpdateColumn("share_token", nil).Error; err != nil {
+				return err
+			}
+			return models.LogServe(tx, models.ServeLog{ServeID: serve.ID, Type: models.SERVE_LOG_UNSHARED})
+		})
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: struct{}{}})
+}
+
+// ServeSharedGet godoc
+// @Summary Read a shared serve history
+// @Description No token needed, the share token is the key. The review is left out while hidden, the cook is left out of the history and the review.
+// @Tags serve
+// @Produce  json
+// @Param share_token path string true "token of the shared link"
+// @Success 200 {object} models.ResponseResult{result=models.ServeResult201}
+// @Failure 404
+// @Failure 500
+// @Router /serve-histories/shared/{share_token} [get]
+func ServeSharedGet(c *gin.Context) {
+	var share_token = c.Param("share_token")
+
+	var serve models.Serve
+	if err := helpers.DB.Where("share_token = ?", share_token).First(&serve).Error; err != nil || share_token == "" {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Shared serve history not found"})
+		return
+	}
+
+	var recipe models.Recipe
+	if err := helpers.DB.Model(&recipe).Where("ID = ?", serve.RecipeID).First(&recipe).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Recipe with id " + fmt.Sprint(serve.RecipeID) + " not found"})
+		return
+	}
+
+	steps, err := serveRecipeSteps(serve)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	pinServeRevision(serve, &recipe)
+	result := serveResult(serve, recipe, steps)
+	// anyone having the link reads it, the cook is not given away
+	result.UserID = 0
+	if review := serveReviewResult(serve.ID); review != nil && !review.Hidden {
+		review.UserID = 0
+		review.Author = nil
+		result.Review = review
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nadhirfr/codefood/models"
+)
+
+// jsonKeys : every object key anywhere in value
+func jsonKeys(value interface{}, keys map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			keys[key] = true
+			jsonKeys(item, keys)
+		}
+	case []interface{}:
+		for _, item := range v {
+			jsonKeys(item, keys)
+		}
+	}
+}
+
+func TestServeSharedGetLeavesOutCook(t *testing.T) {
+	useTestDB(t)
+	user := testUser(t)
+	recipe := testRecipe(t, user, []models.RecipeStep{
+		{StepOrder: 1, Description: "Tumis bumbu"},
+		{StepOrder: 2, Description: "Masukkan nasi"},
+	})
+	serve := testServe(t, user, recipe.ID)
+
+	router := testRouter(user.ID)
+	requests := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodPut, fmt.Sprintf("/serve-histories/%d/done-step", serve.ID), models.ServeUpdateStep{StepOrder: 2}},
+		{http.MethodPost, fmt.Sprintf("/serve-histories/%d/reaction", serve.ID), models.ServeUpdateReaction{Reaction: "like"}},
+		{http.MethodPut, fmt.Sprintf("/serve-histories/%d/review", serve.ID), models.ReviewEdit{Text: "Enak", Difficulty: 2}},
+	}
+	for _, req := range requests {
+		if status := testRequest(t, router, req.method, req.path, "application/json", req.body, nil); status != http.StatusOK {
+			t.Fatalf("%s %s = %d, want %d", req.method, req.path, status, http.StatusOK)
+		}
+	}
+	var share models.ServeShareResult
+	if status := testRequest(t, router, http.MethodPost, fmt.Sprintf("/serve-histories/%d/share", serve.ID), "application/json", nil, &share); status != http.StatusOK {
+		t.Fatalf("POST /serve-histories/%d/share = %d, want %d", serve.ID, status, http.StatusOK)
+	}
+
+	var shared json.RawMessage
+	path := "/serve-histories/shared/" + share.ShareToken
+	if status := testRequest(t, testRouter(0), http.MethodGet, path, "", nil, &shared); status != http.StatusOK {
+		t.Fatalf("GET %s = %d, want %d", path, status, http.StatusOK)
+	}
+	var payload interface{}
+	if err := json.Unmarshal(shared, &payload); err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool)
+	jsonKeys(payload, keys)
+	if !keys["review"] || !keys["text"] {
+		t.Fatalf("shared history %s has no review", shared)
+	}
+	for _, key := range []string{"userId", "author"} {
+		if keys[key] {
+			t.Errorf("shared history %s gives away %s", shared, key)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errTagNameTaken = errors.New("tag name is already used")
+
+// TagGetAll godoc
+// @Summary Tag cloud
+// @Description Tags with the number of recipes using each and a weight from 1 to 5 for the size in a tag cloud, the most used first.
+// @Tags tag
+// @Produce  json
+// @Param kind query string false "general, cuisine, diet or flavor"
+// @Param q query string false "start of the tag name"
+// @Param minCount query int false "leave out tags used by fewer recipes"
+// @Param sort query string false "count (default) or name"
+// @Param limit query int false "limit"
+// @Success 200 {object} models.ResponseResult{result=[]models.TagResult}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /tags [get]
+func TagGetAll(c *gin.Context) {
+	var kind = c.Query("kind")
+	var q = c.Query("q")
+	var minCount = c.Query("minCount")
+	var sort = c.DefaultQuery("sort", "count")
+	var limit = c.Query("limit")
+
+	if kind != "" && !models.IsTagKind(kind) {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "kind must be one of " + strings.Join(models.TAG_KINDS, ", ")})
+		return
+	}
+
+	var counts []struct {
+		ID      uint
+		NRecipe int64
+	}
+	query := helpers.DB.Model(&models.Tag{}).
+		Select("tags.id, COUNT(recipe_tags.recipe_id) AS n_recipe").
+		Joins("LEFT JOIN recipe_tags ON recipe_tags.tag_id = tags.id").
+		Group("tags.id")
+
+	if kind != "" {
+		query.Where("tags.kind = ?", kind)
+	}
+	if name := models.TagName(q); name != "" {
+		query.Where("tags.name LIKE ?", helpers.LikeEscaper.Replace(name)+"%")
+	}
+	if minCount != "" {
+		minCount_int64, err := strconv.ParseInt(minCount, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "minCount is invalid"})
+			return
+		}
+		query.Having("COUNT(recipe_tags.recipe_id) >= ?", minCount_int64)
+	}
+
+	switch sort {
+	case "count":
+		query.Order("n_recipe desc").Order("tags.name asc")
+	case "name":
+		query.Order("tags.name asc")
+	default:
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "sort must be count or name"})
+		return
+	}
+
+	if limit != "" {
+		limit_uint64, _ := strconv.ParseInt(limit, 10, 64)
+		query.Limit(int(limit_uint64))
+	}
+
+	if err := query.Scan(&counts).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]uint, 0, len(counts))
+	for _, count := range counts {
+		ids = append(ids, count.ID)
+	}
+	var tags []models.Tag
+	if err := helpers.DB.Where("id IN ?", ids).Find(&tags).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	tagsById := make(map[uint]models.Tag)
+	for _, tag := range tags {
+		tagsById[tag.ID] = tag
+	}
+
+	var maxCount int64
+	for _, count := range counts {
+		if count.NRecipe > maxCount {
+			maxCount = count.NRecipe
+		}
+	}
+
+	result := []models.TagResult{}
+	for _, count := range counts {
+		tag, ok := tagsById[count.ID]
+		if !ok {
+			continue
+		}
+		tag.NRecipe = count.NRecipe
+		result = append(result, models.TagResult{Tag: tag, Weight: tagWeight(count.NRecipe, maxCount)})
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: result})
+}
+
+// TagGetByTagID godoc
+// @Summary Get a tag
+// @Tags tag
+// @Produce  json
+// @Param tag_id path int true "id tag"
+// @Success 200 {object} models.ResponseResult{result=models.Tag}
+// @Failure 404
+// @Router /tags/{tag_id} [get]
+func TagGetByTagID(c *gin.Context) {
+	var tag_id = c.Param("tag_id")
+	tag_id_uint64, _ := strconv.ParseUint(tag_id, 10, 64)
+
+	tag, ok := findTag(uint(tag_id_uint64))
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Tag with id " + fmt.Sprint(tag_id_uint64) + " not found"})
+		return
+	}
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: tag})
+}
+
+// TagCreate godoc
+// @Summary Add a tag
+// @Description Tags named on a recipe are created on the fly as general tags, this creates one ahead with its kind.
+// @Tags tag
+// @Accept  json
+// @Produce  json
+// @Param tag body models.TagCreate true "tag"
+// @Security Bearer
+// @Success 201 {object} models.ResponseResult{result=models.Tag}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 406 {object} models.ResponseError{error=string}
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /tags [post]
+func TagCreate(c *gin.Context) {
+	var tagRegister models.TagCreate
+
+	if ok, errors := helpers.DefaultValidator(c, &tagRegister); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	tag, err := tagOf(tagRegister)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkTagName(tx, 0, tag.Name); err != nil {
+			return err
+		}
+		return tx.Create(&tag).Error
+	})
+	if errors.Is(err, errTagNameTaken) {
+		c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ResponseResult{Success: true, Message: "Success", Data: tag})
+}
+
+// TagEditByTagID godoc
+// @Summary Rename a tag or change its kind
+// @Tags tag
+// @Accept  json
+// @Produce  json
+// @Param tag_id path int true "id tag"
+// @Param tag body models.TagCreate true "tag"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.Tag}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 406 {object} models.ResponseError{error=string}
+// @Failure 409 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /tags/{tag_id} [put]
+func TagEditByTagID(c *gin.Context) {
+	var tag_id = c.Param("tag_id")
+	tag_id_uint64, _ := strconv.ParseUint(tag_id, 10, 64)
+
+	var tagRegister models.TagCreate
+
+	if ok, errors := helpers.DefaultValidator(c, &tagRegister); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+
+		return
+	}
+
+	edited, err := tagOf(tagRegister)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	var tag models.Tag
+	if err := helpers.DB.Where("id = ?", tag_id_uint64).First(&tag).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Tag with id " + fmt.Sprint(tag_id_uint64) + " not found"})
+		return
+	}
+
+	err = helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkTagName(tx, tag.ID, edited.Name); err != nil {
+			return err
+		}
+		return tx.Model(&tag).Updates(map[string]interface{}{"name": edited.Name, "kind": edited.Kind}).Error
+	})
+	if errors.Is(err, errTagNameTaken) {
+		c.JSON(http.StatusConflict, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Save failed " + err.Error()})
+		return
+	}
+
+	reindexRecipes(recipeIdsWithTag(tag.ID))
+	tag, _ = findTag(tag.ID)
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: tag})
+}
+
+// TagDeleteByTagID godoc
+// @Summary Delete a tag
+// @Description The tag is taken off every recipe
+// @Tags tag
+// @Produce  json
+// @Param tag_id path int true "id tag"
+// @Security Bearer
+// @Success 200
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 500
+// @Router /tags/{tag_id} [delete]
+func TagDeleteByTagID(c *gin.Context) {
+	var tag_id = c.Param("tag_id")
+	tag_id_uint64, _ := strconv.ParseUint(tag_id, 10, 64)
+
+	var tag models.Tag
+	if err := helpers.DB.Where("id = ?", tag_id_uint64).First(&tag).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "Tag with id " + fmt.Sprint(tag_id_uint64) + " not found"})
+		return
+	}
+
+	recipeIds := recipeIdsWithTag(tag.ID)
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(models.RecipeTag{TagID: tag.ID}).Delete(&models.RecipeTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Delete failed " + err.Error()})
+		return
+	}
+
+	reindexRecipes(recipeIds)
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: struct{}{}})
+}
+
+// tagOf : the tag described by tagRegister, general unless a kind is given
+func tagOf(tagRegister models.TagCreate) (models.Tag, error) {
+	tag := models.Tag{Name: models.TagName(tagRegister.Name), Kind: tagRegister.Kind}
+	if tag.Name == "" {
+		return tag, errors.New("Name is invalid")
+	}
+	if tag.Kind == "" {
+		tag.Kind = models.TAG_KIND_GENERAL
+	}
+	if !models.IsTagKind(tag.Kind) {
+		return tag, errors.New("kind must be one of " + strings.Join(models.TAG_KINDS, ", "))
+	}
+	return tag, nil
+}
+
+// checkTagName : name must not be used by a tag other than tagID
+func checkTagName(tx *gorm.DB, tagID uint, name string) error {
+	var count int64
+	if err := tx.Model(&models.Tag{}).Where("name = ? AND id <> ?", name, tagID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errTagNameTaken
+	}
+	return nil
+}
+
+func findTag(id uint) (models.Tag, bool) {
+	var tag models.Tag
+	if err := helpers.DB.Where("id = ?", id).First(&tag).Error; err != nil {
+		return tag, false
+	}
+	helpers.DB.Model(&models.RecipeTag{}).Where(models.RecipeTag{TagID: tag.ID}).Count(&tag.NRecipe)
+	return tag, true
+}
+
+func recipeIdsWithTag(tagID uint) []uint {
+	var recipeIds []uint
+	helpers.DB.Model(&models.RecipeTag{}).Where(models.RecipeTag{TagID: tagID}).Pluck("recipe_id", &recipeIds)
+	return recipeIds
+}
+
+// tagIdsOf : ids of the tags named names, ok is false when a name is not a tag
+func tagIdsOf(names []string) ([]uint, bool) {
+	tagNames := []string{}
+	for _, name := range names {
+		if name = models.TagName(name); name != "" {
+			tagNames = append(tagNames, name)
+		}
+	}
+	if len(tagNames) == 0 {
+		return []uint{}, true
+	}
+
+	var tags []models.Tag
+	helpers.DB.Select("id", "name").Where("name IN ?", tagNames).Find(&tags)
+	ids := []uint{}
+	found := make(map[string]bool)
+	for _, tag := range tags {
+		ids = append(ids, tag.ID)
+		found[tag.Name] = true
+	}
+	return ids, len(found) == len(uniqueStrings(tagNames))
+}
+
+// taggedRecipeIds : subquery of the recipes tagged with tagID
+func taggedRecipeIds(tagID uint) *gorm.DB {
+	return helpers.DB.Model(&models.RecipeTag{}).Select("recipe_id").Where("tag_id = ?", tagID)
+}
+
+// filterRecipesByTags : the recipes of recipeIds having every tag of names, in the same order
+func filterRecipesByTags(recipeIds []uint, names []string) []uint {
+	tagIds, ok := tagIdsOf(names)
+	if !ok || len(recipeIds) == 0 {
+		return []uint{}
+	}
+
+	query := helpers.DB.Model(&models.Recipe{}).Where("id IN ?", recipeIds)
+	for _, tagId := range tagIds {
+		query = query.Where("id IN (?)", taggedRecipeIds(tagId))
+	}
+	var tagged []uint
+	query.Pluck("id", &tagged)
+
+	keep := make(map[uint]bool)
+	for _, id := range tagged {
+		keep[id] = true
+	}
+	filtered := []uint{}
+	for _, id := range recipeIds {
+		if keep[id] {
+			filtered = append(filtered, id)
+		}
+	}
+	return filtered
+}
+
+// recipeTagNames : names of the tags of a recipe, never nil so it is listed as []
+func recipeTagNames(recipeID uint) []string {
+	names, _ := models.RecipeTagNames(helpers.DB, []uint{recipeID})
+	return nonNilStrings(names[recipeID])
+}
+
+// tagWeight : 1 for the least used tags up to 5 for the most used, on a logarithmic scale
+// so a few very popular tags do not shrink all others
+func tagWeight(count int64, maxCount int64) int {
+	if maxCount <= 0 || count <= 0 {
+		return 1
+	}
+	return 1 + int(math.Round(4*math.Log1p(float64(count))/math.Log1p(float64(maxCount))))
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func uniqueStrings(values []string) []string {
+	unique := []string{}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
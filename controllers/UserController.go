@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/nadhirfr/codefood/helpers"
 	"github.com/nadhirfr/codefood/models"
+	"gorm.io/gorm"
 )
 
 // UserGetByUserID godoc
@@ -27,18 +30,18 @@ import (
 func UserGetByUserID(c *gin.Context) {
 	var user models.User
 
-	tokenAuth, err := helpers.ExtractTokenMetadata(c.Request)
-	if err != nil || tokenAuth.UserRole != helpers.ROLE_PERSONAL {
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
 		return
 	}
 
-	err = helpers.DB.Where("id = ?", tokenAuth.UserId).First(&user).Error
+	err := helpers.DB.Where("id = ?", tokenAuth.UserId).First(&user).Error
 	if err != nil {
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	} else {
-		c.JSON(http.StatusOK, models.ResponseResult{Data: models.UserResult201{ID: user.ID, Username: user.Username}})
+		c.JSON(http.StatusOK, models.ResponseResult{Data: models.UserResult201{ID: user.ID, Username: user.Username, Role: user.Role}})
 	}
 }
 
@@ -50,7 +53,7 @@ func UserGetByUserID(c *gin.Context) {
 // @Produce  json
 // @Param username body models.UserLogin true "username"
 // @Param password body models.UserLogin true "password"
-// @Success 200 {object} models.ResponseResult{result=helpers.TokenResult200}
+// @Success 200 {object} models.ResponseResult{result=models.UserTokenResult200}
 // @Failure 400 {object} models.ResponseError{error=models.UserError400}
 // @Failure 406,401,422 {object} models.ResponseError{error=string}
 // @Failure 500
@@ -101,18 +104,134 @@ func UserLogin(c *gin.Context) {
 		return
 	}
 
-	ts, err := helpers.CreateToken(_user.ID, helpers.ROLE_PERSONAL)
+	role := _user.Role
+	if role == "" {
+		role = helpers.ROLE_PERSONAL
+	}
+
+	ts, err := helpers.CreateToken(_user.ID, role)
 	if err != nil {
 		c.JSON(http.StatusUnprocessableEntity, models.ResponseError{Success: false, Message: err.Error()})
 		return
 	}
 
+	if err := helpers.CreateAuth(_user.ID, ts); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, models.ResponseError{Success: false, Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{
+		Success: true,
+		Message: "Success",
+		Data:    models.UserTokenResult200{Token: ts.AccessToken, RefreshToken: ts.RefreshToken}})
+}
+
+// UserRefreshToken godoc
+// @Summary Rotate refresh token to get a new auth token
+// @Description Exchange a refresh token for a new token pair, the given refresh token can not be used again
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param refreshToken body models.UserRefreshToken true "refreshToken"
+// @Success 200 {object} models.ResponseResult{result=models.UserTokenResult200}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /auth/refresh [post]
+func UserRefreshToken(c *gin.Context) {
+	var refresh models.UserRefreshToken
+
+	if ok, errors := helpers.DefaultValidator(c, &refresh); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+		return
+	}
+
+	ts, err := helpers.RefreshAuth(refresh.RefreshToken)
+	if err == helpers.ErrRefreshTokenReused {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Refresh token already used, session revoked"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		return
+	}
+
 	c.JSON(http.StatusOK, models.ResponseResult{
 		Success: true,
 		Message: "Success",
-		Data: struct {
-			Token string `json:"token"`
-		}{Token: ts.AccessToken}})
+		Data:    models.UserTokenResult200{Token: ts.AccessToken, RefreshToken: ts.RefreshToken}})
+}
+
+// UserLogout godoc
+// @Summary Revoke current session
+// @Description Revoke the access token and every refresh token of the current login
+// @Tags user
+// @Accept */*
+// @Produce  json
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult
+// @Failure 401 {object} models.ResponseError{Message=string}
+// @Failure 500
+// @Router /auth/logout [post]
+func UserLogout(c *gin.Context) {
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	if _, err := helpers.DeleteAuth(tokenAuth.AccessUuid); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Logout failed " + err.Error()})
+		return
+	}
+
+	if err := helpers.RevokeFamily(tokenAuth.Family); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Logout failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: struct{}{}})
+}
+
+// UserLogoutAll godoc
+// @Summary Revoke all sessions
+// @Description Revoke every access and refresh token of the current user on all devices
+// @Tags user
+// @Accept */*
+// @Produce  json
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult
+// @Failure 401 {object} models.ResponseError{Message=string}
+// @Failure 500
+// @Router /auth/logout-all [post]
+func UserLogoutAll(c *gin.Context) {
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	// legacy tokens are not part of any family, drop them explicitly
+	if _, err := helpers.DeleteAuth(tokenAuth.AccessUuid); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Logout failed " + err.Error()})
+		return
+	}
+
+	if err := helpers.RevokeAllAuth(tokenAuth.UserId); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Logout failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: struct{}{}})
 }
 
 func UserRegister(c *gin.Context) {
@@ -140,13 +259,194 @@ func UserRegister(c *gin.Context) {
 	}
 
 	if _user.Username != user.Username {
+		// roles are only granted through UserEditRoleByUserID
+		user.Role = helpers.ROLE_PERSONAL
+
 		if err := helpers.DB.Save(&user).Error; err != nil {
 			c.AbortWithStatus(http.StatusInternalServerError)
 		} else {
-			c.JSON(http.StatusCreated, models.ResponseResult{Success: true, Message: "Success", Data: models.UserResult201{ID: user.ID, Username: user.Username}})
+			c.JSON(http.StatusCreated, models.ResponseResult{Success: true, Message: "Success", Data: models.UserResult201{ID: user.ID, Username: user.Username, Role: user.Role}})
 		}
 	} else {
 		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "username " + fmt.Sprint(user.Username) + " already registered"})
 	}
 
 }
+
+// UserEditRoleByUserID godoc
+// @Summary Change the role of a user
+// @Description Promote or demote a user, every session of that user is revoked so the new role applies on next login
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param user_id path int true "id of user"
+// @Param role body models.UserUpdateRole true "role"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.UserResult201}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401,403 {object} models.ResponseError{error=string}
+// @Failure 404
+// @Failure 500
+// @Router /users/{user_id}/role [put]
+func UserEditRoleByUserID(c *gin.Context) {
+	var user_id = c.Param("user_id")
+	user_id_uint64, _ := strconv.ParseUint(user_id, 10, 64)
+
+	var userUpdateRole models.UserUpdateRole
+
+	if ok, errors := helpers.DefaultValidator(c, &userUpdateRole); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+		return
+	}
+
+	var user models.User
+	if err := helpers.DB.Where("id = ?", user_id_uint64).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ResponseError{Success: false, Message: "User with id " + fmt.Sprint(user_id_uint64) + " not found"})
+		return
+	}
+
+	// UpdateColumn skips BeforeSave, which would hash the password again
+	if err := helpers.DB.Model(&user).UpdateColumn("role", userUpdateRole.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Update failed " + err.Error()})
+		return
+	}
+
+	if err := helpers.RevokeAllAuth(uint64(user.ID)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Update failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.UserResult201{ID: user.ID, Username: user.Username, Role: userUpdateRole.Role}})
+}
+
+// UserAllergiesGet godoc
+// @Summary Allergy profile of the current user
+// @Tags user
+// @Produce  json
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.UserAllergies}
+// @Failure 401 {object} models.ResponseError{Message=string}
+// @Failure 500
+// @Router /auth/allergies [get]
+func UserAllergiesGet(c *gin.Context) {
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	allergens, err := models.UserAllergens(helpers.DB, uint(tokenAuth.UserId))
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.UserAllergies{Allergens: allergens}})
+}
+
+// UserAllergiesEdit godoc
+// @Summary Replace the allergy profile of the current user
+// @Description Recipes with any of the allergens are left out of GET /recipes for the user. An empty list clears the profile.
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param allergies body models.UserAllergies true "nuts, shellfish, dairy, gluten, egg or soy"
+// @Security Bearer
+// @Success 200 {object} models.ResponseResult{result=models.UserAllergies}
+// @Failure 400 {object} models.ResponseError{error=string}
+// @Failure 401 {object} models.ResponseError{Message=string}
+// @Failure 406 {object} models.ResponseError{error=string}
+// @Failure 500
+// @Router /auth/allergies [put]
+func UserAllergiesEdit(c *gin.Context) {
+	var userAllergies models.UserAllergies
+
+	if ok, errors := helpers.DefaultValidator(c, &userAllergies); !ok {
+		if _, ok := errors.(gin.H); !ok {
+			c.JSON(http.StatusNotAcceptable, models.ResponseError{Success: false, Message: fmt.Sprintf("%v", errors)})
+			return
+		}
+
+		_error := ""
+		for _, val := range errors.(gin.H) {
+			_error = _error + val.(string)
+		}
+
+		c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: _error})
+		return
+	}
+
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	allergies := []models.UserAllergy{}
+	seen := make(map[string]bool)
+	for _, allergen := range userAllergies.Allergens {
+		allergen = strings.ToLower(strings.TrimSpace(allergen))
+		if !helpers.IsAllergen(allergen) {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Success: false, Message: "allergens must be one of " + strings.Join(helpers.ALLERGENS, ", ")})
+			return
+		}
+		if !seen[allergen] {
+			seen[allergen] = true
+			allergies = append(allergies, models.UserAllergy{UserID: uint(tokenAuth.UserId), Allergen: allergen})
+		}
+	}
+
+	err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(models.UserAllergy{UserID: uint(tokenAuth.UserId)}).Delete(&models.UserAllergy{}).Error; err != nil {
+			return err
+		}
+		if len(allergies) == 0 {
+			return nil
+		}
+		return tx.Create(&allergies).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Success: false, Message: "Update failed " + err.Error()})
+		return
+	}
+
+	allergens, _ := models.UserAllergens(helpers.DB, uint(tokenAuth.UserId))
+	c.JSON(http.StatusOK, models.ResponseResult{Success: true, Message: "Success", Data: models.UserAllergies{Allergens: allergens}})
+}
+
+// callerAllergens : the allergy profile of the signed in caller, none for anonymous requests
+func callerAllergens(c *gin.Context) []string {
+	tokenAuth, ok := helpers.GetAccessDetails(c)
+	if !ok {
+		return []string{}
+	}
+	allergens, _ := models.UserAllergens(helpers.DB, uint(tokenAuth.UserId))
+	return allergens
+}
+
+// allergyWarning : allergens of a recipe the caller is allergic to
+func allergyWarning(c *gin.Context, recipeAllergens []string) []string {
+	profile := make(map[string]bool)
+	for _, allergen := range callerAllergens(c) {
+		profile[allergen] = true
+	}
+	warning := []string{}
+	for _, allergen := range recipeAllergens {
+		if profile[allergen] {
+			warning = append(warning, allergen)
+		}
+	}
+	if len(warning) == 0 {
+		return nil
+	}
+	return warning
+}
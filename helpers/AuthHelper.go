@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,6 +19,7 @@ type AccessDetails struct {
 	AccessUuid string
 	UserId     uint64
 	UserRole   string
+	Family     string
 }
 
 type TokenDetails struct {
@@ -25,10 +27,20 @@ type TokenDetails struct {
 	RefreshToken string
 	AccessUuid   string
 	RefreshUuid  string
+	Family       string
 	AtExpires    int64
 	RtExpires    int64
 }
 
+// RefreshDetails is what a refresh token carries
+type RefreshDetails struct {
+	RefreshUuid string
+	AccessUuid  string
+	UserId      uint64
+	UserRole    string
+	Family      string
+}
+
 type TokenResult200 struct {
 	AccessToken  string `json:"access_token" swaggertype:"string" example:"xxxxxx.xxxxx.xxx"`
 	RefreshToken string `json:"refresh_token" swaggertype:"string" example:"xxxxxx.xxxxx.xxx"`
@@ -39,8 +51,19 @@ const (
 	ROLE_ADMIN    = "admin"
 )
 
+var (
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	ErrInvalidToken       = errors.New("invalid token")
+)
+
+// CreateToken : mint an access/refresh pair starting a new login session (family)
 func CreateToken(userid uint, user_role string) (*TokenDetails, error) {
+	return createToken(userid, user_role, uuid.NewV4().String())
+}
+
+func createToken(userid uint, user_role string, family string) (*TokenDetails, error) {
 	td := &TokenDetails{}
+	td.Family = family
 	td.AtExpires = time.Now().Add(time.Minute * 15).Unix()
 	td.AccessUuid = uuid.NewV4().String()
 
@@ -54,41 +77,126 @@ func CreateToken(userid uint, user_role string) (*TokenDetails, error) {
 	atClaims["access_uuid"] = td.AccessUuid
 	atClaims["user_id"] = userid
 	atClaims["user_role"] = user_role
+	atClaims["family"] = td.Family
 	atClaims["exp"] = td.AtExpires
 
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	td.AccessToken, err = at.SignedString([]byte("qlymyksxiwyqqkuuywl"))
+	td.AccessToken, err = ACCESS_KEYS.Sign(atClaims)
 	if err != nil {
 		return nil, err
 	}
 	//Creating Refresh Token
 	rtClaims := jwt.MapClaims{}
 	rtClaims["refresh_uuid"] = td.RefreshUuid
+	rtClaims["access_uuid"] = td.AccessUuid
 	rtClaims["user_id"] = userid
 	rtClaims["user_role"] = user_role
+	rtClaims["family"] = td.Family
 	rtClaims["exp"] = td.RtExpires
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	td.RefreshToken, err = rt.SignedString([]byte("pjeididopzspdjbuseg"))
+	td.RefreshToken, err = REFRESH_KEYS.Sign(rtClaims)
 	if err != nil {
 		return nil, err
 	}
 	return td, nil
 }
 
+func familyKey(family string) string {
+	return "family:" + family
+}
+
+func userFamiliesKey(userid uint64) string {
+	return "user_families:" + strconv.FormatUint(userid, 10)
+}
+
+// CreateAuth : register the token uuids of td in the session store
 func CreateAuth(userid uint, td *TokenDetails) error {
 	at := time.Unix(td.AtExpires, 0) //converting Unix to UTC(to Time object)
 	rt := time.Unix(td.RtExpires, 0)
 	now := time.Now()
 
-	errAccess := REDIS.Set(td.AccessUuid, strconv.Itoa(int(userid)), at.Sub(now)).Err()
+	errAccess := SESSIONS.Set(td.AccessUuid, strconv.Itoa(int(userid)), at.Sub(now))
 	if errAccess != nil {
 		return errAccess
 	}
-	errRefresh := REDIS.Set(td.RefreshUuid, strconv.Itoa(int(userid)), rt.Sub(now)).Err()
+	errRefresh := SESSIONS.Set(td.RefreshUuid, strconv.Itoa(int(userid)), rt.Sub(now))
 	if errRefresh != nil {
 		return errRefresh
 	}
-	return nil
+
+	// the family remembers every uuid it ever issued, so a reused refresh token
+	// can revoke the whole chain and logout can find the paired tokens
+	if err := SESSIONS.SAdd(familyKey(td.Family), rt.Sub(now), td.AccessUuid, td.RefreshUuid); err != nil {
+		return err
+	}
+	return SESSIONS.SAdd(userFamiliesKey(uint64(userid)), rt.Sub(now), td.Family)
+}
+
+// RefreshAuth : rotate a refresh token, returning a fresh pair in the same family.
+// A refresh token that was already used revokes the whole family.
+func RefreshAuth(refreshToken string) (*TokenDetails, error) {
+	rd, err := ExtractRefreshTokenMetadata(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// deleting is the atomic claim: only one caller can rotate a given token
+	deleted, err := SESSIONS.Del(rd.RefreshUuid)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		members, err := SESSIONS.SMembers(familyKey(rd.Family))
+		if err != nil {
+			return nil, err
+		}
+		if len(members) > 0 {
+			if err := RevokeFamily(rd.Family); err != nil {
+				return nil, err
+			}
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrSessionNotFound
+	}
+
+	if _, err := SESSIONS.Del(rd.AccessUuid); err != nil {
+		return nil, err
+	}
+
+	td, err := createToken(uint(rd.UserId), rd.UserRole, rd.Family)
+	if err != nil {
+		return nil, err
+	}
+	if err := CreateAuth(uint(rd.UserId), td); err != nil {
+		return nil, err
+	}
+	return td, nil
+}
+
+// RevokeFamily : drop every token issued in one login session
+func RevokeFamily(family string) error {
+	if family == "" {
+		return nil
+	}
+	members, err := SESSIONS.SMembers(familyKey(family))
+	if err != nil {
+		return err
+	}
+	_, err = SESSIONS.Del(append(members, familyKey(family))...)
+	return err
+}
+
+// RevokeAllAuth : drop every login session of a user
+func RevokeAllAuth(userid uint64) error {
+	families, err := SESSIONS.SMembers(userFamiliesKey(userid))
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if err := RevokeFamily(family); err != nil {
+			return err
+		}
+	}
+	_, err = SESSIONS.Del(userFamiliesKey(userid))
+	return err
 }
 
 func ExtractToken(r *http.Request) string {
@@ -103,13 +211,16 @@ func ExtractToken(r *http.Request) string {
 
 func VerifyToken(r *http.Request) (*jwt.Token, error) {
 	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		//Make sure that the token method conform to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte("qlymyksxiwyqqkuuywl"), nil
-	})
+	//the key set makes sure the token method conforms to the key of its "kid"
+	token, err := jwt.Parse(tokenString, ACCESS_KEYS.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func VerifyRefreshToken(tokenString string) (*jwt.Token, error) {
+	token, err := jwt.Parse(tokenString, REFRESH_KEYS.Keyfunc)
 	if err != nil {
 		return nil, err
 	}
@@ -147,17 +258,52 @@ func ExtractTokenMetadata(r *http.Request) (*AccessDetails, error) {
 		if !ok {
 			return nil, err
 		}
+		// tokens minted before session families existed carry no family
+		family, _ := claims["family"].(string)
 		return &AccessDetails{
 			AccessUuid: accessUuid,
 			UserId:     userId,
 			UserRole:   userRole,
+			Family:     family,
 		}, nil
 	}
 	return nil, err
 }
 
+func ExtractRefreshTokenMetadata(tokenString string) (*RefreshDetails, error) {
+	token, err := VerifyRefreshToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	refreshUuid, ok := claims["refresh_uuid"].(string)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	family, ok := claims["family"].(string)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	userId, err := strconv.ParseUint(fmt.Sprintf("%.f", claims["user_id"]), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	accessUuid, _ := claims["access_uuid"].(string)
+	userRole, _ := claims["user_role"].(string)
+	return &RefreshDetails{
+		RefreshUuid: refreshUuid,
+		AccessUuid:  accessUuid,
+		UserId:      userId,
+		UserRole:    userRole,
+		Family:      family,
+	}, nil
+}
+
 func FetchAuth(authD *AccessDetails) (uint64, error) {
-	userid, err := REDIS.Get(authD.AccessUuid).Result()
+	userid, err := SESSIONS.Get(authD.AccessUuid)
 	if err != nil {
 		return 0, err
 	}
@@ -166,28 +312,121 @@ func FetchAuth(authD *AccessDetails) (uint64, error) {
 }
 
 func DeleteAuth(givenUuid string) (int64, error) {
-	deleted, err := REDIS.Del(givenUuid).Result()
+	deleted, err := SESSIONS.Del(givenUuid)
 	if err != nil {
 		return 0, err
 	}
 	return deleted, nil
 }
 
+// sessionValid : the access token must still be present in the session store
+func sessionValid(r *http.Request) (*AccessDetails, error) {
+	tokenAuth, err := ExtractTokenMetadata(r)
+	if err != nil {
+		return nil, err
+	}
+	if tokenAuth == nil {
+		return nil, ErrInvalidToken
+	}
+	userId, err := FetchAuth(tokenAuth)
+	if err != nil {
+		return nil, err
+	}
+	if userId != tokenAuth.UserId {
+		return nil, ErrInvalidToken
+	}
+	return tokenAuth, nil
+}
+
+const ACCESS_DETAILS_KEY = "accessDetails"
+
+// TokenAuthMiddleware : reject requests without a live access token, the token
+// details are then available to handlers through GetAccessDetails
 func TokenAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		err := TokenValid(c.Request)
+		tokenAuth, err := requestAccessDetails(c.Request)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, struct {
-				Success bool   `json:"success"`
-				Message string `json:"message"`
-			}{Success: false, Message: "Unauthorized"})
-			c.Abort()
+			abortWithStatus(c, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
+		c.Set(ACCESS_DETAILS_KEY, tokenAuth)
+		c.Next()
+	}
+}
+
+// requestAccessDetails : details of the live access token of r
+func requestAccessDetails(r *http.Request) (*AccessDetails, error) {
+	if err := TokenValid(r); err != nil {
+		return nil, err
+	}
+	return sessionValid(r)
+}
+
+// StreamTokenAuthMiddleware : like TokenAuthMiddleware, the token may also come as the
+// access_token query parameter since browsers can not set headers on EventSource and
+// WebSocket connections. Only for streaming routes, URLs end up in logs.
+func StreamTokenAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.Query("access_token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		TokenAuthMiddleware()(c)
+	}
+}
+
+// OptionalTokenAuthMiddleware : like TokenAuthMiddleware for requests carrying a live token,
+// requests without one or with an invalid or expired one pass as anonymous
+func OptionalTokenAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			if tokenAuth, err := requestAccessDetails(c.Request); err == nil {
+				c.Set(ACCESS_DETAILS_KEY, tokenAuth)
+			}
+		}
 		c.Next()
 	}
 }
 
+// RequireRole : only let through users having one of roles, must run after TokenAuthMiddleware
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenAuth, ok := GetAccessDetails(c)
+		if !ok {
+			abortWithStatus(c, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		for _, role := range roles {
+			if tokenAuth.UserRole == role {
+				c.Next()
+				return
+			}
+		}
+		abortWithStatus(c, http.StatusForbidden, "Forbidden")
+	}
+}
+
+// GetAccessDetails : token details put in the context by TokenAuthMiddleware
+func GetAccessDetails(c *gin.Context) (*AccessDetails, bool) {
+	value, ok := c.Get(ACCESS_DETAILS_KEY)
+	if !ok {
+		return nil, false
+	}
+	tokenAuth, ok := value.(*AccessDetails)
+	return tokenAuth, ok
+}
+
+func (a *AccessDetails) IsAdmin() bool {
+	return a != nil && a.UserRole == ROLE_ADMIN
+}
+
+func abortWithStatus(c *gin.Context, status int, message string) {
+	c.JSON(status, struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}{Success: false, Message: message})
+	c.Abort()
+}
+
 // MakePassword : Encrypt user password
 func MakePassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveWith : status of a request with authorization through middleware, and the user it saw
+func serveWith(middleware gin.HandlerFunc, authorization string) (int, uint64) {
+	gin.SetMode(gin.TestMode)
+	var userId uint64
+	router := gin.New()
+	router.GET("/", middleware, func(c *gin.Context) {
+		if tokenAuth, ok := GetAccessDetails(c); ok {
+			userId = tokenAuth.UserId
+		}
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code, userId
+}
+
+func TestOptionalTokenAuthMiddleware(t *testing.T) {
+	useMemorySessions(t)
+	live := login(t, 7)
+	revoked := login(t, 8)
+	if err := RevokeAllAuth(8); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantUser      uint64
+	}{
+		{"without token", "", 0},
+		{"live token", "Bearer " + live.AccessToken, 7},
+		{"malformed token", "Bearer not.a.token", 0},
+		{"revoked token", "Bearer " + revoked.AccessToken, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, userId := serveWith(OptionalTokenAuthMiddleware(), tt.authorization)
+			if status != http.StatusOK || userId != tt.wantUser {
+				t.Errorf("status %d as user %d, want 200 as user %d", status, userId, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestTokenAuthMiddlewareRejectsInvalidToken(t *testing.T) {
+	useMemorySessions(t)
+	for _, authorization := range []string{"", "Bearer not.a.token"} {
+		if status, _ := serveWith(TokenAuthMiddleware(), authorization); status != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want 401", authorization, status)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package helpers
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/go-redis/redis"
 	"gorm.io/driver/mysql"
@@ -50,6 +51,9 @@ func DbURL(dbConfig *DBConfig) mysql.Config {
 	}
 }
 
+// LikeEscaper escapes the wildcards of LIKE, user input in a pattern matches literally
+var LikeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 func RedisInit() {
 	//Initializing redis
 	dsn := os.Getenv("REDIS_DSN")
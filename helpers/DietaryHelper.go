@@ -0,0 +1,157 @@
+package helpers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+//go:embed data/dietary.json
+var dietaryJSON []byte
+
+const (
+	ALLERGEN_NUTS      = "nuts"
+	ALLERGEN_SHELLFISH = "shellfish"
+	ALLERGEN_DAIRY     = "dairy"
+	ALLERGEN_GLUTEN    = "gluten"
+	ALLERGEN_EGG       = "egg"
+	ALLERGEN_SOY       = "soy"
+)
+
+const (
+	DIET_VEGETARIAN = "vegetarian"
+	DIET_VEGAN      = "vegan"
+	DIET_HALAL      = "halal"
+)
+
+var ALLERGENS = []string{ALLERGEN_NUTS, ALLERGEN_SHELLFISH, ALLERGEN_DAIRY, ALLERGEN_GLUTEN, ALLERGEN_EGG, ALLERGEN_SOY}
+
+// DIETS in the order they are checked, a diet comes after the diets it requires
+var DIETS = []string{DIET_VEGETARIAN, DIET_VEGAN, DIET_HALAL}
+
+// DIETARY_RULES_VERSION goes up whenever data/dietary.json changes, recipes analyzed with
+// older rules are analyzed again on start
+const DIETARY_RULES_VERSION = 1
+
+// dietaryRule : an ingredient matches when one of the keywords appears in its name as whole
+// words after the exceptions were taken out
+type dietaryRule struct {
+	Keywords []string `json:"keywords"`
+	Except   []string `json:"except"`
+	// Allergens break a diet, Requires are diets it builds on
+	Allergens []string `json:"allergens"`
+	Requires  []string `json:"requires"`
+}
+
+var allergenRules map[string]*dietaryRule
+var dietRules map[string]*dietaryRule
+
+func init() {
+	var dataset struct {
+		Allergens map[string]*dietaryRule `json:"allergens"`
+		Diets     map[string]*dietaryRule `json:"diets"`
+	}
+	if err := json.Unmarshal(dietaryJSON, &dataset); err != nil {
+		panic(err)
+	}
+	for _, rule := range dataset.Allergens {
+		rule.normalize()
+	}
+	for _, rule := range dataset.Diets {
+		rule.normalize()
+	}
+	allergenRules = dataset.Allergens
+	dietRules = dataset.Diets
+}
+
+func (rule *dietaryRule) normalize() {
+	for idx, keyword := range rule.Keywords {
+		rule.Keywords[idx] = NormalizeIngredientItem(keyword)
+	}
+	for idx, exception := range rule.Except {
+		rule.Except[idx] = NormalizeIngredientItem(exception)
+	}
+	// longest exception first so "susu kedelai" is taken out before "susu" could be
+	sort.SliceStable(rule.Except, func(i, j int) bool { return len(rule.Except[i]) > len(rule.Except[j]) })
+}
+
+func (rule *dietaryRule) matches(item string) bool {
+	normalized := " " + NormalizeIngredientItem(item) + " "
+	for _, exception := range rule.Except {
+		normalized = strings.ReplaceAll(normalized, " "+exception+" ", " | ")
+	}
+	for _, keyword := range rule.Keywords {
+		if strings.Contains(normalized, " "+keyword+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// Dietary : what the ingredients of a recipe say about allergies and diets. AllergenItems
+// names the ingredients every allergen was found in.
+type Dietary struct {
+	Allergens     []string            `json:"allergens"`
+	AllergenItems map[string][]string `json:"allergenItems"`
+	Diets         []string            `json:"diets"`
+}
+
+// AnalyzeDietary : allergens in items and the diets they fit. The rules only know ingredient
+// names, halal says no ingredient is haram and is no certification.
+func AnalyzeDietary(items []string) Dietary {
+	dietary := Dietary{Allergens: []string{}, AllergenItems: make(map[string][]string), Diets: []string{}}
+
+	found := make(map[string]bool)
+	for _, allergen := range ALLERGENS {
+		for _, item := range items {
+			if allergenRules[allergen].matches(item) {
+				found[allergen] = true
+				dietary.AllergenItems[allergen] = append(dietary.AllergenItems[allergen], item)
+			}
+		}
+		if found[allergen] {
+			dietary.Allergens = append(dietary.Allergens, allergen)
+		}
+	}
+
+	fits := make(map[string]bool)
+	for _, diet := range DIETS {
+		rule := dietRules[diet]
+		fit := true
+		for _, required := range rule.Requires {
+			fit = fit && fits[required]
+		}
+		for _, allergen := range rule.Allergens {
+			fit = fit && !found[allergen]
+		}
+		for _, item := range items {
+			fit = fit && !rule.matches(item)
+		}
+		if fit {
+			fits[diet] = true
+			dietary.Diets = append(dietary.Diets, diet)
+		}
+	}
+	return dietary
+}
+
+// FitsDiet : diets is the list of diets a recipe fits
+func FitsDiet(diets []string, diet string) bool {
+	for _, value := range diets {
+		if value == diet {
+			return true
+		}
+	}
+	return false
+}
+
+func IsAllergen(value string) bool {
+	_, ok := allergenRules[value]
+	return ok
+}
+
+func IsDiet(value string) bool {
+	_, ok := dietRules[value]
+	return ok
+}
@@ -0,0 +1,98 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeDietaryAllergens(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []string
+		want  []string
+	}{
+		{"peanuts", []string{"kacang tanah goreng"}, []string{ALLERGEN_NUTS}},
+		{"candlenut", []string{"kemiri, sangrai"}, []string{ALLERGEN_NUTS}},
+		{"long beans are no nuts", []string{"kacang panjang"}, []string{}},
+		{"mung beans are no nuts", []string{"Kacang Hijau"}, []string{}},
+		{"shrimp paste", []string{"terasi bakar"}, []string{ALLERGEN_SHELLFISH}},
+		{"squid", []string{"cumi-cumi"}, []string{ALLERGEN_SHELLFISH}},
+		{"milk", []string{"susu cair"}, []string{ALLERGEN_DAIRY}},
+		{"coconut milk is no dairy", []string{"santan kental"}, []string{}},
+		{"soy milk is soy", []string{"susu kedelai"}, []string{ALLERGEN_SOY}},
+		{"peanut butter is nuts only", []string{"peanut butter"}, []string{ALLERGEN_NUTS}},
+		{"wheat flour", []string{"tepung terigu"}, []string{ALLERGEN_GLUTEN}},
+		{"rice flour is gluten free", []string{"tepung beras"}, []string{}},
+		{"rice noodles are gluten free", []string{"mie beras"}, []string{}},
+		{"sweet soy sauce", []string{"kecap manis"}, []string{ALLERGEN_GLUTEN, ALLERGEN_SOY}},
+		{"fish sauce is neither", []string{"kecap ikan"}, []string{}},
+		{"egg yolk", []string{"kuning telur"}, []string{ALLERGEN_EGG}},
+		{"whole words only", []string{"eggplant", "butternut squash"}, []string{}},
+		{"tofu", []string{"tahu putih"}, []string{ALLERGEN_SOY}},
+		{"no allergen", []string{"bawang merah", "garam"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnalyzeDietary(tt.items).Allergens; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AnalyzeDietary(%q).Allergens = %q, want %q", tt.items, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeDietaryAllergenItems(t *testing.T) {
+	dietary := AnalyzeDietary([]string{"telur", "garam", "mayones"})
+	if want := []string{"telur", "mayones"}; !reflect.DeepEqual(dietary.AllergenItems[ALLERGEN_EGG], want) {
+		t.Errorf("AllergenItems[egg] = %q, want %q", dietary.AllergenItems[ALLERGEN_EGG], want)
+	}
+	if _, ok := dietary.AllergenItems[ALLERGEN_DAIRY]; ok {
+		t.Error("AllergenItems names dairy, there is none")
+	}
+}
+
+func TestAnalyzeDietaryDiets(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []string
+		want  []string
+	}{
+		{"vegetables only", []string{"kangkung", "bawang putih", "cabai"}, []string{DIET_VEGETARIAN, DIET_VEGAN, DIET_HALAL}},
+		{"chicken", []string{"ayam", "garam"}, []string{DIET_HALAL}},
+		{"shellfish is no vegetarian", []string{"udang"}, []string{DIET_HALAL}},
+		{"coconut flesh is vegetarian", []string{"daging kelapa"}, []string{DIET_VEGETARIAN, DIET_VEGAN, DIET_HALAL}},
+		{"vegetable stock is vegetarian", []string{"kaldu sayur"}, []string{DIET_VEGETARIAN, DIET_VEGAN, DIET_HALAL}},
+		{"fish sauce", []string{"kecap ikan"}, []string{DIET_HALAL}},
+		{"egg is vegetarian only", []string{"telur"}, []string{DIET_VEGETARIAN, DIET_HALAL}},
+		{"dairy is vegetarian only", []string{"keju parut"}, []string{DIET_VEGETARIAN, DIET_HALAL}},
+		{"honey is no vegan", []string{"madu"}, []string{DIET_VEGETARIAN, DIET_HALAL}},
+		{"pork", []string{"daging babi"}, []string{}},
+		{"cooking wine", []string{"angciu"}, []string{DIET_VEGETARIAN, DIET_VEGAN}},
+		{"wine vinegar is halal", []string{"red wine vinegar"}, []string{DIET_VEGETARIAN, DIET_VEGAN, DIET_HALAL}},
+		{"lard", []string{"lard"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnalyzeDietary(tt.items).Diets; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AnalyzeDietary(%q).Diets = %q, want %q", tt.items, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDietaryRulesKnown(t *testing.T) {
+	for _, allergen := range ALLERGENS {
+		if !IsAllergen(allergen) {
+			t.Errorf("no rule for allergen %q", allergen)
+		}
+	}
+	for _, diet := range DIETS {
+		if !IsDiet(diet) {
+			t.Errorf("no rule for diet %q", diet)
+		}
+	}
+	if IsAllergen("halal") || IsDiet("nuts") {
+		t.Error("allergens and diets are mixed up")
+	}
+}
@@ -0,0 +1,126 @@
+package helpers
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+// EVENTS is the hub live updates are published on, e.g. steps ticked off during a serve
+var EVENTS EventHub
+
+// EventHub is a topic based pub/sub. Payloads are delivered to the subscribers of their
+// topic at the time of publishing, nothing is kept for later subscribers.
+type EventHub interface {
+	Publish(topic string, payload []byte) error
+	// Subscribe : payloads published on topic until cancel is called, cancel closes the channel
+	Subscribe(topic string) (<-chan []byte, func())
+}
+
+// payloads waiting for a slow subscriber, more are dropped for it
+const eventBufferSize = 16
+
+// EventsInit picks the hub from EVENTS_HUB (memory|redis). The memory hub only reaches
+// subscribers of the same instance, with several instances use redis.
+func EventsInit() {
+	switch strings.ToLower(os.Getenv("EVENTS_HUB")) {
+	case "redis":
+		if REDIS == nil {
+			RedisInit()
+		}
+		EVENTS = NewRedisEventHub(REDIS, "codefood:events:")
+	default:
+		EVENTS = NewMemoryEventHub()
+	}
+}
+
+// ServeEventTopic : topic of the live updates of a serve history
+func ServeEventTopic(serveID uint) string {
+	return fmt.Sprintf("serve:%d", serveID)
+}
+
+//* memory hub
+
+type MemoryEventHub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan []byte]struct{}
+}
+
+func NewMemoryEventHub() *MemoryEventHub {
+	return &MemoryEventHub{subscribers: make(map[string]map[chan []byte]struct{})}
+}
+
+func (h *MemoryEventHub) Publish(topic string, payload []byte) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subscribers[topic] {
+		select {
+		case ch <- payload:
+		default:
+			// the subscriber does not keep up, it misses this one rather than holding up the others
+		}
+	}
+	return nil
+}
+
+func (h *MemoryEventHub) Subscribe(topic string) (<-chan []byte, func()) {
+	ch := make(chan []byte, eventBufferSize)
+
+	h.mu.Lock()
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = make(map[chan []byte]struct{})
+	}
+	h.subscribers[topic][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[topic], ch)
+			if len(h.subscribers[topic]) == 0 {
+				delete(h.subscribers, topic)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+//* redis hub
+
+// RedisEventHub publishes through Redis so every instance gets every payload, each instance
+// hands them on to its own subscribers with a memory hub
+type RedisEventHub struct {
+	client *redis.Client
+	prefix string
+	local  *MemoryEventHub
+}
+
+func NewRedisEventHub(client *redis.Client, prefix string) *RedisEventHub {
+	h := &RedisEventHub{client: client, prefix: prefix, local: NewMemoryEventHub()}
+
+	// the channel of the subscription reconnects on its own after Redis went away
+	pubsub := client.PSubscribe(prefix + "*")
+	go func() {
+		for msg := range pubsub.Channel() {
+			h.local.Publish(strings.TrimPrefix(msg.Channel, prefix), []byte(msg.Payload))
+		}
+		log.Print("event hub subscription closed")
+	}()
+	return h
+}
+
+// Publish : payloads come back to this instance through the subscription like to any other
+func (h *RedisEventHub) Publish(topic string, payload []byte) error {
+	return h.client.Publish(h.prefix+topic, string(payload)).Err()
+}
+
+func (h *RedisEventHub) Subscribe(topic string) (<-chan []byte, func()) {
+	return h.local.Subscribe(topic)
+}
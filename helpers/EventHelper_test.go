@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// receive : next payload of events, failing after a second
+func receive(t *testing.T, events <-chan []byte) string {
+	t.Helper()
+	select {
+	case payload, ok := <-events:
+		if !ok {
+			t.Fatal("channel closed")
+		}
+		return string(payload)
+	case <-time.After(time.Second):
+		t.Fatal("no payload received")
+	}
+	return ""
+}
+
+func TestMemoryEventHubPublishesToTopicSubscribers(t *testing.T) {
+	hub := NewMemoryEventHub()
+	first, cancelFirst := hub.Subscribe("serve:1")
+	defer cancelFirst()
+	second, cancelSecond := hub.Subscribe("serve:1")
+	defer cancelSecond()
+	other, cancelOther := hub.Subscribe("serve:2")
+	defer cancelOther()
+
+	if err := hub.Publish("serve:1", []byte("step-done")); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, first); got != "step-done" {
+		t.Errorf("first subscriber got %q, want step-done", got)
+	}
+	if got := receive(t, second); got != "step-done" {
+		t.Errorf("second subscriber got %q, want step-done", got)
+	}
+	select {
+	case payload := <-other:
+		t.Errorf("subscriber of another topic got %q", payload)
+	default:
+	}
+}
+
+func TestMemoryEventHubDropsForSlowSubscriber(t *testing.T) {
+	hub := NewMemoryEventHub()
+	slow, cancelSlow := hub.Subscribe("serve:1")
+	defer cancelSlow()
+	fast, cancelFast := hub.Subscribe("serve:1")
+	defer cancelFast()
+
+	// the slow subscriber reads nothing while twice its buffer is published
+	for i := 0; i < 2*eventBufferSize; i++ {
+		hub.Publish("serve:1", []byte(strconv.Itoa(i)))
+		if got := receive(t, fast); got != strconv.Itoa(i) {
+			t.Fatalf("fast subscriber got %q, want %d", got, i)
+		}
+	}
+
+	if len(slow) != eventBufferSize {
+		t.Fatalf("slow subscriber has %d payloads waiting, want %d", len(slow), eventBufferSize)
+	}
+	for i := 0; i < eventBufferSize; i++ {
+		if got := receive(t, slow); got != strconv.Itoa(i) {
+			t.Fatalf("slow subscriber got %q, want the oldest payloads kept", got)
+		}
+	}
+}
+
+func TestMemoryEventHubCancel(t *testing.T) {
+	hub := NewMemoryEventHub()
+	events, cancel := hub.Subscribe("serve:1")
+	cancel()
+	// cancel may be called again, e.g. deferred after an explicit call
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Error("channel still open after cancel")
+	}
+	if err := hub.Publish("serve:1", []byte("step-done")); err != nil {
+		t.Errorf("publishing without subscribers: %v", err)
+	}
+	if len(hub.subscribers) != 0 {
+		t.Errorf("%d topics left after the last subscriber cancelled", len(hub.subscribers))
+	}
+}
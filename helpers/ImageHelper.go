@@ -0,0 +1,155 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImageMaxPixels guards against decompression bombs, a small file may declare a huge canvas
+const ImageMaxPixels = 40 * 1000 * 1000
+
+var ErrUnsupportedImage = errors.New("unsupported image type, use jpeg, png or gif")
+
+// IMAGE_TYPES : sniffed content types accepted for uploads with the extension used to store them
+var IMAGE_TYPES = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// THUMBNAIL_SIZES : name and longest side in pixels of every thumbnail generated on upload
+var THUMBNAIL_SIZES = []struct {
+	Name string
+	Size int
+}{
+	{"small", 160},
+	{"medium", 480},
+	{"large", 1024},
+}
+
+// ThumbnailKey : thumbnails are stored next to the original image, imageKey "recipes/1/abc.png" has "recipes/1/abc_small.jpg"
+func ThumbnailKey(imageKey string, name string) string {
+	return strings.TrimSuffix(imageKey, path.Ext(imageKey)) + "_" + name + ".jpg"
+}
+
+// ImageMaxBytes : upload limit, IMAGE_MAX_BYTES defaults to 5 MiB
+func ImageMaxBytes() int64 {
+	size, err := strconv.ParseInt(os.Getenv("IMAGE_MAX_BYTES"), 10, 64)
+	if err != nil || size <= 0 {
+		return 5 << 20
+	}
+	return size
+}
+
+// SniffImage : content type from the file content, the name or header sent by the client is never trusted
+func SniffImage(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := IMAGE_TYPES[contentType]; !ok {
+		return "", ErrUnsupportedImage
+	}
+	return contentType, nil
+}
+
+// DecodeImage : decode data after checking its declared dimensions
+func DecodeImage(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > ImageMaxPixels {
+		return nil, errors.New("image dimensions are not supported")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Thumbnails : src scaled down for every THUMBNAIL_SIZES entry so its longest side is at most
+// the size, encoded as JPEG and keyed by name. Images already smaller are only re-encoded,
+// transparent areas become white. Only the largest thumbnail is scaled from src, every smaller
+// one from the one before it.
+func Thumbnails(src image.Image) (map[string][]byte, error) {
+	bounds := src.Bounds()
+	current := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(current, current.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(current, current.Bounds(), src, bounds.Min, draw.Over)
+
+	sizes := append(THUMBNAIL_SIZES[:0:0], THUMBNAIL_SIZES...)
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].Size > sizes[j].Size })
+
+	thumbnails := make(map[string][]byte, len(sizes))
+	for _, size := range sizes {
+		width, height := thumbnailBounds(bounds.Dx(), bounds.Dy(), size.Size)
+		current = resizeBox(current, width, height)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, current, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		thumbnails[size.Name] = buf.Bytes()
+	}
+	return thumbnails, nil
+}
+
+// thumbnailBounds : width and height scaled so the longest side is at most size
+func thumbnailBounds(width int, height int, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, maxInt(1, height*size/width)
+	}
+	return maxInt(1, width*size/height), size
+}
+
+// resizeBox : downscale by averaging every source pixel covered by a destination pixel
+func resizeBox(src *image.RGBA, width int, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	if srcWidth == width && srcHeight == height {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, maxInt((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, maxInt((x+1)*srcWidth/width, x*srcWidth/width+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[offset])
+					g += int(src.Pix[offset+1])
+					b += int(src.Pix[offset+2])
+					a += int(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
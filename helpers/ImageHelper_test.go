@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestThumbnails(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2000, 500))
+	for idx := range src.Pix {
+		src.Pix[idx] = 0x80
+	}
+	thumbnails, err := Thumbnails(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]image.Point{"small": {160, 40}, "medium": {480, 120}, "large": {1024, 256}}
+	for name, size := range want {
+		img, err := jpeg.Decode(bytes.NewReader(thumbnails[name]))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := img.Bounds().Size(); got != size {
+			t.Errorf("%s is %v, want %v", name, got, size)
+		}
+	}
+}
+
+func TestThumbnailsSmallImage(t *testing.T) {
+	// transparent pixels become white
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 60))
+	thumbnails, err := Thumbnails(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(thumbnails["small"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != (image.Point{100, 60}) {
+		t.Errorf("small is %v, want the original 100x60", got)
+	}
+	if r, g, b, _ := color.NRGBAModel.Convert(img.At(50, 30)).RGBA(); r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("transparent pixel became %d,%d,%d, want white", r>>8, g>>8, b>>8)
+	}
+}
@@ -0,0 +1,368 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nadhirfr/codefood/units"
+)
+
+// ParsedIngredient is one ingredient line split into its parts. ValueMax is set for ranges
+// such as "1-2 siung", Value then holds the lower bound. Unit is the canonical symbol of a
+// known unit, Note holds what follows a comma or sits in parentheses.
+type ParsedIngredient struct {
+	Raw      string  `json:"raw" example:"2 1/2 cups flour, sifted"`
+	Value    float64 `json:"value" example:"2.5"`
+	ValueMax float64 `json:"valueMax,omitempty" example:"0"`
+	Unit     string  `json:"unit" example:"cup"`
+	Item     string  `json:"item" example:"flour"`
+	Note     string  `json:"note,omitempty" example:"sifted"`
+}
+
+var ErrIngredientWithoutItem = errors.New("ingredient has no item")
+
+var unicodeFractions = map[rune]float64{
+	'½': 0.5, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 0.25, '¾': 0.75,
+	'⅕': 0.2, '⅖': 0.4, '⅗': 0.6, '⅘': 0.8, '⅙': 1.0 / 6, '⅚': 5.0 / 6,
+	'⅛': 0.125, '⅜': 0.375, '⅝': 0.625, '⅞': 0.875,
+}
+
+var numberWords = map[string]float64{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"half": 0.5, "quarter": 0.25, "dozen": 12,
+	"satu": 1, "dua": 2, "tiga": 3, "empat": 4, "lima": 5, "enam": 6, "tujuh": 7, "delapan": 8,
+	"sembilan": 9, "sepuluh": 10, "setengah": 0.5, "seperempat": 0.25, "sepertiga": 1.0 / 3,
+	"selusin": 12,
+}
+
+// number words that are also ingredient names, they only count as an amount before a unit
+var ambiguousNumberWords = map[string]bool{"lima": true}
+
+var rangeWords = map[string]bool{"-": true, "–": true, "—": true, "to": true, "or": true, "sampai": true, "hingga": true, "atau": true, "s/d": true}
+
+// amounts written without a number, kept as a note
+var amountNotes = []string{"secukupnya", "sesuai selera", "to taste", "as needed", "optional", "opsional"}
+
+// IngredientLines : non empty lines of text without list bullets
+func IngredientLines(text string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•·"))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// ParseIngredientLines : parse every ingredient line of text, failing on the first bad one
+func ParseIngredientLines(text string) ([]ParsedIngredient, error) {
+	parsed := []ParsedIngredient{}
+	for idx, line := range IngredientLines(text) {
+		ingredient, err := ParseIngredientLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("ingredient %d %q: %w", idx+1, line, err)
+		}
+		parsed = append(parsed, ingredient)
+	}
+	return parsed, nil
+}
+
+// ParseIngredientLine : split "2 1/2 cups flour, sifted", "3 butir telur" or
+// "1-2 cloves garlic (minced)" into amount, unit, item and note
+func ParseIngredientLine(line string) (ParsedIngredient, error) {
+	result := ParsedIngredient{Raw: strings.TrimSpace(line)}
+
+	rest, notes := extractNotes(result.Raw)
+	tokens := tokenizeIngredient(rest)
+
+	value, consumed := parseAmount(tokens)
+	if consumed == 1 && ambiguousNumberWords[strings.ToLower(tokens[0])] {
+		// "lima beans" are no five beans, only "lima siung" is
+		if _, n := parseUnit(tokens[1:]); n == 0 {
+			value, consumed = 0, 0
+		}
+	}
+	if consumed > 0 {
+		result.Value = value
+		tokens = tokens[consumed:]
+		if len(tokens) > 1 && rangeWords[strings.ToLower(tokens[0])] {
+			if upper, n := parseAmount(tokens[1:]); n > 0 {
+				result.ValueMax = upper
+				tokens = tokens[1+n:]
+			}
+		}
+	}
+
+	if unit, n := parseUnit(tokens); n > 0 {
+		result.Unit = unit
+		tokens = tokens[n:]
+		if consumed == 0 {
+			// "a pinch", "segelas"
+			result.Value = 1
+		}
+	} else if consumed == 0 && len(tokens) > 0 {
+		// Indonesian "se" means one: segelas, sesendok makan, secangkir
+		lower := strings.ToLower(tokens[0])
+		if strings.HasPrefix(lower, "se") && len(lower) > 2 {
+			if unit, n := parseUnit(append([]string{lower[2:]}, tokens[1:]...)); n > 0 {
+				result.Value = 1
+				result.Unit = unit
+				tokens = tokens[n:]
+			}
+		}
+	}
+
+	if consumed == 0 && result.Unit == "" {
+		// Indonesian lists often put the amount last, "bawang putih 3 siung"
+		tokens = parseTrailingAmount(tokens, &result)
+	}
+
+	if len(tokens) > 0 && strings.EqualFold(tokens[0], "of") {
+		tokens = tokens[1:]
+	}
+
+	result.Item = strings.TrimSpace(strings.Trim(strings.Join(tokens, " "), ",.;:"))
+	for _, note := range amountNotes {
+		if strings.HasSuffix(strings.ToLower(result.Item), " "+note) {
+			result.Item = strings.TrimSpace(result.Item[:len(result.Item)-len(note)])
+			notes = append(notes, note)
+		}
+	}
+	result.Note = strings.Join(notes, ", ")
+
+	if result.Item == "" {
+		return result, ErrIngredientWithoutItem
+	}
+	return result, nil
+}
+
+// parseTrailingAmount : take an amount followed by an optional unit off the end of tokens
+func parseTrailingAmount(tokens []string, result *ParsedIngredient) []string {
+	for start := len(tokens) - 1; start > 0; start-- {
+		value, consumed := parseAmount(tokens[start:])
+		if consumed == 0 {
+			continue
+		}
+		if _, isNumber := parseNumber(tokens[start]); !isNumber {
+			// number words at the end are part of the name
+			continue
+		}
+
+		rest := tokens[start+consumed:]
+		var valueMax float64
+		if len(rest) > 1 && rangeWords[strings.ToLower(rest[0])] {
+			if upper, n := parseAmount(rest[1:]); n > 0 {
+				valueMax = upper
+				rest = rest[1+n:]
+			}
+		}
+		unit, n := parseUnit(rest)
+		if len(rest) != n {
+			continue
+		}
+
+		// "telur 2-3 butir", the lower bound precedes
+		if valueMax == 0 && start >= 2 && rangeWords[strings.ToLower(tokens[start-1])] {
+			if lower, isNumber := parseNumber(tokens[start-2]); isNumber {
+				value, valueMax = lower, value
+				start -= 2
+			}
+		}
+
+		result.Value = value
+		result.ValueMax = valueMax
+		result.Unit = unit
+		return tokens[:start]
+	}
+	return tokens
+}
+
+// RecipeItem : item with its note, the way it is stored on a recipe ingredient
+func (p ParsedIngredient) RecipeItem() string {
+	if p.Note == "" {
+		return p.Item
+	}
+	return p.Item + ", " + p.Note
+}
+
+// IngredientKey : normalized name of the ingredient an item refers to, without its notes,
+// "Bawang Merah, iris tipis" and "bawang merah (besar)" both give "bawang merah"
+func IngredientKey(item string) string {
+	rest, _ := extractNotes(item)
+	return NormalizeIngredientItem(rest)
+}
+
+// IngredientName : item without its notes as written, the name of a new catalog ingredient
+func IngredientName(item string) string {
+	rest, _ := extractNotes(item)
+	return strings.Join(strings.Fields(rest), " ")
+}
+
+// extractNotes : remove parenthesised parts and everything after the first comma
+func extractNotes(line string) (string, []string) {
+	notes := []string{}
+	var sb strings.Builder
+	depth := 0
+	var note strings.Builder
+	for _, r := range line {
+		switch {
+		case r == '(':
+			depth++
+			if depth == 1 {
+				note.Reset()
+				continue
+			}
+		case r == ')' && depth > 0:
+			depth--
+			if depth == 0 {
+				if text := strings.TrimSpace(note.String()); text != "" {
+					notes = append(notes, text)
+				}
+				continue
+			}
+		}
+		if depth > 0 {
+			note.WriteRune(r)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+
+	rest := sb.String()
+	// a comma between digits is a decimal separator, "1,5 kg"
+	for idx, r := range rest {
+		if r != ',' {
+			continue
+		}
+		if idx > 0 && idx+1 < len(rest) && isDigitByte(rest[idx-1]) && isDigitByte(rest[idx+1]) {
+			continue
+		}
+		if text := strings.TrimSpace(rest[idx+1:]); text != "" {
+			notes = append([]string{text}, notes...)
+		}
+		rest = rest[:idx]
+		break
+	}
+	return strings.TrimSpace(rest), notes
+}
+
+func isDigitByte(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// tokenizeIngredient : split on spaces, separating numbers glued to units ("200g")
+// and dashes of ranges ("1-2")
+func tokenizeIngredient(text string) []string {
+	tokens := []string{}
+	for _, field := range strings.Fields(text) {
+		tokens = append(tokens, splitAmountToken(field)...)
+	}
+	return tokens
+}
+
+func splitAmountToken(field string) []string {
+	runes := []rune(field)
+	if len(runes) == 0 || !(unicode.IsDigit(runes[0]) || isUnicodeFraction(runes[0])) {
+		return []string{field}
+	}
+
+	idx := 0
+	for idx < len(runes) && (unicode.IsDigit(runes[idx]) || runes[idx] == '.' || runes[idx] == ',' || runes[idx] == '/' || isUnicodeFraction(runes[idx])) {
+		idx++
+	}
+	head := string(runes[:idx])
+	tail := string(runes[idx:])
+	if tail == "" {
+		return []string{head}
+	}
+	for _, dash := range []string{"-", "–", "—"} {
+		if strings.HasPrefix(tail, dash) {
+			rest := strings.TrimPrefix(tail, dash)
+			if rest == "" {
+				return []string{head, dash}
+			}
+			return append([]string{head, dash}, splitAmountToken(rest)...)
+		}
+	}
+	return []string{head, tail}
+}
+
+func isUnicodeFraction(r rune) bool {
+	_, ok := unicodeFractions[r]
+	return ok
+}
+
+// parseAmount : number at the start of tokens, "2", "2.5", "2,5", "1/2", "2 1/2", "2½", "½", "dua"
+func parseAmount(tokens []string) (float64, int) {
+	if len(tokens) == 0 {
+		return 0, 0
+	}
+	value, ok := parseNumber(tokens[0])
+	if !ok {
+		if word, ok := numberWords[strings.ToLower(tokens[0])]; ok {
+			return word, 1
+		}
+		return 0, 0
+	}
+	// mixed number, "2 1/2" or "2 ½"
+	if len(tokens) > 1 && value == float64(int(value)) && (strings.Contains(tokens[1], "/") || isSingleUnicodeFraction(tokens[1])) {
+		if fraction, ok := parseNumber(tokens[1]); ok && fraction < 1 {
+			return value + fraction, 2
+		}
+	}
+	return value, 1
+}
+
+func isSingleUnicodeFraction(token string) bool {
+	runes := []rune(token)
+	return len(runes) == 1 && isUnicodeFraction(runes[0])
+}
+
+func parseNumber(token string) (float64, bool) {
+	runes := []rune(token)
+	if len(runes) == 0 {
+		return 0, false
+	}
+
+	// trailing unicode fraction, "2½"
+	if fraction, ok := unicodeFractions[runes[len(runes)-1]]; ok {
+		if len(runes) == 1 {
+			return fraction, true
+		}
+		whole, ok := parseNumber(string(runes[:len(runes)-1]))
+		return whole + fraction, ok
+	}
+
+	if parts := strings.Split(token, "/"); len(parts) == 2 {
+		numerator, err1 := strconv.ParseFloat(parts[0], 64)
+		denominator, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil || denominator == 0 {
+			return 0, false
+		}
+		return numerator / denominator, true
+	}
+
+	value, err := strconv.ParseFloat(strings.Replace(token, ",", ".", 1), 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// parseUnit : known unit at the start of tokens, two word units ("sendok makan") first
+func parseUnit(tokens []string) (string, int) {
+	for n := 2; n >= 1; n-- {
+		if len(tokens) < n {
+			continue
+		}
+		candidate := strings.TrimRight(strings.Join(tokens[:n], " "), ".")
+		if unit, ok := units.Lookup(candidate); ok {
+			return unit.Symbol, n
+		}
+	}
+	return "", 0
+}
@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseIngredientLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want ParsedIngredient
+	}{
+		// English
+		{"2 1/2 cups flour, sifted", ParsedIngredient{Value: 2.5, Unit: "cup", Item: "flour", Note: "sifted"}},
+		{"2 ½ cups milk", ParsedIngredient{Value: 2.5, Unit: "cup", Item: "milk"}},
+		{"1-2 cloves garlic (minced)", ParsedIngredient{Value: 1, ValueMax: 2, Unit: "siung", Item: "garlic", Note: "minced"}},
+		{"2 to 3 tbsp olive oil", ParsedIngredient{Value: 2, ValueMax: 3, Unit: "tbsp", Item: "olive oil"}},
+		{"a pinch of salt", ParsedIngredient{Value: 1, Unit: "jumput", Item: "salt"}},
+		{"200g beef", ParsedIngredient{Value: 200, Unit: "g", Item: "beef"}},
+		{"salt to taste", ParsedIngredient{Item: "salt", Note: "to taste"}},
+		{"lima beans", ParsedIngredient{Item: "lima beans"}},
+		// Indonesian
+		{"3 butir telur", ParsedIngredient{Value: 3, Unit: "butir", Item: "telur"}},
+		{"½ sdt merica bubuk", ParsedIngredient{Value: 0.5, Unit: "sdt", Item: "merica bubuk"}},
+		{"1,5 kg ayam", ParsedIngredient{Value: 1.5, Unit: "kg", Item: "ayam"}},
+		{"1 sendok makan kecap manis", ParsedIngredient{Value: 1, Unit: "sdm", Item: "kecap manis"}},
+		{"setengah sdm gula pasir", ParsedIngredient{Value: 0.5, Unit: "sdm", Item: "gula pasir"}},
+		{"segelas air", ParsedIngredient{Value: 1, Unit: "gelas", Item: "air"}},
+		{"lima siung bawang merah", ParsedIngredient{Value: 5, Unit: "siung", Item: "bawang merah"}},
+		{"3 sampai 4 lembar daun salam", ParsedIngredient{Value: 3, ValueMax: 4, Unit: "lembar", Item: "daun salam"}},
+		{"bawang putih 3 siung", ParsedIngredient{Value: 3, Unit: "siung", Item: "bawang putih"}},
+		{"telur 2-3 butir", ParsedIngredient{Value: 2, ValueMax: 3, Unit: "butir", Item: "telur"}},
+		{"garam secukupnya", ParsedIngredient{Item: "garam", Note: "secukupnya"}},
+		{"gula pasir sesuai selera", ParsedIngredient{Item: "gula pasir", Note: "sesuai selera"}},
+		{"cabai rawit (opsional)", ParsedIngredient{Item: "cabai rawit", Note: "opsional"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseIngredientLine(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got.Value-tt.want.Value) > 1e-9 || math.Abs(got.ValueMax-tt.want.ValueMax) > 1e-9 ||
+				got.Unit != tt.want.Unit || got.Item != tt.want.Item || got.Note != tt.want.Note {
+				t.Errorf("got value %v max %v unit %q item %q note %q, want value %v max %v unit %q item %q note %q",
+					got.Value, got.ValueMax, got.Unit, got.Item, got.Note,
+					tt.want.Value, tt.want.ValueMax, tt.want.Unit, tt.want.Item, tt.want.Note)
+			}
+		})
+	}
+}
+
+func TestParseIngredientLineWithoutItem(t *testing.T) {
+	if _, err := ParseIngredientLine("2 sdm"); !errors.Is(err, ErrIngredientWithoutItem) {
+		t.Errorf("err = %v, want ErrIngredientWithoutItem", err)
+	}
+}
+
+func TestParseIngredientLines(t *testing.T) {
+	parsed, err := ParseIngredientLines("- 2 butir telur\n\n* garam secukupnya\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[0].Item != "telur" || parsed[1].Item != "garam" {
+		t.Errorf("parsed %+v", parsed)
+	}
+
+	if _, err := ParseIngredientLines("2 butir telur\n3 sdm"); err == nil {
+		t.Error("a line without item must fail")
+	}
+}
+
+func TestIngredientKey(t *testing.T) {
+	tests := map[string]string{
+		"Bawang Merah, iris tipis": "bawang merah",
+		"bawang merah (besar)":     "bawang merah",
+	}
+	for item, want := range tests {
+		if got := IngredientKey(item); got != want {
+			t.Errorf("IngredientKey(%q) = %q, want %q", item, got, want)
+		}
+	}
+}
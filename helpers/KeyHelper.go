@@ -0,0 +1,346 @@
+package helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ACCESS_KEYS signs access tokens and is published on the JWKS endpoint,
+// REFRESH_KEYS signs refresh tokens which only this service ever reads
+var ACCESS_KEYS *KeySet
+var REFRESH_KEYS *KeySet
+
+// SigningKey is one entry of a key set, SignKey is nil for verify-only keys
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// KeySet holds every key that may verify a token and the one used to sign new ones.
+// Rotating means adding a new key, making it the signing key and removing the old
+// one once every token it signed has expired.
+type KeySet struct {
+	keys       map[string]*SigningKey
+	signingKid string
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*SigningKey)}
+}
+
+func (ks *KeySet) Add(key *SigningKey) {
+	ks.keys[key.ID] = key
+}
+
+func (ks *KeySet) SetSigningKey(kid string) error {
+	key, ok := ks.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.SignKey == nil {
+		return fmt.Errorf("key %q has no private part", kid)
+	}
+	ks.signingKid = kid
+	return nil
+}
+
+func (ks *KeySet) SigningKey() (*SigningKey, error) {
+	key, ok := ks.keys[ks.signingKid]
+	if !ok {
+		return nil, errors.New("no signing key configured")
+	}
+	return key, nil
+}
+
+// Keys returns all keys ordered by kid
+func (ks *KeySet) Keys() []*SigningKey {
+	keys := make([]*SigningKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// Sign : sign claims with the current signing key, adding its kid to the header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key, err := ks.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SignKey)
+}
+
+// Keyfunc : pick the verification key by kid, the algorithm must match the key
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// tokens signed before key ids were introduced
+		kid = ks.signingKid
+	}
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %v", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.VerifyKey, nil
+}
+
+// KeysInit loads ACCESS_KEYS and REFRESH_KEYS from JWT_ACCESS_* and JWT_REFRESH_* variables
+func KeysInit() {
+	var err error
+	ACCESS_KEYS, err = LoadKeySet("JWT_ACCESS")
+	if err != nil {
+		panic(err)
+	}
+	REFRESH_KEYS, err = LoadKeySet("JWT_REFRESH")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LoadKeySet reads the keys configured under prefix:
+// - <prefix>_KEYS_DIR : directory of <kid>.pem (RSA, EC or Ed25519, private or public) and <kid>.key (HMAC secret) files
+// - <prefix>_SECRET : a single HMAC secret with kid "default", ignored when <prefix>_KEYS_DIR is set
+// - <prefix>_SIGNING_KID : kid used for signing, defaults to the highest kid having a private part
+// Without any configuration a random HMAC secret is generated, tokens then do not survive a restart.
+func LoadKeySet(prefix string) (*KeySet, error) {
+	ks := NewKeySet()
+
+	dir := os.Getenv(prefix + "_KEYS_DIR")
+	if dir != "" {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			ext := filepath.Ext(file.Name())
+			if file.IsDir() || (ext != ".pem" && ext != ".key") {
+				continue
+			}
+			raw, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			kid := strings.TrimSuffix(file.Name(), ext)
+			var key *SigningKey
+			if ext == ".key" {
+				key = hmacKey(kid, []byte(strings.TrimSpace(string(raw))))
+			} else if key, err = parsePemKey(kid, raw); err != nil {
+				return nil, fmt.Errorf("%s: %v", file.Name(), err)
+			}
+			ks.Add(key)
+		}
+	}
+
+	// a leftover secret next to a key directory would let anyone knowing it sign tokens
+	if secret := os.Getenv(prefix + "_SECRET"); secret != "" {
+		if dir != "" {
+			log.Printf("%s_KEYS_DIR is set, ignoring %s_SECRET", prefix, prefix)
+		} else {
+			ks.Add(hmacKey("default", []byte(secret)))
+		}
+	}
+
+	if len(ks.keys) == 0 {
+		log.Printf("%s_KEYS_DIR and %s_SECRET are not set, using a random secret", prefix, prefix)
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		ks.Add(hmacKey("default", secret))
+	}
+
+	kid := os.Getenv(prefix + "_SIGNING_KID")
+	if kid == "" {
+		for _, key := range ks.Keys() {
+			if key.SignKey != nil {
+				kid = key.ID
+			}
+		}
+	}
+	if err := ks.SetSigningKey(kid); err != nil {
+		return nil, fmt.Errorf("%s: %v", prefix, err)
+	}
+	return ks, nil
+}
+
+func hmacKey(kid string, secret []byte) *SigningKey {
+	return &SigningKey{ID: kid, Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}
+}
+
+func parsePemKey(kid string, raw []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.SignKey, key.VerifyKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.VerifyKey = jwt.SigningMethodRS256, k
+	case *ecdsa.PrivateKey:
+		key.Method, key.SignKey, key.VerifyKey = ecdsaMethod(k.Curve), k, &k.PublicKey
+	case *ecdsa.PublicKey:
+		key.Method, key.VerifyKey = ecdsaMethod(k.Curve), k
+	case ed25519.PrivateKey:
+		key.Method, key.SignKey, key.VerifyKey = SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.VerifyKey = SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	if key.Method == nil {
+		return nil, errors.New("unsupported elliptic curve")
+	}
+	return key, nil
+}
+
+func ecdsaMethod(curve elliptic.Curve) jwt.SigningMethod {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256
+	case elliptic.P384():
+		return jwt.SigningMethodES384
+	case elliptic.P521():
+		return jwt.SigningMethodES512
+	}
+	return nil
+}
+
+//* EdDSA, jwt-go v3 only ships HMAC, RSA and ECDSA
+
+type signingMethodEdDSA struct{}
+
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+//* JWKS
+
+// JWK is the public part of a key as described in RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS returns the public keys of ks, HMAC keys are never published
+func (ks *KeySet) JWKS() []JWK {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := []JWK{}
+	for _, key := range ks.Keys() {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch k := key.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = b64(k.N.Bytes())
+			jwk.E = b64(big.NewInt(int64(k.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (k.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = k.Curve.Params().Name
+			jwk.X = b64(padBytes(k.X.Bytes(), size))
+			jwk.Y = b64(padBytes(k.Y.Bytes(), size))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = b64(k)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
@@ -0,0 +1,59 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKeySetIgnoresSecretWithKeysDir(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "2021-01.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TEST_KEYS_DIR", dir)
+	t.Setenv("TEST_SECRET", "change-me")
+	ks, err := LoadKeySet("TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.Keys()) != 1 {
+		t.Fatalf("loaded %d keys, want only the key of the directory", len(ks.Keys()))
+	}
+	key, err := ks.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != "2021-01" || key.Method.Alg() != "EdDSA" {
+		t.Errorf("signing key = %s %s, want 2021-01 EdDSA", key.ID, key.Method.Alg())
+	}
+}
+
+func TestLoadKeySetSecret(t *testing.T) {
+	t.Setenv("TEST_KEYS_DIR", "")
+	t.Setenv("TEST_SECRET", "a-secret")
+	ks, err := LoadKeySet("TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ks.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != "default" || string(key.SignKey.([]byte)) != "a-secret" {
+		t.Errorf("signing key = %s, want the secret as default", key.ID)
+	}
+}
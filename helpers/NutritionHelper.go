@@ -0,0 +1,179 @@
+package helpers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/nadhirfr/codefood/units"
+)
+
+//go:embed data/foods.json
+var foodsJSON []byte
+
+var foods []Food
+var foodsByID map[string]*Food
+var foodAliases []foodAlias
+
+type foodAlias struct {
+	alias string
+	food  *Food
+}
+
+func init() {
+	var dataset struct {
+		Foods []Food `json:"foods"`
+	}
+	if err := json.Unmarshal(foodsJSON, &dataset); err != nil {
+		panic(err)
+	}
+
+	foods = dataset.Foods
+	foodsByID = make(map[string]*Food, len(foods))
+	for idx := range foods {
+		food := &foods[idx]
+		foodsByID[food.ID] = food
+		for _, alias := range append([]string{food.Name, food.NameEn}, food.Aliases...) {
+			if normalized := NormalizeIngredientItem(alias); normalized != "" {
+				foodAliases = append(foodAliases, foodAlias{alias: normalized, food: food})
+			}
+		}
+	}
+	// longest alias first so "dada ayam" wins over "ayam"
+	sort.SliceStable(foodAliases, func(i, j int) bool { return len(foodAliases[i].alias) > len(foodAliases[j].alias) })
+}
+
+// Food is an entry of the bundled food composition dataset, nutrients are per 100 g
+type Food struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	NameEn       string   `json:"nameEn"`
+	Aliases      []string `json:"aliases"`
+	Energy       float64  `json:"energy"`
+	Protein      float64  `json:"protein"`
+	Fat          float64  `json:"fat"`
+	Carbohydrate float64  `json:"carbohydrate"`
+	Fiber        float64  `json:"fiber"`
+	// Density in g/ml, used for ingredients measured by volume
+	Density float64 `json:"density,omitempty"`
+	// PieceGrams is the weight of one piece (butir, siung, buah, ...)
+	PieceGrams float64 `json:"pieceGrams,omitempty"`
+}
+
+// Nutrients : energy in kcal, the rest in grams
+type Nutrients struct {
+	Energy       float64 `json:"energy" example:"250.5"`
+	Protein      float64 `json:"protein" example:"12.3"`
+	Fat          float64 `json:"fat" example:"8.1"`
+	Carbohydrate float64 `json:"carbohydrate" example:"30.2"`
+	Fiber        float64 `json:"fiber" example:"2.4"`
+}
+
+// NutrientsOf : nutrients in grams of food
+func NutrientsOf(food Food, grams float64) Nutrients {
+	factor := grams / 100
+	return Nutrients{
+		Energy:       food.Energy * factor,
+		Protein:      food.Protein * factor,
+		Fat:          food.Fat * factor,
+		Carbohydrate: food.Carbohydrate * factor,
+		Fiber:        food.Fiber * factor,
+	}
+}
+
+func (n Nutrients) Add(other Nutrients) Nutrients {
+	return Nutrients{
+		Energy:       n.Energy + other.Energy,
+		Protein:      n.Protein + other.Protein,
+		Fat:          n.Fat + other.Fat,
+		Carbohydrate: n.Carbohydrate + other.Carbohydrate,
+		Fiber:        n.Fiber + other.Fiber,
+	}
+}
+
+func (n Nutrients) Scale(factor float64) Nutrients {
+	return Nutrients{
+		Energy:       n.Energy * factor,
+		Protein:      n.Protein * factor,
+		Fat:          n.Fat * factor,
+		Carbohydrate: n.Carbohydrate * factor,
+		Fiber:        n.Fiber * factor,
+	}
+}
+
+// Rounded : one decimal is plenty for values that are estimates anyway
+func (n Nutrients) Rounded() Nutrients {
+	return Nutrients{
+		Energy:       roundTo(n.Energy, 1),
+		Protein:      roundTo(n.Protein, 1),
+		Fat:          roundTo(n.Fat, 1),
+		Carbohydrate: roundTo(n.Carbohydrate, 1),
+		Fiber:        roundTo(n.Fiber, 1),
+	}
+}
+
+// Foods : the dataset, filtered by q on names and aliases when given
+func Foods(q string) []Food {
+	q = NormalizeIngredientItem(q)
+	result := []Food{}
+	for _, food := range foods {
+		if q == "" || strings.Contains(NormalizeIngredientItem(strings.Join(append([]string{food.Name, food.NameEn}, food.Aliases...), " ")), q) {
+			result = append(result, food)
+		}
+	}
+	return result
+}
+
+func FindFood(id string) (Food, bool) {
+	food, ok := foodsByID[id]
+	if !ok {
+		return Food{}, false
+	}
+	return *food, true
+}
+
+// MatchFood : food whose name or alias appears as whole words in item, the longest alias wins
+func MatchFood(item string) (Food, bool) {
+	normalized := " " + NormalizeIngredientItem(item) + " "
+	for _, candidate := range foodAliases {
+		if strings.Contains(normalized, " "+candidate.alias+" ") {
+			return *candidate.food, true
+		}
+	}
+	return Food{}, false
+}
+
+// NormalizeIngredientItem : lower case words without punctuation, used to compare ingredient names
+func NormalizeIngredientItem(item string) string {
+	fields := strings.FieldsFunc(strings.ToLower(item), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	return strings.Join(fields, " ")
+}
+
+// IngredientGrams : weight of value unit of food, false when the unit can not be converted.
+// Volumes use the density of the food (water when unknown), pieces its usual piece weight.
+func IngredientGrams(value float64, unit string, food Food) (float64, bool) {
+	base, dimension, ok := units.Quantity{Value: value, Unit: unit}.Base()
+	switch {
+	case ok && dimension == units.MASS:
+		return base, true
+	case ok && dimension == units.VOLUME:
+		density := food.Density
+		if density == 0 {
+			density = 1
+		}
+		return base * density, true
+	case (ok && dimension == units.COUNT || strings.TrimSpace(unit) == "") && food.PieceGrams > 0:
+		return value * food.PieceGrams, true
+	}
+	return 0, false
+}
+
+func roundTo(value float64, decimals int) float64 {
+	pow := math.Pow(10, float64(decimals))
+	return math.Round(value*pow) / pow
+}
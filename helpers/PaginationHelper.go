@@ -0,0 +1,238 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SortField : what a sort key of a list endpoint orders by. Column is never taken from the
+// request, only the keys of the whitelist passed to ParsePagination are.
+type SortField struct {
+	Column string
+	Desc   bool
+	// Time tells the cursor its values are timestamps
+	Time bool
+}
+
+// Pagination : page of a list endpoint read from the sort, limit, skip and cursor query
+// parameters. Rows are ordered by the sort field and then by id, so rows with equal values
+// keep their order from page to page.
+type Pagination struct {
+	Sort   string
+	Field  SortField
+	Limit  int
+	Skip   int
+	cursor *pageCursor
+}
+
+// pageCursor : position in a listing, the values of the row the next page starts after
+// (or the previous page ends before). Clients get it base64 encoded and must not parse it.
+type pageCursor struct {
+	Sort   string          `json:"s"`
+	Value  json.RawMessage `json:"v"`
+	ID     uint            `json:"i"`
+	Before bool            `json:"b,omitempty"`
+	Limit  int             `json:"l,omitempty"`
+}
+
+// PageCursors : cursors of the pages around the returned one, empty when there is none
+type PageCursors struct {
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("cursor is invalid")
+
+// ParsePagination : sort must be a key of sorts, defaultSort is used without one. Without
+// limit every row is returned at once and there are no cursors. A cursor carries the sort
+// and limit of the page it came from, so following nextCursor alone is enough.
+func ParsePagination(c *gin.Context, sorts map[string]SortField, defaultSort string) (Pagination, error) {
+	p := Pagination{Sort: c.DefaultQuery("sort", defaultSort)}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		decoded, err := decodePageCursor(cursor)
+		if err != nil {
+			return p, err
+		}
+		if c.Query("sort") != "" && c.Query("sort") != decoded.Sort {
+			return p, errors.New("cursor does not match sort")
+		}
+		p.Sort = decoded.Sort
+		p.Limit = decoded.Limit
+		p.cursor = &decoded
+	}
+
+	field, ok := sorts[p.Sort]
+	if !ok {
+		return p, errors.New("sort must be one of " + strings.Join(SortKeys(sorts), ", "))
+	}
+	p.Field = field
+
+	if limit := c.Query("limit"); limit != "" {
+		limit_int64, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || limit_int64 < 0 {
+			return p, errors.New("limit is invalid")
+		}
+		p.Limit = int(limit_int64)
+	}
+	if skip := c.Query("skip"); skip != "" && p.cursor == nil {
+		skip_int64, err := strconv.ParseInt(skip, 10, 64)
+		if err != nil || skip_int64 < 0 {
+			return p, errors.New("skip is invalid")
+		}
+		p.Skip = int(skip_int64)
+	}
+	return p, nil
+}
+
+// SortKeys : keys of sorts in alphabetical order, for error messages and docs
+func SortKeys(sorts map[string]SortField) []string {
+	keys := make([]string, 0, len(sorts))
+	for key := range sorts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Apply : order query by the sort field and idColumn and select the rows of the page. One row
+// more than the limit is fetched, Finish uses it to know whether there is a next page.
+func (p Pagination) Apply(query *gorm.DB, idColumn string) (*gorm.DB, error) {
+	desc := p.Field.Desc
+	if p.cursor != nil && p.cursor.Before {
+		// a previous page is read backwards from the cursor and turned around by Finish
+		desc = !desc
+	}
+
+	if p.cursor != nil {
+		value, err := p.cursorValue()
+		if err != nil {
+			return query, err
+		}
+		operator := ">"
+		if desc {
+			operator = "<"
+		}
+		query = query.Where("("+p.Field.Column+" "+operator+" ? OR ("+p.Field.Column+" = ? AND "+idColumn+" "+operator+" ?))", value, value, p.cursor.ID)
+	}
+
+	direction := " asc"
+	if desc {
+		direction = " desc"
+	}
+	query = query.Order(p.Field.Column + direction).Order(idColumn + direction)
+
+	if p.Limit > 0 {
+		query = query.Limit(p.Limit + 1)
+	}
+	if p.Skip > 0 {
+		query = query.Offset(p.Skip)
+	}
+	return query, nil
+}
+
+func (p Pagination) cursorValue() (interface{}, error) {
+	if p.Field.Time {
+		var value time.Time
+		if err := json.Unmarshal(p.cursor.Value, &value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return value, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(p.cursor.Value, &value); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	switch value.(type) {
+	case string, float64:
+		return value, nil
+	}
+	return nil, ErrInvalidCursor
+}
+
+// Finish : drop the extra row Apply fetched from rows (a pointer to a slice), put the rows of a
+// previous page back in order and set the Link header. key gives the sort value and the id of
+// the i-th row.
+func (p Pagination) Finish(c *gin.Context, rows interface{}, key func(i int) (interface{}, uint)) PageCursors {
+	slice := reflect.ValueOf(rows).Elem()
+	backward := p.cursor != nil && p.cursor.Before
+
+	more := false
+	if p.Limit > 0 && slice.Len() > p.Limit {
+		more = true
+		slice.Set(slice.Slice(0, p.Limit))
+	}
+	if backward {
+		swap := reflect.Swapper(slice.Interface())
+		for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	cursors := PageCursors{}
+	if p.Limit == 0 || slice.Len() == 0 {
+		return cursors
+	}
+
+	hasNext, hasPrev := more, p.cursor != nil || p.Skip > 0
+	if backward {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		value, id := key(slice.Len() - 1)
+		cursors.NextCursor = p.encodeCursor(value, id, false)
+	}
+	if hasPrev {
+		value, id := key(0)
+		cursors.PrevCursor = p.encodeCursor(value, id, true)
+	}
+
+	links := []string{}
+	if cursors.NextCursor != "" {
+		links = append(links, "<"+cursorURL(c, cursors.NextCursor)+`>; rel="next"`)
+	}
+	if cursors.PrevCursor != "" {
+		links = append(links, "<"+cursorURL(c, cursors.PrevCursor)+`>; rel="prev"`)
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+	return cursors
+}
+
+func (p Pagination) encodeCursor(value interface{}, id uint, before bool) string {
+	raw, _ := json.Marshal(value)
+	encoded, _ := json.Marshal(pageCursor{Sort: p.Sort, Value: raw, ID: id, Before: before, Limit: p.Limit})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodePageCursor(cursor string) (pageCursor, error) {
+	var decoded pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return decoded, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil || decoded.Value == nil {
+		return decoded, ErrInvalidCursor
+	}
+	return decoded, nil
+}
+
+// cursorURL : the request URL moved to cursor, the other query parameters (filters) are kept
+func cursorURL(c *gin.Context, cursor string) string {
+	query := c.Request.URL.Query()
+	query.Del("skip")
+	query.Del("sort")
+	query.Del("limit")
+	query.Set("cursor", cursor)
+	return c.Request.URL.Path + "?" + query.Encode()
+}
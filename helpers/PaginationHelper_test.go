@@ -0,0 +1,316 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var pageTestSorts = map[string]SortField{
+	"name":    {Column: "name"},
+	"newest":  {Column: "created_at", Desc: true, Time: true},
+	"score":   {Column: "score", Desc: true},
+	"default": {Column: "id"},
+}
+
+type pageTestRow struct {
+	ID        uint
+	Name      string
+	Score     float64
+	CreatedAt time.Time
+}
+
+func pageTestKey(rows []pageTestRow) func(i int) (interface{}, uint) {
+	return func(i int) (interface{}, uint) {
+		return rows[i].Name, rows[i].ID
+	}
+}
+
+// pageTestContext : gin context of a GET request with query
+func pageTestContext(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/rows?"+query, nil)
+	return c
+}
+
+// dryRunDB : database that only builds statements, for queries that are never sent
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "test@tcp(127.0.0.1:1)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// pageTestSQL : the statement Apply builds for a page of rows
+func pageTestSQL(t *testing.T, p Pagination) string {
+	t.Helper()
+	query, err := p.Apply(dryRunDB(t).Table("rows"), "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []pageTestRow
+	statement := query.Find(&rows).Statement
+	return dryRunDB(t).Dialector.Explain(statement.SQL.String(), statement.Vars...)
+}
+
+// listPageTestRows : a list endpoint the way the controllers paginate, query is given the page
+func listPageTestRows(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := ParsePagination(c, pageTestSorts, "name")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		query, err := page.Apply(db.Model(&pageTestRow{}), "id")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		var rows []pageTestRow
+		if err := query.Find(&rows).Error; err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		cursors := page.Finish(c, &rows, pageTestKey(rows))
+		c.JSON(http.StatusOK, gin.H{"rows": rows, "nextCursor": cursors.NextCursor, "prevCursor": cursors.PrevCursor})
+	}
+}
+
+func TestPaginationCursorRoundTrip(t *testing.T) {
+	c := pageTestContext("sort=name&limit=2")
+	page, err := ParsePagination(c, pageTestSorts, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []pageTestRow{{ID: 4, Name: "ayam"}, {ID: 2, Name: "bebek"}, {ID: 9, Name: "cumi"}}
+	cursors := page.Finish(c, &rows, pageTestKey(rows))
+	if len(rows) != 2 || cursors.NextCursor == "" || cursors.PrevCursor != "" {
+		t.Fatalf("first page = %v, %+v, want 2 rows and only a next cursor", rows, cursors)
+	}
+
+	// the cursor alone brings back sort and limit
+	next, err := ParsePagination(pageTestContext("cursor="+cursors.NextCursor), pageTestSorts, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Sort != "name" || next.Limit != 2 || next.Skip != 0 {
+		t.Errorf("next page = sort %q, limit %d, skip %d, want name, 2, 0", next.Sort, next.Limit, next.Skip)
+	}
+	want := "SELECT * FROM `rows` WHERE (name > 'bebek' OR (name = 'bebek' AND id > 2)) ORDER BY name asc,id asc LIMIT 3"
+	if got := pageTestSQL(t, next); got != want {
+		t.Errorf("next page SQL = %s, want %s", got, want)
+	}
+
+	// timestamps survive the cursor
+	created := time.Date(2021, 4, 12, 0, 39, 11, 0, time.UTC)
+	page, _ = ParsePagination(pageTestContext("sort=newest&limit=1"), pageTestSorts, "default")
+	rows = []pageTestRow{{ID: 5, CreatedAt: created}, {ID: 3, CreatedAt: created}}
+	cursors = page.Finish(pageTestContext(""), &rows, func(i int) (interface{}, uint) { return rows[i].CreatedAt, rows[i].ID })
+	next, err = ParsePagination(pageTestContext("cursor="+cursors.NextCursor), pageTestSorts, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := next.cursorValue(); err != nil || !value.(time.Time).Equal(created) {
+		t.Errorf("cursor value = %v, %v, want %v", value, err, created)
+	}
+}
+
+func TestPaginationInvalidCursor(t *testing.T) {
+	cursor := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	valid := cursor(`{"s":"name","v":"bebek","i":2,"l":2}`)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"not base64", "cursor=" + url.QueryEscape("not a cursor!")},
+		{"not JSON", "cursor=" + cursor("bebek")},
+		{"no value", "cursor=" + cursor(`{"s":"name","i":2,"l":2}`)},
+		{"unknown sort", "cursor=" + cursor(`{"s":"password","v":"x","i":2,"l":2}`)},
+		{"object value", "cursor=" + cursor(`{"s":"name","v":{"or":1},"i":2,"l":2}`)},
+		{"not a time", "cursor=" + cursor(`{"s":"newest","v":"yesterday","i":2,"l":2}`)},
+		{"other sort", "sort=score&cursor=" + valid},
+		{"bad limit", "limit=-1"},
+		{"unknown sort parameter", "sort=password"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/rows", listPageTestRows(dryRunDB(t)))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rows?"+tt.query, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("GET /rows?%s = %d, want %d", tt.query, rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestPaginationPrevCursor(t *testing.T) {
+	// second page, ayam and bebek come before it
+	page, _ := ParsePagination(pageTestContext("sort=name&limit=2"), pageTestSorts, "default")
+	first := []pageTestRow{{ID: 4, Name: "ayam"}, {ID: 2, Name: "bebek"}, {ID: 9, Name: "cumi"}}
+	cursors := page.Finish(pageTestContext(""), &first, pageTestKey(first))
+	page, _ = ParsePagination(pageTestContext("cursor="+cursors.NextCursor), pageTestSorts, "default")
+	second := []pageTestRow{{ID: 9, Name: "cumi"}, {ID: 1, Name: "domba"}}
+	cursors = page.Finish(pageTestContext(""), &second, pageTestKey(second))
+	if cursors.PrevCursor == "" {
+		t.Fatal("second page has no prev cursor")
+	}
+
+	prev, err := ParsePagination(pageTestContext("cursor="+cursors.PrevCursor), pageTestSorts, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT * FROM `rows` WHERE (name < 'cumi' OR (name = 'cumi' AND id < 9)) ORDER BY name desc,id desc LIMIT 3"
+	if got := pageTestSQL(t, prev); got != want {
+		t.Errorf("prev page SQL = %s, want %s", got, want)
+	}
+
+	// read backwards the rows come in reverse, Finish turns the page around
+	rows := []pageTestRow{{ID: 2, Name: "bebek"}, {ID: 4, Name: "ayam"}}
+	cursors = prev.Finish(pageTestContext(""), &rows, pageTestKey(rows))
+	if rows[0].Name != "ayam" || rows[1].Name != "bebek" {
+		t.Errorf("prev page = %v, want ayam, bebek", rows)
+	}
+	if cursors.NextCursor == "" || cursors.PrevCursor != "" {
+		t.Errorf("cursors of the first page = %+v, want only a next cursor", cursors)
+	}
+}
+
+func TestPaginationLinkHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		rows  int
+		want  []string
+	}{
+		{"first page", "sort=name&limit=2&categoryId=3", 3, []string{"next"}},
+		{"middle page", "sort=name&limit=2&skip=2&categoryId=3", 3, []string{"next", "prev"}},
+		{"last page", "sort=name&limit=2&skip=4&categoryId=3", 2, []string{"prev"}},
+		{"only page", "sort=name&limit=2&categoryId=3", 2, nil},
+		{"no limit", "sort=name", 3, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := pageTestContext(tt.query)
+			page, err := ParsePagination(c, pageTestSorts, "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows := []pageTestRow{{ID: 1, Name: "ayam"}, {ID: 2, Name: "bebek"}, {ID: 3, Name: "cumi"}}[:tt.rows]
+			page.Finish(c, &rows, pageTestKey(rows))
+
+			link := c.Writer.Header().Get("Link")
+			var got []string
+			for _, part := range strings.Split(link, ", ") {
+				if part == "" {
+					continue
+				}
+				if !strings.HasPrefix(part, "</rows?") || !strings.Contains(part, "categoryId=3") || strings.Contains(part, "skip=") {
+					t.Errorf("link %s does not keep the filters of /rows", part)
+				}
+				got = append(got, strings.TrimSuffix(part[strings.Index(part, `rel="`)+5:], `"`))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Link = %q, want rels %v", link, tt.want)
+			}
+		})
+	}
+}
+
+// TestPaginationWalk : every row once going forward page by page and the same pages going
+// back, run against the database in MYSQL_TEST_HOST and skipped without it
+func TestPaginationWalk(t *testing.T) {
+	host := os.Getenv("MYSQL_TEST_HOST")
+	if host == "" {
+		t.Skip("MYSQL_TEST_HOST is not set")
+	}
+	db, err := gorm.Open(mysql.New(DbURL(&DBConfig{
+		Host:     host,
+		Port:     envOrDefault("MYSQL_TEST_PORT", "3306"),
+		User:     os.Getenv("MYSQL_TEST_USER"),
+		Password: os.Getenv("MYSQL_TEST_PASSWORD"),
+		DBName:   os.Getenv("MYSQL_TEST_DBNAME"),
+	})), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Migrator().DropTable(&pageTestRow{})
+	if err := db.AutoMigrate(&pageTestRow{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Migrator().DropTable(&pageTestRow{}) })
+	// equal names are told apart by id
+	for _, name := range []string{"cumi", "ayam", "bebek", "ayam", "domba", "bebek", "elang"} {
+		db.Create(&pageTestRow{Name: name})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/rows", listPageTestRows(db))
+	get := func(query string) (names []string, next string, prev string) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rows?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /rows?%s = %d %s", query, rec.Code, rec.Body)
+		}
+		var body struct {
+			Rows       []pageTestRow
+			NextCursor string
+			PrevCursor string
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		for _, row := range body.Rows {
+			names = append(names, fmt.Sprintf("%s#%d", row.Name, row.ID))
+		}
+		return names, body.NextCursor, body.PrevCursor
+	}
+
+	var pages [][]string
+	var prevs []string
+	query := "sort=name&limit=3"
+	for {
+		names, next, prev := get(query)
+		pages = append(pages, names)
+		prevs = append(prevs, prev)
+		if next == "" {
+			break
+		}
+		query = "cursor=" + next
+	}
+	want := "[[ayam#2 ayam#4 bebek#3] [bebek#6 cumi#1 domba#5] [elang#7]]"
+	if fmt.Sprint(pages) != want {
+		t.Fatalf("pages = %v, want %s", pages, want)
+	}
+	if prevs[0] != "" {
+		t.Errorf("first page has a prev cursor")
+	}
+
+	for idx := len(pages) - 1; idx > 0; idx-- {
+		names, _, _ := get("cursor=" + prevs[idx])
+		if fmt.Sprint(names) != fmt.Sprint(pages[idx-1]) {
+			t.Errorf("page before %v = %v, want %v", pages[idx], names, pages[idx-1])
+		}
+	}
+}
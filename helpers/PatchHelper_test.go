@@ -0,0 +1,145 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const patchTestDoc = `{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk"], "meta": {"level": "mudah"}}`
+
+// canonicalJSON : raw with sorted keys and no spacing, so equal documents compare equal as strings
+func canonicalJSON(t *testing.T, raw string) string {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		t.Fatalf("invalid JSON %s: %v", raw, err)
+	}
+	canonical, _ := json.Marshal(value)
+	return string(canonical)
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{"add member", `[{"op": "add", "path": "/tags", "value": ["pedas"]}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk"], "meta": {"level": "mudah"}, "tags": ["pedas"]}`, false},
+		{"add replaces member", `[{"op": "add", "path": "/name", "value": "Mie goreng"}]`,
+			`{"name": "Mie goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk"], "meta": {"level": "mudah"}}`, false},
+		{"add inserts at index", `[{"op": "add", "path": "/steps/1", "value": "kocok"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "kocok", "aduk"], "meta": {"level": "mudah"}}`, false},
+		{"add at length", `[{"op": "add", "path": "/steps/2", "value": "sajikan"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk", "sajikan"], "meta": {"level": "mudah"}}`, false},
+		{"add appends with -", `[{"op": "add", "path": "/steps/-", "value": "sajikan"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk", "sajikan"], "meta": {"level": "mudah"}}`, false},
+		{"add out of range", `[{"op": "add", "path": "/steps/3", "value": "sajikan"}]`, "", true},
+		{"add with leading zero", `[{"op": "add", "path": "/steps/01", "value": "sajikan"}]`, "", true},
+		{"add without value", `[{"op": "add", "path": "/tags"}]`, "", true},
+		{"add under missing parent", `[{"op": "add", "path": "/missing/tags", "value": []}]`, "", true},
+		{"remove member", `[{"op": "remove", "path": "/meta"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk"]}`, false},
+		{"remove index", `[{"op": "remove", "path": "/steps/0"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["aduk"], "meta": {"level": "mudah"}}`, false},
+		{"remove out of range", `[{"op": "remove", "path": "/steps/2"}]`, "", true},
+		{"remove - is no index", `[{"op": "remove", "path": "/steps/-"}]`, "", true},
+		{"remove missing member", `[{"op": "remove", "path": "/tags"}]`, "", true},
+		{"replace member", `[{"op": "replace", "path": "/meta/level", "value": "sulit"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk"], "meta": {"level": "sulit"}}`, false},
+		{"replace index", `[{"op": "replace", "path": "/steps/1", "value": "sajikan"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "sajikan"], "meta": {"level": "mudah"}}`, false},
+		{"replace missing member", `[{"op": "replace", "path": "/tags", "value": []}]`, "", true},
+		{"replace escaped /", `[{"op": "replace", "path": "/a~1b", "value": 3}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 3, "m~n": 2, "steps": ["tumis", "aduk"], "meta": {"level": "mudah"}}`, false},
+		{"replace escaped ~", `[{"op": "replace", "path": "/m~0n", "value": 4}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 4, "steps": ["tumis", "aduk"], "meta": {"level": "mudah"}}`, false},
+		{"replace whole document", `[{"op": "replace", "path": "", "value": {"name": "Mie"}}]`, `{"name": "Mie"}`, false},
+		{"move index", `[{"op": "move", "from": "/steps/1", "path": "/steps/0"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["aduk", "tumis"], "meta": {"level": "mudah"}}`, false},
+		{"move to end", `[{"op": "move", "from": "/steps/0", "path": "/steps/-"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["aduk", "tumis"], "meta": {"level": "mudah"}}`, false},
+		{"move member", `[{"op": "move", "from": "/meta/level", "path": "/level"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk"], "meta": {}, "level": "mudah"}`, false},
+		{"move into own child", `[{"op": "move", "from": "/meta", "path": "/meta/inner"}]`, "", true},
+		{"move missing member", `[{"op": "move", "from": "/tags", "path": "/labels"}]`, "", true},
+		{"copy", `[{"op": "copy", "from": "/meta", "path": "/copied"}, {"op": "replace", "path": "/copied/level", "value": "sulit"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk"], "meta": {"level": "mudah"}, "copied": {"level": "sulit"}}`, false},
+		{"copy into array", `[{"op": "copy", "from": "/steps/0", "path": "/steps/-"}]`,
+			`{"name": "Nasi goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk", "tumis"], "meta": {"level": "mudah"}}`, false},
+		{"test passes", `[{"op": "test", "path": "/steps", "value": ["tumis", "aduk"]}, {"op": "replace", "path": "/name", "value": "Mie goreng"}]`,
+			`{"name": "Mie goreng", "nServing": 2, "a/b": 1, "m~n": 2, "steps": ["tumis", "aduk"], "meta": {"level": "mudah"}}`, false},
+		{"test compares numbers by value", `[{"op": "test", "path": "/nServing", "value": 2.0}]`, patchTestDoc, false},
+		{"test missing member", `[{"op": "test", "path": "/tags", "value": []}]`, "", true},
+		{"unknown op", `[{"op": "rename", "path": "/name"}]`, "", true},
+		{"invalid pointer", `[{"op": "remove", "path": "name"}]`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := JSONPatch([]byte(patchTestDoc), []byte(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("JSONPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got, want := canonicalJSON(t, string(patched)), canonicalJSON(t, tt.want); got != want {
+				t.Errorf("JSONPatch() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestJSONPatchFailedTestAbortsPatch(t *testing.T) {
+	patch := `[{"op": "replace", "path": "/name", "value": "Mie goreng"}, {"op": "test", "path": "/nServing", "value": 4}, {"op": "remove", "path": "/meta"}]`
+	patched, err := JSONPatch([]byte(patchTestDoc), []byte(patch))
+	if !errors.Is(err, ErrPatchTestFailed) {
+		t.Fatalf("JSONPatch() error = %v, want ErrPatchTestFailed", err)
+	}
+	if patched != nil {
+		t.Errorf("JSONPatch() = %s, want nothing", patched)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{"replace member", `{"name": "Nasi goreng", "nServing": 2}`, `{"name": "Mie goreng"}`, `{"name": "Mie goreng", "nServing": 2}`},
+		{"add member", `{"name": "Nasi goreng"}`, `{"tags": ["pedas"]}`, `{"name": "Nasi goreng", "tags": ["pedas"]}`},
+		{"null deletes", `{"name": "Nasi goreng", "image": "nasi.png"}`, `{"image": null}`, `{"name": "Nasi goreng"}`},
+		{"null of missing member", `{"name": "Nasi goreng"}`, `{"image": null}`, `{"name": "Nasi goreng"}`},
+		{"nested merge", `{"meta": {"level": "mudah", "origin": "Jawa"}}`, `{"meta": {"level": "sulit", "origin": null}}`, `{"meta": {"level": "sulit"}}`},
+		{"arrays are replaced", `{"steps": ["tumis", "aduk"]}`, `{"steps": ["sajikan"]}`, `{"steps": ["sajikan"]}`},
+		{"object replaces non object member", `{"steps": ["tumis"]}`, `{"steps": {"first": "tumis"}}`, `{"steps": {"first": "tumis"}}`},
+		{"nulls in new objects are dropped", `{}`, `{"meta": {"level": null, "origin": "Jawa"}}`, `{"meta": {"origin": "Jawa"}}`},
+		{"array patch replaces target", `{"name": "Nasi goreng"}`, `["tumis"]`, `["tumis"]`},
+		{"string patch replaces target", `{"name": "Nasi goreng"}`, `"Mie goreng"`, `"Mie goreng"`},
+		{"null patch replaces target", `{"name": "Nasi goreng"}`, `null`, `null`},
+		{"object patch on non object target", `["tumis"]`, `{"name": "Mie goreng"}`, `{"name": "Mie goreng"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := MergePatch([]byte(tt.target), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := canonicalJSON(t, string(patched)), canonicalJSON(t, tt.want); got != want {
+				t.Errorf("MergePatch() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestMergePatchInvalidJSON(t *testing.T) {
+	if _, err := MergePatch([]byte(`{"name": "Nasi goreng"}`), []byte(`{"name":`)); err == nil {
+		t.Error("MergePatch() of a broken patch succeeded")
+	}
+}
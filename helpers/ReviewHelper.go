@@ -0,0 +1,16 @@
+package helpers
+
+import (
+	"os"
+	"strconv"
+)
+
+// ReviewReportHideThreshold : reviews are hidden once reported by this many users, until a
+// moderator shows them again. REVIEW_REPORT_HIDE_THRESHOLD defaults to 3, 0 never hides them.
+func ReviewReportHideThreshold() int {
+	threshold, err := strconv.Atoi(os.Getenv("REVIEW_REPORT_HIDE_THRESHOLD"))
+	if err != nil || threshold < 0 {
+		return 3
+	}
+	return threshold
+}
@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/twinj/uuid"
+)
+
+// s3TestStorage : storage on the bucket given in S3_TEST_ENDPOINT, S3_TEST_BUCKET,
+// S3_TEST_ACCESS_KEY and S3_TEST_SECRET_KEY, the test is skipped without an endpoint
+func s3TestStorage(t *testing.T) *S3Storage {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	return NewS3Storage(S3Config{
+		Endpoint:  endpoint,
+		Region:    envOrDefault("S3_TEST_REGION", "us-east-1"),
+		Bucket:    envOrDefault("S3_TEST_BUCKET", "codefood"),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+	})
+}
+
+func TestS3Storage(t *testing.T) {
+	storage := s3TestStorage(t)
+	key := "test/" + uuid.NewV4().String() + "/picture name.png"
+	data := []byte("not really a png")
+
+	if err := storage.Put(key, data, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Delete(key) })
+
+	reader, err := storage.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(stored, data) {
+		t.Fatalf("Open = %q, %v, want %q", stored, err, data)
+	}
+
+	link, err := storage.URL(key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Get(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !bytes.Equal(downloaded, data) {
+		t.Fatalf("GET signed URL = %s %q, want 200 %q", res.Status, downloaded, data)
+	}
+
+	if err := storage.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Open(key); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Open after Delete: err = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestS3StorageSignedURLRejectsTampering(t *testing.T) {
+	storage := s3TestStorage(t)
+	key := "test/" + uuid.NewV4().String() + ".txt"
+	if err := storage.Put(key, []byte("secret"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Delete(key) })
+
+	link, err := storage.URL(key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Get(link + "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("GET tampered signed URL = %s, want 403", res.Status)
+	}
+}
@@ -0,0 +1,45 @@
+package helpers
+
+import (
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/nadhirfr/codefood/search"
+)
+
+const (
+	SEARCH_FIELD_NAME        = "name"
+	SEARCH_FIELD_CATEGORY    = "category"
+	SEARCH_FIELD_TAGS        = "tags"
+	SEARCH_FIELD_INGREDIENTS = "ingredients"
+	SEARCH_FIELD_STEPS       = "steps"
+)
+
+// RECIPE_INDEX is the full text index of recipes, filled on start by includes.SearchInit
+// and kept up to date by the controllers changing recipes
+var RECIPE_INDEX = search.NewIndex(
+	search.Field{Name: SEARCH_FIELD_NAME, Weight: 4},
+	search.Field{Name: SEARCH_FIELD_CATEGORY, Weight: 2},
+	search.Field{Name: SEARCH_FIELD_TAGS, Weight: 2},
+	search.Field{Name: SEARCH_FIELD_INGREDIENTS, Weight: 1.5},
+	search.Field{Name: SEARCH_FIELD_STEPS, Weight: 0.5},
+)
+
+// SearchLikeBoost : relevance of a recipe raised by its likes. The boost grows with the
+// logarithm of the likes, so popularity reorders close matches but never buries a better one.
+func SearchLikeBoost(score float64, nReactionLike int) float64 {
+	if nReactionLike < 0 {
+		nReactionLike = 0
+	}
+	return score * (1 + searchLikeWeight()*math.Log10(1+float64(nReactionLike)))
+}
+
+// searchLikeWeight reads SEARCH_LIKE_BOOST, 0.1 by default: 100 likes add 20%
+func searchLikeWeight() float64 {
+	weight, err := strconv.ParseFloat(os.Getenv("SEARCH_LIKE_BOOST"), 64)
+	if err != nil || weight < 0 {
+		return 0.1
+	}
+	return weight
+}
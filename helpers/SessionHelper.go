@@ -0,0 +1,185 @@
+package helpers
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// SESSIONS is the store holding live access/refresh token uuids
+var SESSIONS SessionStore
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore is the minimal key/value + set contract needed to keep track of
+// issued tokens. Redis is used in production, the memory store for tests and
+// local development.
+type SessionStore interface {
+	Set(key string, value string, ttl time.Duration) error
+	Get(key string) (string, error)
+	Del(keys ...string) (int64, error)
+	SAdd(key string, ttl time.Duration, members ...string) error
+	SMembers(key string) ([]string, error)
+}
+
+// SessionInit picks the session store from SESSION_STORE (redis|memory)
+func SessionInit() {
+	switch strings.ToLower(os.Getenv("SESSION_STORE")) {
+	case "memory":
+		SESSIONS = NewMemorySessionStore()
+	default:
+		RedisInit()
+		SESSIONS = NewRedisSessionStore(REDIS)
+	}
+}
+
+//* redis store
+
+type RedisSessionStore struct {
+	client *redis.Client
+}
+
+func NewRedisSessionStore(client *redis.Client) *RedisSessionStore {
+	return &RedisSessionStore{client: client}
+}
+
+func (s *RedisSessionStore) Set(key string, value string, ttl time.Duration) error {
+	return s.client.Set(key, value, ttl).Err()
+}
+
+func (s *RedisSessionStore) Get(key string) (string, error) {
+	value, err := s.client.Get(key).Result()
+	if err == redis.Nil {
+		return "", ErrSessionNotFound
+	}
+	return value, err
+}
+
+func (s *RedisSessionStore) Del(keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	return s.client.Del(keys...).Result()
+}
+
+func (s *RedisSessionStore) SAdd(key string, ttl time.Duration, members ...string) error {
+	args := make([]interface{}, len(members))
+	for idx, member := range members {
+		args[idx] = member
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.SAdd(key, args...)
+	pipe.Expire(key, ttl)
+	_, err := pipe.Exec()
+	return err
+}
+
+func (s *RedisSessionStore) SMembers(key string) ([]string, error) {
+	return s.client.SMembers(key).Result()
+}
+
+//* memory store
+
+type memorySessionEntry struct {
+	value   string
+	set     map[string]struct{}
+	expires time.Time
+}
+
+type MemorySessionStore struct {
+	mu      sync.Mutex
+	entries map[string]*memorySessionEntry
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{entries: make(map[string]*memorySessionEntry)}
+}
+
+// lookup returns the live entry for key, dropping it when expired. Caller holds mu.
+func (s *MemorySessionStore) lookup(key string) *memorySessionEntry {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func (s *MemorySessionStore) Set(key string, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = &memorySessionEntry{value: value, expires: expiresAt(ttl)}
+	return nil
+}
+
+func (s *MemorySessionStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.lookup(key)
+	if entry == nil || entry.set != nil {
+		return "", ErrSessionNotFound
+	}
+	return entry.value, nil
+}
+
+func (s *MemorySessionStore) Del(keys ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for _, key := range keys {
+		if s.lookup(key) != nil {
+			delete(s.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemorySessionStore) SAdd(key string, ttl time.Duration, members ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.lookup(key)
+	if entry == nil || entry.set == nil {
+		entry = &memorySessionEntry{set: make(map[string]struct{})}
+		s.entries[key] = entry
+	}
+	for _, member := range members {
+		entry.set[member] = struct{}{}
+	}
+	entry.expires = expiresAt(ttl)
+	return nil
+}
+
+func (s *MemorySessionStore) SMembers(key string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.lookup(key)
+	if entry == nil || entry.set == nil {
+		return []string{}, nil
+	}
+	members := make([]string, 0, len(entry.set))
+	for member := range entry.set {
+		members = append(members, member)
+	}
+	return members, nil
+}
@@ -0,0 +1,123 @@
+package helpers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// useMemorySessions : fresh memory session store and HMAC keys for one test
+func useMemorySessions(t *testing.T) {
+	t.Helper()
+	sessions, accessKeys, refreshKeys := SESSIONS, ACCESS_KEYS, REFRESH_KEYS
+	t.Cleanup(func() { SESSIONS, ACCESS_KEYS, REFRESH_KEYS = sessions, accessKeys, refreshKeys })
+
+	SESSIONS = NewMemorySessionStore()
+	ACCESS_KEYS, REFRESH_KEYS = NewKeySet(), NewKeySet()
+	ACCESS_KEYS.Add(hmacKey("test", []byte("access-secret")))
+	REFRESH_KEYS.Add(hmacKey("test", []byte("refresh-secret")))
+	if err := ACCESS_KEYS.SetSigningKey("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := REFRESH_KEYS.SetSigningKey("test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func login(t *testing.T, userid uint) *TokenDetails {
+	t.Helper()
+	td, err := CreateToken(userid, ROLE_PERSONAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateAuth(userid, td); err != nil {
+		t.Fatal(err)
+	}
+	return td
+}
+
+func sessionLive(uuid string) bool {
+	_, err := SESSIONS.Get(uuid)
+	return err == nil
+}
+
+func TestRefreshAuthRotates(t *testing.T) {
+	useMemorySessions(t)
+	td := login(t, 7)
+
+	rotated, err := RefreshAuth(td.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Family != td.Family {
+		t.Errorf("family = %q, want %q", rotated.Family, td.Family)
+	}
+	if sessionLive(td.AccessUuid) || sessionLive(td.RefreshUuid) {
+		t.Error("the rotated pair is still live")
+	}
+	if !sessionLive(rotated.AccessUuid) || !sessionLive(rotated.RefreshUuid) {
+		t.Error("the new pair is not live")
+	}
+}
+
+func TestRefreshAuthReuseRevokesFamily(t *testing.T) {
+	useMemorySessions(t)
+	td := login(t, 7)
+	other := login(t, 7)
+
+	rotated, err := RefreshAuth(td.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshAuth(td.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reusing a refresh token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if sessionLive(rotated.AccessUuid) || sessionLive(rotated.RefreshUuid) {
+		t.Error("tokens of the reused family are still live")
+	}
+	if !sessionLive(other.AccessUuid) {
+		t.Error("another login session of the user was revoked")
+	}
+	if _, err := RefreshAuth(rotated.RefreshToken); err == nil {
+		t.Error("refresh token of a revoked family still rotates")
+	}
+}
+
+func TestRevokeAllAuth(t *testing.T) {
+	useMemorySessions(t)
+	first, second := login(t, 7), login(t, 7)
+	kept := login(t, 8)
+
+	if err := RevokeAllAuth(7); err != nil {
+		t.Fatal(err)
+	}
+	for _, uuid := range []string{first.AccessUuid, first.RefreshUuid, second.AccessUuid, second.RefreshUuid} {
+		if sessionLive(uuid) {
+			t.Errorf("%s is still live", uuid)
+		}
+	}
+	if !sessionLive(kept.AccessUuid) {
+		t.Error("session of another user was revoked")
+	}
+}
+
+func TestMemorySessionStoreExpires(t *testing.T) {
+	store := NewMemorySessionStore()
+	if err := store.Set("short", "1", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("forever", "1", 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := store.Get("short"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expired key: err = %v, want ErrSessionNotFound", err)
+	}
+	if value, err := store.Get("forever"); err != nil || value != "1" {
+		t.Errorf("key without ttl = %q, %v", value, err)
+	}
+	if deleted, _ := store.Del("short", "forever"); deleted != 1 {
+		t.Errorf("deleted %d keys, want 1", deleted)
+	}
+}
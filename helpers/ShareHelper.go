@@ -0,0 +1,22 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+)
+
+// NewShareToken : 24 random bytes as 32 url safe characters, nobody guesses a shared link
+func NewShareToken() (string, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// ServeShareURL : public link to the serve history shared with token, prefixed with
+// PUBLIC_BASE_URL when set
+func ServeShareURL(token string) string {
+	return os.Getenv("PUBLIC_BASE_URL") + "/serve-histories/shared/" + token
+}
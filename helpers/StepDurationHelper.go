@@ -0,0 +1,145 @@
+package helpers
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// STEP_DURATION_RULES_VERSION goes up whenever the extraction below changes, recipes timed
+// with older rules are timed again on start
+const STEP_DURATION_RULES_VERSION = 2
+
+// StepDuration : hands-on (active) and waiting (passive) time of a recipe step in seconds
+type StepDuration struct {
+	ActiveSeconds  int
+	PassiveSeconds int
+}
+
+var durationUnitSeconds = map[string]int{
+	"jam": 3600, "hour": 3600, "hours": 3600, "hr": 3600, "hrs": 3600,
+	"menit": 60, "mnt": 60, "minute": 60, "minutes": 60, "min": 60, "mins": 60,
+	"detik": 1, "dtk": 1, "second": 1, "seconds": 1, "sec": 1, "secs": 1,
+}
+
+var durationWords = map[string]float64{
+	"seperempat": 0.25, "setengah": 0.5, "se": 1, "satu": 1, "dua": 2, "tiga": 3, "empat": 4,
+	"lima": 5, "enam": 6, "tujuh": 7, "delapan": 8, "sembilan": 9, "sepuluh": 10,
+	"half": 0.5, "an": 1, "a": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+// a number or number word, optionally a range ("10-15", "10 sampai 15"), then a unit. Only the
+// words of durationWords are numbers, the verb in "rebus sampai 15 menit" is not the lower bound.
+var durationPattern = regexp.MustCompile(`\b(` + durationNumberPattern() + `)(?:\s*(?:-|–|sampai|hingga|s/d|to)\s*(` + durationNumberPattern() + `))?\s*(jam|hours?|hrs?|menit|mnt|minutes?|mins?|detik|dtk|seconds?|secs?)\b`)
+
+// durationNumberPattern : a number, a fraction or one of durationWords, longest word first
+func durationNumberPattern() string {
+	words := make([]string, 0, len(durationWords))
+	for word := range durationWords {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+	return `\d+(?:[.,]\d+)?(?:/\d+)?|` + strings.Join(words, "|")
+}
+
+// clauses of a step are read one by one, "tumis 2 menit lalu panggang 30 menit" is two
+// minutes of active and half an hour of passive time. Commas and periods only separate before
+// a space, "1,5 jam" is a number.
+var durationClauseSeparator = regexp.MustCompile(`[;!?\n]+|[,.]+\s|\s(?:lalu|kemudian|setelah itu|sambil|then|and then|meanwhile)\s`)
+
+// words of waiting: the cook is free while the oven, the pot or the fridge does the work
+var passiveDurationWords = []string{
+	"diamkan", "didiamkan", "istirahatkan", "rendam", "direndam", "marinasi", "dimarinasi", "marinate", "marinade",
+	"panggang", "dipanggang", "oven", "kukus", "dikukus", "rebus", "direbus", "ungkep", "diungkep", "presto",
+	"dinginkan", "didinginkan", "kulkas", "lemari es", "freezer", "bekukan", "dibekukan", "fermentasi", "mengembang",
+	"api kecil", "bake", "baked", "roast", "steam", "boil", "simmer", "rest", "soak", "chill", "refrigerate", "freeze",
+	"proof", "rise", "low heat", "slow cook",
+}
+
+// words for a whole night of waiting without a number
+var overnightDurationWords = []string{"semalaman", "semalam", "overnight"}
+
+const overnightSeconds = 8 * 3600
+
+// ExtractStepDuration : time a step takes as told by its description ("masak selama 15
+// menit", "diamkan semalaman"), false when it mentions none. Ranges count with their upper
+// bound, a timer should rather ring late than early.
+func ExtractStepDuration(description string) (StepDuration, bool) {
+	var duration StepDuration
+	found := false
+	for _, clause := range durationClauseSeparator.Split(" "+strings.ToLower(description)+" ", -1) {
+		seconds := clauseDurationSeconds(clause)
+		if seconds == 0 {
+			continue
+		}
+		found = true
+		if isPassiveClause(clause) {
+			duration.PassiveSeconds += seconds
+		} else {
+			duration.ActiveSeconds += seconds
+		}
+	}
+	return duration, found
+}
+
+func clauseDurationSeconds(clause string) int {
+	total := 0.0
+	for _, match := range durationPattern.FindAllStringSubmatch(clause, -1) {
+		value, ok := durationValue(match[1])
+		if !ok {
+			continue
+		}
+		if match[2] != "" {
+			if upper, ok := durationValue(match[2]); ok && upper > value {
+				value = upper
+			}
+		}
+		total += value * float64(durationUnitSeconds[match[3]])
+	}
+	if total == 0 {
+		words := " " + strings.Join(strings.Fields(clause), " ") + " "
+		for _, word := range overnightDurationWords {
+			if strings.Contains(words, " "+word+" ") {
+				return overnightSeconds
+			}
+		}
+	}
+	return int(math.Round(total))
+}
+
+func durationValue(text string) (float64, bool) {
+	if value, ok := durationWords[text]; ok {
+		return value, true
+	}
+	text = strings.Replace(text, ",", ".", 1)
+	if parts := strings.SplitN(text, "/", 2); len(parts) == 2 {
+		numerator, err1 := strconv.ParseFloat(parts[0], 64)
+		denominator, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil || denominator == 0 {
+			return 0, false
+		}
+		return numerator / denominator, true
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	return value, err == nil && value > 0
+}
+
+func isPassiveClause(clause string) bool {
+	words := " " + strings.Join(strings.FieldsFunc(clause, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9')
+	}), " ") + " "
+	for _, word := range passiveDurationWords {
+		if strings.Contains(words, " "+word+" ") {
+			return true
+		}
+	}
+	return false
+}
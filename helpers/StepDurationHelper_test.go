@@ -0,0 +1,38 @@
+package helpers
+
+import "testing"
+
+func TestExtractStepDuration(t *testing.T) {
+	tests := []struct {
+		description string
+		want        StepDuration
+		found       bool
+	}{
+		{"Masak selama 15 menit", StepDuration{ActiveSeconds: 900}, true},
+		{"Tumis bumbu 2 menit lalu panggang 30 menit", StepDuration{ActiveSeconds: 120, PassiveSeconds: 1800}, true},
+		{"Rebus 10-15 menit", StepDuration{PassiveSeconds: 900}, true},
+		{"rebus sampai 15 menit", StepDuration{PassiveSeconds: 900}, true},
+		{"didihkan hingga 5 menit", StepDuration{ActiveSeconds: 300}, true},
+		{"Masak hingga 2 menit", StepDuration{ActiveSeconds: 120}, true},
+		{"Kukus lima sampai sepuluh menit", StepDuration{PassiveSeconds: 600}, true},
+		{"Diamkan 1,5 jam", StepDuration{PassiveSeconds: 5400}, true},
+		{"Panggang 1/2 jam", StepDuration{PassiveSeconds: 1800}, true},
+		{"Ungkep setengah jam, angkat", StepDuration{PassiveSeconds: 1800}, true},
+		{"Diamkan sejam", StepDuration{PassiveSeconds: 3600}, true},
+		{"Marinasi ayam semalaman di kulkas", StepDuration{PassiveSeconds: 8 * 3600}, true},
+		{"Simmer for 20 minutes", StepDuration{PassiveSeconds: 1200}, true},
+		{"Stir for 30 seconds then rest for an hour", StepDuration{ActiveSeconds: 30, PassiveSeconds: 3600}, true},
+		{"Saute 3 to 4 mins.", StepDuration{ActiveSeconds: 240}, true},
+		{"Aduk rata, sajikan", StepDuration{}, false},
+		{"Masukkan 2 sdm gula", StepDuration{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			got, found := ExtractStepDuration(tt.description)
+			if got != tt.want || found != tt.found {
+				t.Errorf("ExtractStepDuration(%q) = %+v, %v, want %+v, %v", tt.description, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
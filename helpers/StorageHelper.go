@@ -0,0 +1,174 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// STORAGE keeps uploaded files such as recipe pictures
+var STORAGE Storage
+
+var ErrObjectNotFound = errors.New("object not found")
+var ErrFileTooLarge = errors.New("file too large")
+
+// Storage is implemented by every object storage backend
+type Storage interface {
+	Put(key string, data []byte, contentType string) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+	// URL returns a link to the object valid for ttl
+	URL(key string, ttl time.Duration) (string, error)
+}
+
+// StorageInit picks the backend from STORAGE_DRIVER (filesystem|s3)
+func StorageInit() {
+	switch strings.ToLower(os.Getenv("STORAGE_DRIVER")) {
+	case "s3":
+		STORAGE = NewS3Storage(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    envOrDefault("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		secret := []byte(os.Getenv("STORAGE_URL_SECRET"))
+		if len(secret) == 0 {
+			log.Print("STORAGE_URL_SECRET is not set, using a random secret")
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				panic(err)
+			}
+		}
+		STORAGE = NewFileStorage(envOrDefault("STORAGE_DIR", "./storage"), os.Getenv("PUBLIC_BASE_URL")+"/media", secret)
+	}
+}
+
+// StorageURLTTL : how long links returned in responses stay valid, STORAGE_URL_TTL in seconds
+func StorageURLTTL() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("STORAGE_URL_TTL"))
+	if err != nil || seconds <= 0 {
+		return time.Hour
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func envOrDefault(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+//* filesystem
+
+// FileStorage keeps objects below a directory, links are signed and served by this app
+type FileStorage struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+func NewFileStorage(root string, baseURL string, secret []byte) *FileStorage {
+	return &FileStorage{root: root, baseURL: baseURL, secret: secret}
+}
+
+// path : keys are cleaned so they can never leave the root directory
+func (s *FileStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" {
+		return "", ErrObjectNotFound
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (s *FileStorage) Put(key string, data []byte, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, data, 0644)
+}
+
+func (s *FileStorage) Open(key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return file, err
+}
+
+func (s *FileStorage) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStorage) URL(key string, ttl time.Duration) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(key, expires))
+	return s.baseURL + "/" + strings.TrimPrefix(key, "/") + "?" + query.Encode(), nil
+}
+
+// Verify : check a link returned by URL
+func (s *FileStorage) Verify(key string, expires string, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(key, expires)))
+}
+
+func (s *FileStorage) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.TrimPrefix(key, "/") + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ContentTypeByKey : content type of a stored object from its extension
+func ContentTypeByKey(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// ReadAllLimited : read r, failing when it holds more than limit bytes
+func ReadAllLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrFileTooLarge
+	}
+	return data, nil
+}
@@ -6,6 +6,7 @@ import (
 	"unicode"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -81,33 +82,48 @@ func ValidateServe(c *gin.Context, dataSet interface{}) (bool, interface{}) {
 //* default validation
 func DefaultValidator(c *gin.Context, dataSet interface{}) (bool, interface{}) {
 	if err := c.ShouldBind(dataSet); err != nil {
-		if _, ok := err.(validator.ValidationErrors); !ok {
-			return false, err.Error()
-		}
+		return false, defaultValidationErrors(err)
+	}
 
-		errors := make(gin.H)
+	return true, nil
+}
 
-		for _, err := range err.(validator.ValidationErrors) {
-			name := MakeFirstLowerCase(err.StructField())
-			switch err.Tag() {
-			case "required":
-				errors[name] = name + " is required"
-			case "email":
-				errors[name] = name + " should be a valid email"
-			case "min":
-				errors[name] = name + " minimum " + err.Param() + " characters"
-			case "max":
-				errors[name] = name + " allowed maximum " + err.Param() + " characters"
-			default:
-				errors[name] = name + " is invalid"
-			}
-		}
-		return false, errors
+//* validation of an already decoded struct, e.g. the result of a patch
+func ValidateStruct(dataSet interface{}) (bool, interface{}) {
+	if err := binding.Validator.ValidateStruct(dataSet); err != nil {
+		return false, defaultValidationErrors(err)
 	}
 
 	return true, nil
 }
 
+func defaultValidationErrors(err error) interface{} {
+	if _, ok := err.(validator.ValidationErrors); !ok {
+		return err.Error()
+	}
+
+	errors := make(gin.H)
+
+	for _, err := range err.(validator.ValidationErrors) {
+		name := MakeFirstLowerCase(err.StructField())
+		switch err.Tag() {
+		case "required":
+			errors[name] = name + " is required"
+		case "required_without":
+			errors[name] = name + " or " + MakeFirstLowerCase(err.Param()) + " is required"
+		case "email":
+			errors[name] = name + " should be a valid email"
+		case "min":
+			errors[name] = name + " minimum " + err.Param() + " characters"
+		case "max":
+			errors[name] = name + " allowed maximum " + err.Param() + " characters"
+		default:
+			errors[name] = name + " is invalid"
+		}
+	}
+	return errors
+}
+
 func MakeFirstLowerCase(s string) string {
 	if len(s) == 0 {
 		return s
@@ -1,8 +1,13 @@
 package includes
 
 import (
+	"log"
+	"os"
+	"strings"
+
 	"github.com/nadhirfr/codefood/helpers"
 	"github.com/nadhirfr/codefood/models"
+	"gorm.io/gorm"
 )
 
 func Migrate() bool {
@@ -12,12 +17,32 @@ func Migrate() bool {
 		&models.RecipeCategory{},
 		&models.Recipe{},
 		&models.RecipeStep{},
+		&models.Ingredient{},
+		&models.IngredientAlias{},
+		&models.IngredientTranslation{},
 		&models.RecipeIngridient{},
+		&models.RecipeRevision{},
+		&models.Tag{},
+		&models.RecipeTag{},
+		&models.RecipeAllergen{},
+		&models.UserAllergy{},
+		&models.IngredientFoodMapping{},
 		&models.Serve{},
 		&models.ServeStep{},
+		&models.ServeLog{},
+		&models.Review{},
+		&models.ReviewReport{},
 	)
 
 	if err == nil {
+		promoteAdmins()
+		backfillRecipeRevisions()
+		linkRecipeIngredients()
+		analyzeRecipeDietary()
+		estimateRecipeTimes()
+		scoreRecipeReactions()
+		backfillServeStates()
+
 		// 	var user = []models.User{
 		// 		{ID: 1, Username: "user1", Password: "12345678"},
 		// 		{ID: 2, Username: "user2", Password: "12345678"},
@@ -142,3 +167,151 @@ func Migrate() bool {
 
 	return true
 }
+
+// promoteAdmins gives the admin role to the comma separated ADMIN_USERNAMES,
+// so a fresh install has someone able to promote further users
+func promoteAdmins() {
+	for _, username := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		username = strings.TrimSpace(username)
+		if username == "" {
+			continue
+		}
+		err := helpers.DB.Model(&models.User{}).Where("username = ?", username).UpdateColumn("role", helpers.ROLE_ADMIN).Error
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// backfillRecipeRevisions snapshots recipes created before revisions existed as
+// their first revision, serves of those recipes are pinned to it
+func backfillRecipeRevisions() {
+	var recipes []models.Recipe
+	if err := helpers.DB.Where("revision = ?", 0).Find(&recipes).Error; err != nil {
+		log.Print(err)
+		return
+	}
+
+	for _, recipe := range recipes {
+		var ingredients []models.RecipeIngridient
+		var steps []models.RecipeStep
+		helpers.DB.Where(models.RecipeIngridient{RecipeID: recipe.ID}).Find(&ingredients)
+		helpers.DB.Where(models.RecipeStep{RecipeID: recipe.ID}).Find(&steps)
+
+		revision := models.NewRecipeRevision(recipe, ingredients, steps)
+		revision.Revision = 1
+		revision.UserID = recipe.UserID
+		revision.Note = "initial"
+
+		err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&revision).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&recipe).UpdateColumn("revision", 1).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.Serve{}).Where("recipe_id = ? AND recipe_revision = ?", recipe.ID, 0).UpdateColumn("recipe_revision", 1).Error
+		})
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// linkRecipeIngredients links ingredients saved before the ingredient catalog existed to it
+func linkRecipeIngredients() {
+	var ingredients []models.RecipeIngridient
+	if err := helpers.DB.Where("ingredient_id IS NULL").Find(&ingredients).Error; err != nil {
+		log.Print(err)
+		return
+	}
+
+	for _, ingredient := range ingredients {
+		id, err := models.CatalogIngredientID(helpers.DB, ingredient.Item)
+		if err == nil && id > 0 {
+			err = helpers.DB.Model(&ingredient).UpdateColumn("ingredient_id", id).Error
+		}
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// analyzeRecipeDietary finds allergens and diets of recipes saved before the dietary rules
+// existed or under older rules
+func analyzeRecipeDietary() {
+	var recipes []models.Recipe
+	if err := helpers.DB.Where("dietary_version < ?", helpers.DIETARY_RULES_VERSION).Find(&recipes).Error; err != nil {
+		log.Print(err)
+		return
+	}
+
+	for idx := range recipes {
+		recipe := &recipes[idx]
+		var ingredients []models.RecipeIngridient
+		helpers.DB.Where(models.RecipeIngridient{RecipeID: recipe.ID}).Find(&ingredients)
+
+		err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+			return models.ApplyRecipeDietary(tx, recipe, ingredients)
+		})
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// estimateRecipeTimes reads the durations of steps saved before durations existed or under
+// older extraction rules, durations given by hand are kept
+func estimateRecipeTimes() {
+	var recipes []models.Recipe
+	if err := helpers.DB.Where("times_version < ?", helpers.STEP_DURATION_RULES_VERSION).Find(&recipes).Error; err != nil {
+		log.Print(err)
+		return
+	}
+
+	for idx := range recipes {
+		recipe := &recipes[idx]
+		var steps []models.RecipeStep
+		helpers.DB.Where(models.RecipeStep{RecipeID: recipe.ID}).Find(&steps)
+		for stepIdx := range steps {
+			if steps[stepIdx].DurationSource != models.STEP_DURATION_MANUAL {
+				steps[stepIdx].DurationSource = models.STEP_DURATION_EXTRACTED
+			}
+		}
+		models.SetStepDurations(steps)
+
+		err := helpers.DB.Transaction(func(tx *gorm.DB) error {
+			for stepIdx := range steps {
+				err := tx.Model(&steps[stepIdx]).Select("active_seconds", "passive_seconds", "duration_source").Updates(&steps[stepIdx]).Error
+				if err != nil {
+					return err
+				}
+			}
+			return models.ApplyRecipeTimes(tx, recipe, steps)
+		})
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// backfillServeStates gives serve histories from before states the state their steps and
+// reaction add up to, their last activity is their last update
+func backfillServeStates() {
+	err := helpers.DB.Model(&models.Serve{}).Where("state = '' OR state IS NULL").UpdateColumns(map[string]interface{}{
+		"state": gorm.Expr("CASE WHEN reaction <> ? THEN ? WHEN EXISTS (SELECT 1 FROM serve_steps WHERE serve_steps.serve_id = serves.id AND serve_steps.done = false) THEN ? ELSE ? END",
+			int(models.ReactionUnknown), models.SERVE_STATE_RATED, models.SERVE_STATE_IN_PROGRESS, models.SERVE_STATE_COMPLETED),
+		"active_at": gorm.Expr("updated_at"),
+	}).Error
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// scoreRecipeReactions works out the like ratio and Wilson score of recipes counted before
+// the scores existed, a single update of every recipe
+func scoreRecipeReactions() {
+	if err := models.RecomputeRecipeScores(helpers.DB.Where("1 = 1")); err != nil {
+		log.Print(err)
+	}
+}
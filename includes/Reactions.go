@@ -0,0 +1,20 @@
+package includes
+
+import (
+	"log"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+)
+
+// ReconcileReactions recounts the reactions of every recipe from its serve histories, run it
+// with `go run . reconcile-reactions` after counters were edited in the database
+func ReconcileReactions() bool {
+	affected, err := models.ReconcileReactionCounters(helpers.DB)
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	log.Printf("reaction counters reconciled, %d recipes changed", affected)
+	return true
+}
@@ -0,0 +1,39 @@
+package includes
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+)
+
+// SearchInit fills the full text index with every recipe. Every instance keeps its own index,
+// with several instances set SEARCH_REINDEX_INTERVAL (e.g. "5m") so changes made through the
+// other instances show up in search after at most that long.
+func SearchInit() {
+	IndexRecipes()
+
+	interval, err := time.ParseDuration(os.Getenv("SEARCH_REINDEX_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			IndexRecipes()
+		}
+	}()
+}
+
+// IndexRecipes rebuilds the full text index from the database
+func IndexRecipes() {
+	// recipes saved while reading keep the version indexed by their controller
+	version := helpers.RECIPE_INDEX.Version()
+	documents, err := models.RecipeSearchDocuments(helpers.DB, nil)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	helpers.RECIPE_INDEX.Replace(documents, version)
+}
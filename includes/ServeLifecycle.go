@@ -0,0 +1,53 @@
+package includes
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/models"
+)
+
+// ServeLifecycleInit abandons serve histories left in progress or paused for longer than
+// SERVE_ABANDON_AFTER (default "72h", "0" keeps them), checked every SERVE_ABANDON_INTERVAL
+// (default "1h"). Every instance checks, abandoning a history twice is not possible.
+func ServeLifecycleInit() {
+	after := 72 * time.Hour
+	if value := os.Getenv("SERVE_ABANDON_AFTER"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Print("SERVE_ABANDON_AFTER: ", err)
+			return
+		}
+		after = parsed
+	}
+	if after <= 0 {
+		return
+	}
+
+	interval, err := time.ParseDuration(os.Getenv("SERVE_ABANDON_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = time.Hour
+	}
+
+	AbandonStaleServes(after)
+	go func() {
+		for range time.Tick(interval) {
+			AbandonStaleServes(after)
+		}
+	}()
+}
+
+// AbandonStaleServes abandons the serve histories without any activity for after
+func AbandonStaleServes(after time.Duration) {
+	now := helpers.DB.NowFunc()
+	abandoned, err := models.AbandonStaleServes(helpers.DB, now.Add(-after), now)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if abandoned > 0 {
+		log.Printf("abandoned %d stale serve histories", abandoned)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	// docs is generated by Swag CLI, you have to import it.
 	// _ "github.com/nadhirfr/codefood/docs"
@@ -50,6 +51,10 @@ func main() {
 
 	helpers.DB, err = gorm.Open(mysql.New(helpers.DbURL(helpers.BuildDBConfig())), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// datetime columns have no fractional part, keep timestamps in memory equal to the stored ones (ETags rely on it)
+		NowFunc: func() time.Time {
+			return time.Now().Truncate(time.Second)
+		},
 	})
 	if err != nil {
 		fmt.Println("Status:", err)
@@ -59,8 +64,30 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	helpers.KeysInit()
+	helpers.SessionInit()
+	helpers.EventsInit()
+	helpers.StorageInit()
+
 	includes.Migrate()
 
+	// one-off commands run instead of the server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reconcile-reactions":
+			if !includes.ReconcileReactions() {
+				os.Exit(1)
+			}
+		default:
+			fmt.Println("Unknown command", os.Args[1])
+			os.Exit(2)
+		}
+		return
+	}
+
+	includes.SearchInit()
+	includes.ServeLifecycleInit()
+
 	r := routes.SetupRouter()
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
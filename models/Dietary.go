@@ -0,0 +1,109 @@
+package models
+
+import (
+	"github.com/nadhirfr/codefood/helpers"
+	"gorm.io/gorm"
+)
+
+// RecipeAllergen : an allergen found in the ingredients of a recipe, see helpers.ALLERGENS
+type RecipeAllergen struct {
+	RecipeID uint   `gorm:"primaryKey;autoIncrement:false" json:"recipeId"`
+	Allergen string `gorm:"primaryKey;size:32;index" json:"allergen"`
+}
+
+// UserAllergy : an allergen the user must not eat, recipes containing it are left out of their listings
+type UserAllergy struct {
+	UserID   uint   `gorm:"primaryKey;autoIncrement:false" json:"userId"`
+	Allergen string `gorm:"primaryKey;size:32" json:"allergen"`
+}
+
+type UserAllergies struct {
+	Allergens []string `form:"allergens" json:"allergens" binding:"required" example:"nuts,shellfish"`
+}
+
+// Diets : the diets the recipe fits, in the order of helpers.DIETS
+func (recipe Recipe) Diets() []string {
+	fits := map[string]bool{
+		helpers.DIET_VEGETARIAN: recipe.Vegetarian,
+		helpers.DIET_VEGAN:      recipe.Vegan,
+		helpers.DIET_HALAL:      recipe.Halal,
+	}
+	diets := []string{}
+	for _, diet := range helpers.DIETS {
+		if fits[diet] {
+			diets = append(diets, diet)
+		}
+	}
+	return diets
+}
+
+// ApplyRecipeDietary : analyze the ingredients of recipe and store its allergens and diets
+func ApplyRecipeDietary(tx *gorm.DB, recipe *Recipe, ingredients []RecipeIngridient) error {
+	items := make([]string, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		items = append(items, ingredient.Item)
+	}
+	dietary := helpers.AnalyzeDietary(items)
+
+	recipe.Vegetarian = helpers.FitsDiet(dietary.Diets, helpers.DIET_VEGETARIAN)
+	recipe.Vegan = helpers.FitsDiet(dietary.Diets, helpers.DIET_VEGAN)
+	recipe.Halal = helpers.FitsDiet(dietary.Diets, helpers.DIET_HALAL)
+	recipe.DietaryVersion = helpers.DIETARY_RULES_VERSION
+	err := tx.Model(recipe).UpdateColumns(map[string]interface{}{
+		"vegetarian":      recipe.Vegetarian,
+		"vegan":           recipe.Vegan,
+		"halal":           recipe.Halal,
+		"dietary_version": recipe.DietaryVersion,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Where(RecipeAllergen{RecipeID: recipe.ID}).Delete(&RecipeAllergen{}).Error; err != nil {
+		return err
+	}
+	if len(dietary.Allergens) == 0 {
+		return nil
+	}
+	allergens := make([]RecipeAllergen, 0, len(dietary.Allergens))
+	for _, allergen := range dietary.Allergens {
+		allergens = append(allergens, RecipeAllergen{RecipeID: recipe.ID, Allergen: allergen})
+	}
+	return tx.Create(&allergens).Error
+}
+
+// RecipeAllergens : allergens of every recipe in recipeIds
+func RecipeAllergens(db *gorm.DB, recipeIds []uint) (map[uint][]string, error) {
+	allergens := make(map[uint][]string)
+	if len(recipeIds) == 0 {
+		return allergens, nil
+	}
+
+	var rows []RecipeAllergen
+	if err := db.Where("recipe_id IN ?", recipeIds).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[uint]map[string]bool)
+	for _, row := range rows {
+		if found[row.RecipeID] == nil {
+			found[row.RecipeID] = make(map[string]bool)
+		}
+		found[row.RecipeID][row.Allergen] = true
+	}
+	// in the order of helpers.ALLERGENS
+	for recipeId, recipeAllergens := range found {
+		for _, allergen := range helpers.ALLERGENS {
+			if recipeAllergens[allergen] {
+				allergens[recipeId] = append(allergens[recipeId], allergen)
+			}
+		}
+	}
+	return allergens, nil
+}
+
+// UserAllergens : the allergy profile of a user
+func UserAllergens(db *gorm.DB, userID uint) ([]string, error) {
+	allergens := []string{}
+	err := db.Model(&UserAllergy{}).Where(UserAllergy{UserID: userID}).Order("allergen asc").Pluck("allergen", &allergens).Error
+	return allergens, err
+}
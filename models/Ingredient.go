@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ingredient is the catalog entry recipe ingredients are linked to. Its name, aliases and
+// translated names are all registered as IngredientAlias, so any of them finds it.
+type Ingredient struct {
+	ID           uint                    `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	Name         string                  `gorm:"size:191;uniqueIndex" json:"name" form:"name" example:"bawang merah"`
+	Aliases      []IngredientAlias       `gorm:"constraint:OnDelete:CASCADE" json:"aliases,omitempty" form:"aliases"`
+	Translations []IngredientTranslation `gorm:"constraint:OnDelete:CASCADE" json:"translations,omitempty" form:"translations"`
+	NRecipe      int64                   `gorm:"-" json:"nRecipe" form:"-"`
+	CreatedAt    time.Time               `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt    time.Time               `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+// IngredientAlias : Alias is normalized with helpers.IngredientKey and unique over the catalog
+type IngredientAlias struct {
+	ID           uint   `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
+	IngredientID uint   `gorm:"index" json:"-" form:"-"`
+	Alias        string `gorm:"size:191;uniqueIndex" json:"alias" form:"alias" example:"shallot"`
+}
+
+type IngredientTranslation struct {
+	ID           uint   `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
+	IngredientID uint   `gorm:"uniqueIndex:idx_ingredient_locale" json:"-" form:"-"`
+	Locale       string `gorm:"size:16;uniqueIndex:idx_ingredient_locale" json:"locale" form:"locale" example:"en"`
+	Name         string `json:"name" form:"name" example:"shallot"`
+}
+
+// IngredientCreate : Translations maps a locale to the name in that language
+type IngredientCreate struct {
+	Name         string            `form:"name" json:"name" binding:"required" example:"bawang merah"`
+	Aliases      []string          `form:"aliases" json:"aliases" example:"brambang"`
+	Translations map[string]string `form:"translations" json:"translations"`
+}
+
+// IngredientMerge : the listed ingredients are folded into the one in the path
+type IngredientMerge struct {
+	IngredientIds []uint `form:"ingredientIds" json:"ingredientIds" binding:"required"`
+}
+
+// BeforeCreate links the ingredient to the catalog by its item, adding items the catalog does
+// not know yet. An IngredientID chosen by the client is kept when that ingredient exists.
+func (i *RecipeIngridient) BeforeCreate(tx *gorm.DB) error {
+	if i.IngredientID != nil {
+		var count int64
+		if err := tx.Model(&Ingredient{}).Where("id = ?", *i.IngredientID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		i.IngredientID = nil
+	}
+
+	id, err := CatalogIngredientID(tx, i.Item)
+	if err != nil || id == 0 {
+		return err
+	}
+	i.IngredientID = &id
+	return nil
+}
+
+// CatalogIngredientID : id of the ingredient item refers to, an ingredient named after the item
+// is created when there is none. 0 when item has no name at all. Recipes saved at the same
+// time may add the same item, the inserts skip rows that exist and the rows are read back
+// locked so the one that was committed first is seen.
+func CatalogIngredientID(tx *gorm.DB, item string) (uint, error) {
+	key := helpers.IngredientKey(item)
+	if key == "" {
+		return 0, nil
+	}
+
+	var alias IngredientAlias
+	err := tx.Where("alias = ?", key).First(&alias).Error
+	if err == nil {
+		return alias.IngredientID, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Ingredient{Name: key}).Error; err != nil {
+		return 0, err
+	}
+	var ingredient Ingredient
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", key).First(&ingredient).Error; err != nil {
+		return 0, err
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&IngredientAlias{IngredientID: ingredient.ID, Alias: key}).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("alias = ?", key).First(&alias).Error; err != nil {
+		return 0, err
+	}
+	return alias.IngredientID, nil
+}
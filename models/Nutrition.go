@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/nadhirfr/codefood/helpers"
+)
+
+// IngredientFoodMapping is an admin correction of the food an ingredient item is matched to.
+// An empty FoodID marks the item as having no nutritional value worth counting.
+type IngredientFoodMapping struct {
+	ID        uint      `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	Item      string    `gorm:"size:191;uniqueIndex" json:"item" form:"item"`
+	FoodID    string    `gorm:"size:100" json:"foodId" form:"foodId"`
+	UserID    uint      `json:"userId" form:"userId"`
+	CreatedAt time.Time `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt time.Time `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+type IngredientFoodMappingCreate struct {
+	Item   string `form:"item" json:"item" binding:"required"`
+	FoodID string `form:"foodId" json:"foodId"`
+}
+
+const (
+	NUTRITION_MATCH_AUTO  = "auto"
+	NUTRITION_MATCH_ADMIN = "admin"
+	NUTRITION_MATCH_NONE  = "none"
+)
+
+// IngredientNutrition : how one ingredient contributes to the recipe, Nutrients is nil when the
+// item has no known food or its amount could not be converted to grams
+type IngredientNutrition struct {
+	Item      string             `json:"item"`
+	Value     float64            `json:"value"`
+	Unit      string             `json:"unit"`
+	FoodID    string             `json:"foodId"`
+	FoodName  string             `json:"foodName"`
+	Match     string             `json:"match" example:"auto"`
+	Grams     float64            `json:"grams"`
+	Nutrients *helpers.Nutrients `json:"nutrients"`
+}
+
+// RecipeNutrition : Complete is false when some ingredient could not be counted
+type RecipeNutrition struct {
+	NServing    float64               `json:"nServing"`
+	PerServing  helpers.Nutrients     `json:"perServing"`
+	Total       helpers.Nutrients     `json:"total"`
+	Complete    bool                  `json:"complete"`
+	Ingredients []IngredientNutrition `json:"ingredients"`
+}
+
+type UnmatchedIngredient struct {
+	Item    string `json:"item"`
+	Recipes int    `json:"recipes"`
+}
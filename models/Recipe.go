@@ -4,18 +4,35 @@ import (
 	"sort"
 	"time"
 
+	"github.com/nadhirfr/codefood/helpers"
 	"gorm.io/gorm"
 )
 
 type Recipe struct {
-	ID                uint               `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
-	Name              string             `form:"name" json:"name" `
-	Image             string             `form:"image" json:"image" `
-	NReactionLike     int                `form:"nReactionLike" json:"nReactionLike" `
-	NReactionNeutral  int                `form:"nReactionNeutral" json:"nReactionNeutral" `
-	NReactionDislike  int                `form:"nReactionDislike" json:"nReactionDislike" `
-	NServing          float64            `form:"nServing" json:"nServing" binding:"required"`
-	RecipeCategoryId  uint               `form:"recipeCategoryId" json:"recipeCategoryId" binding:"required"`
+	ID               uint    `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	Name             string  `form:"name" json:"name" `
+	Image            string  `form:"image" json:"image" `
+	ImageKey         string  `gorm:"size:255" form:"-" json:"-"`
+	NReactionLike    int     `form:"nReactionLike" json:"nReactionLike" `
+	NReactionNeutral int     `form:"nReactionNeutral" json:"nReactionNeutral" `
+	NReactionDislike int     `form:"nReactionDislike" json:"nReactionDislike" `
+	NServing         float64 `form:"nServing" json:"nServing" binding:"required"`
+	RecipeCategoryId uint    `form:"recipeCategoryId" json:"recipeCategoryId" binding:"required"`
+	UserID           uint    `gorm:"index" form:"userId" json:"userId"`
+	Revision         int     `form:"revision" json:"revision"`
+	// Vegetarian, Vegan and Halal are worked out from the ingredients on every save
+	Vegetarian     bool `gorm:"index" form:"vegetarian" json:"vegetarian"`
+	Vegan          bool `gorm:"index" form:"vegan" json:"vegan"`
+	Halal          bool `gorm:"index" form:"halal" json:"halal"`
+	DietaryVersion int  `form:"-" json:"-"`
+	// ActiveTime, PassiveTime and TotalTime add up the durations of the steps in seconds, 0 when no step has one
+	ActiveTime   int `form:"activeTime" json:"activeTime" example:"900"`
+	PassiveTime  int `form:"passiveTime" json:"passiveTime" example:"1800"`
+	TotalTime    int `gorm:"index" form:"totalTime" json:"totalTime" example:"2700"`
+	TimesVersion int `form:"-" json:"-"`
+	// LikeRatio and WilsonScore are worked out from the reaction counters whenever they change
+	LikeRatio         float64            `form:"likeRatio" json:"likeRatio" example:"0.8"`
+	WilsonScore       float64            `gorm:"index" form:"wilsonScore" json:"wilsonScore" example:"0.72"`
 	RecipeSteps       []RecipeStep       `gorm:"foreignKey:RecipeID"`
 	Serves            []Serve            `gorm:"foreignKey:RecipeID"`
 	RecipeIngridients []RecipeIngridient `gorm:"foreignKey:RecipeID"`
@@ -36,19 +53,42 @@ func (recipe *Recipe) AfterDelete(tx *gorm.DB) error {
 	err := tx.Model(&RecipeStep{}).Where(RecipeStep{RecipeID: recipe.ID}).Unscoped().Delete(&RecipeStep{}).Error
 	if err != nil {
 		return err
-	} else {
-		return tx.Model(&RecipeIngridient{}).Where(RecipeIngridient{RecipeID: recipe.ID}).Unscoped().Delete(&RecipeIngridient{}).Error
-
 	}
+	err = tx.Model(&RecipeIngridient{}).Where(RecipeIngridient{RecipeID: recipe.ID}).Unscoped().Delete(&RecipeIngridient{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where(RecipeTag{RecipeID: recipe.ID}).Delete(&RecipeTag{}).Error
+	if err != nil {
+		return err
+	}
+	// revisions stay, serve histories of the recipe still show what was cooked
+	return tx.Where(RecipeAllergen{RecipeID: recipe.ID}).Delete(&RecipeAllergen{}).Error
 }
 
 type RecipeCreate struct {
 	Name                  string             `form:"name" json:"name" binding:"required"`
 	RecipeCategoryId      uint               `form:"recipeCategoryId" json:"recipeCategoryId" binding:"required"`
-	Image                 string             `form:"image" json:"image" binding:"required"`
+	Image                 string             `form:"image" json:"image"`
 	NServing              float64            `form:"nServing" json:"nServing" binding:"required"`
-	IngredientsPerServing []RecipeIngridient `form:"ingredientsPerServing" json:"ingredientsPerServing" binding:"required"`
-	Steps                 []RecipeStep       `form:"steps" json:"steps" binding:"required"`
+	IngredientsPerServing []RecipeIngridient `form:"ingredientsPerServing" json:"ingredientsPerServing" binding:"required_without=IngredientsText"`
+	// IngredientsText : one ingredient per line, used when ingredientsPerServing is empty
+	IngredientsText string       `form:"ingredientsText" json:"ingredientsText,omitempty" example:"2 butir telur\n100 g gula pasir"`
+	Steps           []RecipeStep `form:"steps" json:"steps" binding:"required"`
+	// Tags : names of the tags of the recipe, left out the tags stay as they are
+	Tags []string `form:"tags" json:"tags" example:"pedas,halal"`
+}
+
+// IngredientParse is the body of POST /ingredients/parse, one ingredient per line
+type IngredientParse struct {
+	Text string `form:"text" json:"text" binding:"required" example:"2 1/2 cups flour, sifted\n3 butir telur"`
+}
+
+// IngredientParseResult : Ingredient is what would be stored on a recipe, Error is set for lines that could not be parsed
+type IngredientParseResult struct {
+	helpers.ParsedIngredient
+	Ingredient *RecipeIngridient `json:"ingredient"`
+	Error      string            `json:"error,omitempty"`
 }
 
 type RecipeCategory struct {
@@ -75,35 +115,52 @@ type RecipeStep struct {
 	ID          uint        `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
 	RecipeID    uint        `gorm:"recipeId" json:"-"`
 	StepOrder   int         `json:"stepOrder" form:"stepOrder"`
-	ServeSteps  []ServeStep `gorm:"foreignKey:RecipeStepID"`
+	ServeSteps  []ServeStep `gorm:"foreignKey:RecipeStepID" json:"-"`
 	Description string      `json:"description" form:"description"`
-	CreatedAt   time.Time   `form:"createdAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	UpdatedAt   time.Time   `form:"updatedAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	DeletedAt   *time.Time  `form:"deletedAt" json:"-" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	// ActiveSeconds is hands-on time, PassiveSeconds waiting (baking, marinating). Left out
+	// both are read from the description, DurationSource tells where they came from.
+	ActiveSeconds  *int      `json:"activeSeconds" form:"activeSeconds" example:"300"`
+	PassiveSeconds *int      `json:"passiveSeconds" form:"passiveSeconds" example:"900"`
+	DurationSource string    `gorm:"size:16" json:"durationSource" form:"durationSource" example:"extracted"`
+	CreatedAt      time.Time `form:"createdAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt      time.Time `form:"updatedAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	// DeletedAt is set on steps removed by an edit, serve histories that cooked them still show them
+	DeletedAt gorm.DeletedAt `form:"deletedAt" json:"-" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 }
 
+// RecipeIngridient : ValueMax is the upper bound of ranges such as "2-3 siung", Value the lower one
 type RecipeIngridient struct {
-	ID        uint       `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
-	RecipeID  uint       `gorm:"recipeId" json:"-"`
-	Value     float64    `json:"value" form:"value"`
-	Unit      string     `json:"unit" form:"unit"`
-	Item      string     `json:"item" form:"item"`
-	CreatedAt time.Time  `form:"createdAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	UpdatedAt time.Time  `form:"updatedAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	DeletedAt *time.Time `form:"deletedAt" json:"-" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	ID           uint       `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
+	RecipeID     uint       `gorm:"recipeId" json:"-"`
+	Value        float64    `json:"value" form:"value"`
+	ValueMax     float64    `json:"valueMax,omitempty" form:"valueMax" example:"0"`
+	Unit         string     `json:"unit" form:"unit"`
+	Item         string     `json:"item" form:"item"`
+	IngredientID *uint      `gorm:"index" json:"ingredientId,omitempty" form:"ingredientId" swaggertype:"integer"`
+	Display      string     `gorm:"-" json:"display,omitempty" form:"-" example:"1 1/2 sdm"`
+	CreatedAt    time.Time  `form:"createdAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt    time.Time  `form:"updatedAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	DeletedAt    *time.Time `form:"deletedAt" json:"-" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 }
 
 type RecipeResult201 struct {
 	ID                    uint               `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
 	Name                  string             `form:"name" json:"name" `
 	Image                 string             `form:"image" json:"image" `
+	Thumbnails            map[string]string  `form:"thumbnails" json:"thumbnails,omitempty"`
 	NReactionLike         int                `form:"nReactionLike" json:"nReactionLike" `
 	NReactionNeutral      int                `form:"nReactionNeutral" json:"nReactionNeutral" `
 	NReactionDislike      int                `form:"nReactionDislike" json:"nReactionDislike" `
 	RecipeCategoryId      uint               `form:"recipeCategoryId" json:"recipeCategoryId"`
+	UserID                uint               `form:"userId" json:"userId"`
+	Revision              int                `form:"revision" json:"revision"`
 	NServing              float64            `form:"nServing" json:"nServing" binding:"required"`
 	IngredientsPerServing []RecipeIngridient `form:"ingredientsPerServing" json:"ingredientsPerServing" binding:"required"`
 	Steps                 []RecipeStep       `form:"steps" json:"steps" binding:"required"`
+	Tags                  []string           `form:"tags" json:"tags"`
+	ActiveTime            int                `form:"activeTime" json:"activeTime"`
+	PassiveTime           int                `form:"passiveTime" json:"passiveTime"`
+	TotalTime             int                `form:"totalTime" json:"totalTime"`
 	CreatedAt             time.Time          `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 	UpdatedAt             time.Time          `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 }
@@ -112,31 +169,135 @@ type RecipeResult200 struct {
 	ID                    uint               `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
 	Name                  string             `form:"name" json:"name" `
 	Image                 string             `form:"image" json:"image" `
+	Thumbnails            map[string]string  `form:"thumbnails" json:"thumbnails,omitempty"`
 	NReactionLike         int                `form:"nReactionLike" json:"nReactionLike" `
 	NReactionNeutral      int                `form:"nReactionNeutral" json:"nReactionNeutral" `
 	NReactionDislike      int                `form:"nReactionDislike" json:"nReactionDislike" `
+	LikeRatio             float64            `form:"likeRatio" json:"likeRatio"`
+	WilsonScore           float64            `form:"wilsonScore" json:"wilsonScore"`
 	RecipeCategoryId      uint               `form:"recipeCategoryId" json:"recipeCategoryId"`
 	NServing              float64            `form:"nServing" json:"nServing" binding:"required"`
 	IngredientsPerServing []RecipeIngridient `form:"ingredientsPerServing" json:"ingredientsPerServing" binding:"required"`
+	ActiveTime            int                `form:"activeTime" json:"activeTime"`
+	PassiveTime           int                `form:"passiveTime" json:"passiveTime"`
+	TotalTime             int                `form:"totalTime" json:"totalTime"`
 	CreatedAt             time.Time          `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 	UpdatedAt             time.Time          `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 	RecipeCategory        RecipeCategory     `form:"recipeCategory" json:"recipeCategory"`
+	UserID                uint               `form:"userId" json:"userId"`
+	Author                *RecipeAuthor      `form:"author" json:"author"`
+	Revision              int                `form:"revision" json:"revision"`
+	Nutrition             *RecipeNutrition   `form:"nutrition" json:"nutrition"`
+	Tags                  []string           `form:"tags" json:"tags"`
+	Allergens             []string           `form:"allergens" json:"allergens" example:"egg,soy"`
+	// AllergenItems : the ingredients every allergen was found in
+	AllergenItems map[string][]string `form:"allergenItems" json:"allergenItems"`
+	Diets         []string            `form:"diets" json:"diets" example:"vegetarian,halal"`
+	// AllergyWarning : allergens of the recipe in the allergy profile of the caller
+	AllergyWarning []string `form:"allergyWarning" json:"allergyWarning,omitempty"`
 }
 
 type RecipeResultGetAll struct {
-	ID               uint           `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
-	Name             string         `form:"name" json:"name" `
-	Image            string         `form:"image" json:"image" `
-	NReactionLike    int            `form:"nReactionLike" json:"nReactionLike" `
-	NReactionNeutral int            `form:"nReactionNeutral" json:"nReactionNeutral" `
-	NReactionDislike int            `form:"nReactionDislike" json:"nReactionDislike" `
-	RecipeCategoryId uint           `form:"recipeCategoryId" json:"recipeCategoryId"`
-	CreatedAt        time.Time      `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	UpdatedAt        time.Time      `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	RecipeCategory   RecipeCategory `form:"recipeCategory" json:"recipeCategory"`
+	ID               uint              `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	Name             string            `form:"name" json:"name" `
+	Image            string            `form:"image" json:"image" `
+	Thumbnails       map[string]string `form:"thumbnails" json:"thumbnails,omitempty"`
+	NReactionLike    int               `form:"nReactionLike" json:"nReactionLike" `
+	NReactionNeutral int               `form:"nReactionNeutral" json:"nReactionNeutral" `
+	NReactionDislike int               `form:"nReactionDislike" json:"nReactionDislike" `
+	LikeRatio        float64           `form:"likeRatio" json:"likeRatio"`
+	WilsonScore      float64           `form:"wilsonScore" json:"wilsonScore"`
+	RecipeCategoryId uint              `form:"recipeCategoryId" json:"recipeCategoryId"`
+	ActiveTime       int               `form:"activeTime" json:"activeTime"`
+	PassiveTime      int               `form:"passiveTime" json:"passiveTime"`
+	TotalTime        int               `form:"totalTime" json:"totalTime"`
+	CreatedAt        time.Time         `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt        time.Time         `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	RecipeCategory   RecipeCategory    `form:"recipeCategory" json:"recipeCategory"`
+	UserID           uint              `form:"userId" json:"userId"`
+	Author           *RecipeAuthor     `form:"author" json:"author"`
+	Revision         int               `form:"revision" json:"revision"`
+	Tags             []string          `form:"tags" json:"tags"`
+	Allergens        []string          `form:"allergens" json:"allergens"`
+	Diets            []string          `form:"diets" json:"diets"`
+}
+
+// RecipeAuthor is the public part of the user owning a recipe
+type RecipeAuthor struct {
+	ID       uint   `json:"id" swaggertype:"integer" example:"12345"`
+	Username string `json:"username" swaggertype:"string" example:"rozam"`
 }
 
 type RecipeResultSearch struct {
 	ID   uint   `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
 	Name string `form:"name" json:"name" `
+	// Matches names the fields the query was found in: name, category, ingredients or steps
+	Matches []string `gorm:"-" form:"-" json:"matches,omitempty" example:"name,ingredients"`
+}
+
+// RecipeScoreRange : range of the reaction score, the share of likes among all reactions of a
+// recipe in percent. Max is exclusive, except for 100.
+type RecipeScoreRange struct {
+	Key string
+	Min float64
+	Max float64
+}
+
+var RECIPE_SCORE_RANGES = []RecipeScoreRange{
+	{Key: "90-100", Min: 90, Max: 100},
+	{Key: "75-90", Min: 75, Max: 90},
+	{Key: "50-75", Min: 50, Max: 75},
+	{Key: "0-50", Min: 0, Max: 50},
+}
+
+// RECIPE_SCORE_SQL : reaction score of a recipe in SQL, NULL without reactions
+const RECIPE_SCORE_SQL = "(100 * n_reaction_like / NULLIF(n_reaction_like + n_reaction_neutral + n_reaction_dislike, 0))"
+
+// RecipeFacetValue : ID is set for categories and ingredients, Key for ranges
+type RecipeFacetValue struct {
+	ID       uint   `json:"id,omitempty" example:"2"`
+	Key      string `json:"key,omitempty" example:"75-90"`
+	Name     string `json:"name" example:"Sop"`
+	Count    int64  `json:"count" example:"12"`
+	Selected bool   `json:"selected"`
+}
+
+// RecipeFacets : counts of recipes per filter value, a facet counts with every filter applied except its own
+type RecipeFacets struct {
+	Categories  []RecipeFacetValue `json:"categories"`
+	Ingredients []RecipeFacetValue `json:"ingredients"`
+	Scores      []RecipeFacetValue `json:"scores"`
+	Tags        []RecipeFacetValue `json:"tags"`
+	Times       []RecipeFacetValue `json:"times"`
+}
+
+// RecipeListResult : Total counts every recipe matching the filters, not only this page
+type RecipeListResult struct {
+	Total   int64                `json:"total"`
+	Recipes []RecipeResultGetAll `json:"recipes"`
+	Facets  *RecipeFacets        `json:"facets,omitempty"`
+	helpers.PageCursors
+}
+
+// RecipeResultByIngredients : a recipe found by the ingredients at hand, Have and Missing name its ingredients
+type RecipeResultByIngredients struct {
+	RecipeResultGetAll
+	NIngredient int      `json:"nIngredient" example:"5"`
+	NHave       int      `json:"nHave" example:"3"`
+	NMissing    int      `json:"nMissing" example:"2"`
+	Have        []string `json:"have" example:"telur,nasi"`
+	Missing     []string `json:"missing" example:"kecap manis,daun bawang"`
+}
+
+type RecipeByIngredientsResult struct {
+	Total   int                         `json:"total"`
+	Unknown []string                    `json:"unknown" example:"kemangi"`
+	Recipes []RecipeResultByIngredients `json:"recipes"`
+}
+
+// RecipeImageResult200 holds links to an uploaded recipe picture, the links expire
+type RecipeImageResult200 struct {
+	Image      string            `json:"image"`
+	Thumbnails map[string]string `json:"thumbnails"`
+	Revision   int               `json:"revision"`
 }
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RECIPE_REACTION_COLUMNS are only written through SetServeReaction and
+// ReconcileReactionCounters, saving a recipe leaves them alone
+var RECIPE_REACTION_COLUMNS = []string{"n_reaction_like", "n_reaction_neutral", "n_reaction_dislike", "like_ratio", "wilson_score"}
+
+const recipeReactionsSQL = "(n_reaction_like + n_reaction_neutral + n_reaction_dislike)"
+
+// RECIPE_LIKE_RATIO_SQL : share of likes among all reactions, 0 without reactions
+const RECIPE_LIKE_RATIO_SQL = "COALESCE(n_reaction_like / NULLIF(" + recipeReactionsSQL + ", 0), 0)"
+
+// RECIPE_WILSON_SCORE_SQL : lower bound of the 95% Wilson score interval of the like ratio.
+// A recipe liked by 9 of 10 cooks ranks below one liked by 90 of 100, 0 without reactions.
+const RECIPE_WILSON_SCORE_SQL = "CASE WHEN " + recipeReactionsSQL + " = 0 THEN 0 ELSE (" +
+	recipeLikeShareSQL + " + 3.8416 / (2 * " + recipeReactionsSQL + ") - 1.96 * SQRT((" +
+	recipeLikeShareSQL + " * (1 - " + recipeLikeShareSQL + ") + 3.8416 / (4 * " + recipeReactionsSQL + ")) / " + recipeReactionsSQL +
+	")) / (1 + 3.8416 / " + recipeReactionsSQL + ") END"
+
+const recipeLikeShareSQL = "(n_reaction_like / " + recipeReactionsSQL + ")"
+
+// CounterColumn : column on recipes counting the reaction, empty for ReactionUnknown
+func (g Reaction) CounterColumn() string {
+	switch g {
+	case ReactionLike:
+		return "n_reaction_like"
+	case ReactionNeutral:
+		return "n_reaction_neutral"
+	case ReactionDislike:
+		return "n_reaction_dislike"
+	}
+	return ""
+}
+
+// SetServeReaction : store reaction on serve, ReactionUnknown removes it, and move the
+// counters of its recipe from the old reaction to the new one. The serve goes from completed to
+// rated and back, in any other state it fails with a ServeStateError. The change is logged. The
+// serve row is locked, two requests changing the reaction of the same serve can not count it twice.
+func SetServeReaction(db *gorm.DB, serve *Serve, reaction Reaction) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var current Serve
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", serve.ID).First(&current).Error; err != nil {
+			return err
+		}
+		state := SERVE_STATE_RATED
+		if reaction == ReactionUnknown {
+			state = SERVE_STATE_COMPLETED
+		}
+		if current.State != state && !CanTransitionServe(current.State, state) {
+			return ServeStateError{State: current.State, To: state}
+		}
+		if current.Reaction == reaction {
+			serve.Reaction = reaction
+			return nil
+		}
+
+		if err := tx.Model(serve).Update("reaction", reaction).Error; err != nil {
+			return err
+		}
+		if err := moveReactionCounters(tx, current.RecipeID, current.Reaction, reaction); err != nil {
+			return err
+		}
+		err := LogServe(tx, ServeLog{
+			ServeID:          serve.ID,
+			Type:             SERVE_EVENT_REACTION,
+			Reaction:         reaction.String(),
+			PreviousReaction: current.Reaction.String(),
+		})
+		if err != nil {
+			return err
+		}
+		if current.State != state {
+			if err := TransitionServe(tx, &current, state, tx.NowFunc()); err != nil {
+				return err
+			}
+		} else if err := TouchServe(tx, &current, tx.NowFunc()); err != nil {
+			return err
+		}
+		serve.State, serve.ActiveAt = current.State, current.ActiveAt
+		return nil
+	})
+}
+
+// moveReactionCounters : take one from the counter of from and add one to the counter of to
+func moveReactionCounters(tx *gorm.DB, recipeID uint, from Reaction, to Reaction) error {
+	counters := map[string]interface{}{}
+	if column := from.CounterColumn(); column != "" {
+		counters[column] = gorm.Expr("GREATEST(" + column + " - 1, 0)")
+	}
+	if column := to.CounterColumn(); column != "" {
+		counters[column] = gorm.Expr(column + " + 1")
+	}
+	if len(counters) == 0 {
+		return nil
+	}
+	if err := tx.Model(&Recipe{}).Where("id = ?", recipeID).UpdateColumns(counters).Error; err != nil {
+		return err
+	}
+	return RecomputeRecipeScores(tx.Where("id = ?", recipeID))
+}
+
+// RecomputeRecipeScores : like ratio and Wilson score of the recipes matched by query from
+// their counters, in a statement of its own so the counters are already updated
+func RecomputeRecipeScores(query *gorm.DB) error {
+	return query.Model(&Recipe{}).UpdateColumns(map[string]interface{}{
+		"like_ratio":   gorm.Expr(RECIPE_LIKE_RATIO_SQL),
+		"wilson_score": gorm.Expr(RECIPE_WILSON_SCORE_SQL),
+	}).Error
+}
+
+// ReconcileReactionCounters : count the reactions given on the serves of every recipe anew,
+// for counters that drifted or were seeded by hand
+func ReconcileReactionCounters(db *gorm.DB) (int64, error) {
+	var affected int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		counters := map[string]interface{}{}
+		for _, reaction := range []Reaction{ReactionLike, ReactionNeutral, ReactionDislike} {
+			counters[reaction.CounterColumn()] = gorm.Expr("(SELECT COUNT(*) FROM serves WHERE serves.recipe_id = recipes.id AND serves.reaction = ? AND serves.deleted_at IS NULL)", reaction)
+		}
+		result := tx.Model(&Recipe{}).Where("1 = 1").UpdateColumns(counters)
+		if result.Error != nil {
+			return result.Error
+		}
+		affected = result.RowsAffected
+		return RecomputeRecipeScores(tx.Where("1 = 1"))
+	})
+	return affected, err
+}
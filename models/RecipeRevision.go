@@ -0,0 +1,295 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RecipeRevision is an immutable snapshot of a recipe, one is written on every create, edit and restore
+type RecipeRevision struct {
+	ID               uint                `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
+	RecipeID         uint                `gorm:"uniqueIndex:idx_recipe_revision" json:"recipeId" form:"recipeId"`
+	Revision         int                 `gorm:"uniqueIndex:idx_recipe_revision" json:"revision" form:"revision"`
+	Name             string              `json:"name" form:"name"`
+	Image            string              `json:"image" form:"image"`
+	ImageKey         string              `gorm:"size:255" json:"-" form:"-"`
+	NServing         float64             `json:"nServing" form:"nServing"`
+	RecipeCategoryId uint                `json:"recipeCategoryId" form:"recipeCategoryId"`
+	Ingredients      RevisionIngredients `gorm:"type:text" json:"ingredientsPerServing" form:"ingredientsPerServing"`
+	Steps            RevisionSteps       `gorm:"type:text" json:"steps" form:"steps"`
+	UserID           uint                `json:"userId" form:"userId"`
+	Note             string              `json:"note" form:"note"`
+	CreatedAt        time.Time           `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+type RevisionIngredient struct {
+	Value    float64 `json:"value"`
+	ValueMax float64 `json:"valueMax,omitempty"`
+	Unit     string  `json:"unit"`
+	Item     string  `json:"item"`
+}
+
+type RevisionStep struct {
+	StepOrder      int    `json:"stepOrder"`
+	Description    string `json:"description"`
+	ActiveSeconds  *int   `json:"activeSeconds,omitempty"`
+	PassiveSeconds *int   `json:"passiveSeconds,omitempty"`
+	DurationSource string `json:"durationSource,omitempty"`
+}
+
+type RevisionIngredients []RevisionIngredient
+
+type RevisionSteps []RevisionStep
+
+func (r RevisionIngredients) Value() (driver.Value, error) {
+	return marshalRevisionColumn(r)
+}
+
+func (r *RevisionIngredients) Scan(value interface{}) error {
+	return unmarshalRevisionColumn(value, r)
+}
+
+func (r RevisionSteps) Value() (driver.Value, error) {
+	return marshalRevisionColumn(r)
+}
+
+func (r *RevisionSteps) Scan(value interface{}) error {
+	return unmarshalRevisionColumn(value, r)
+}
+
+func marshalRevisionColumn(value interface{}) (driver.Value, error) {
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+func unmarshalRevisionColumn(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	}
+	return errors.New("unsupported revision column type")
+}
+
+// NewRecipeRevision : snapshot of recipe with its ingredients and steps, revision number excluded
+func NewRecipeRevision(recipe Recipe, ingredients []RecipeIngridient, steps []RecipeStep) RecipeRevision {
+	revision := RecipeRevision{
+		RecipeID:         recipe.ID,
+		Name:             recipe.Name,
+		Image:            recipe.Image,
+		ImageKey:         recipe.ImageKey,
+		NServing:         recipe.NServing,
+		RecipeCategoryId: recipe.RecipeCategoryId,
+		Ingredients:      RevisionIngredients{},
+		Steps:            RevisionSteps{},
+	}
+	for _, ingredient := range ingredients {
+		revision.Ingredients = append(revision.Ingredients, RevisionIngredient{Value: ingredient.Value, ValueMax: ingredient.ValueMax, Unit: ingredient.Unit, Item: ingredient.Item})
+	}
+	for _, step := range steps {
+		revision.Steps = append(revision.Steps, RevisionStep{
+			StepOrder:      step.StepOrder,
+			Description:    step.Description,
+			ActiveSeconds:  step.ActiveSeconds,
+			PassiveSeconds: step.PassiveSeconds,
+			DurationSource: step.DurationSource,
+		})
+	}
+	sort.Slice(revision.Steps, func(i, j int) bool { return revision.Steps[i].StepOrder < revision.Steps[j].StepOrder })
+	return revision
+}
+
+// RecipeIngridients : ingredients of the snapshot ready to be written back
+func (r RecipeRevision) RecipeIngridients() []RecipeIngridient {
+	ingredients := []RecipeIngridient{}
+	for _, ingredient := range r.Ingredients {
+		ingredients = append(ingredients, RecipeIngridient{Value: ingredient.Value, ValueMax: ingredient.ValueMax, Unit: ingredient.Unit, Item: ingredient.Item})
+	}
+	return ingredients
+}
+
+// RecipeSteps : steps of the snapshot ready to be written back
+func (r RecipeRevision) RecipeSteps() []RecipeStep {
+	steps := []RecipeStep{}
+	for _, step := range r.Steps {
+		steps = append(steps, RecipeStep{
+			StepOrder:      step.StepOrder,
+			Description:    step.Description,
+			ActiveSeconds:  step.ActiveSeconds,
+			PassiveSeconds: step.PassiveSeconds,
+			DurationSource: step.DurationSource,
+		})
+	}
+	return steps
+}
+
+// Step : the step with stepOrder in this revision
+func (r RecipeRevision) Step(stepOrder int) (RevisionStep, bool) {
+	for _, step := range r.Steps {
+		if step.StepOrder == stepOrder {
+			return step, true
+		}
+	}
+	return RevisionStep{}, false
+}
+
+type RecipeRevisionSummary struct {
+	Revision  int       `json:"revision"`
+	Name      string    `json:"name"`
+	UserID    uint      `json:"userId"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+type RevisionFieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type RevisionIngredientChange struct {
+	Item string             `json:"item"`
+	From RevisionIngredient `json:"from"`
+	To   RevisionIngredient `json:"to"`
+}
+
+type RevisionStepChange struct {
+	StepOrder int          `json:"stepOrder"`
+	From      RevisionStep `json:"from"`
+	To        RevisionStep `json:"to"`
+}
+
+type RecipeRevisionDiff struct {
+	From        int                     `json:"from"`
+	To          int                     `json:"to"`
+	Fields      []RevisionFieldChange   `json:"fields"`
+	Ingredients RevisionIngredientsDiff `json:"ingredients"`
+	Steps       RevisionStepsDiff       `json:"steps"`
+}
+
+type RevisionIngredientsDiff struct {
+	Added   []RevisionIngredient       `json:"added"`
+	Removed []RevisionIngredient       `json:"removed"`
+	Changed []RevisionIngredientChange `json:"changed"`
+}
+
+type RevisionStepsDiff struct {
+	Added   []RevisionStep       `json:"added"`
+	Removed []RevisionStep       `json:"removed"`
+	Changed []RevisionStepChange `json:"changed"`
+}
+
+// DiffRecipeRevisions : what changed going from one revision to another.
+// Ingredients are matched by item name, steps by their order. Changed steps
+// differ in their description or durations.
+func DiffRecipeRevisions(from RecipeRevision, to RecipeRevision) RecipeRevisionDiff {
+	diff := RecipeRevisionDiff{
+		From:   from.Revision,
+		To:     to.Revision,
+		Fields: []RevisionFieldChange{},
+		Ingredients: RevisionIngredientsDiff{
+			Added:   []RevisionIngredient{},
+			Removed: []RevisionIngredient{},
+			Changed: []RevisionIngredientChange{},
+		},
+		Steps: RevisionStepsDiff{
+			Added:   []RevisionStep{},
+			Removed: []RevisionStep{},
+			Changed: []RevisionStepChange{},
+		},
+	}
+
+	if from.Name != to.Name {
+		diff.Fields = append(diff.Fields, RevisionFieldChange{Field: "name", From: from.Name, To: to.Name})
+	}
+	if from.Image != to.Image || from.ImageKey != to.ImageKey {
+		diff.Fields = append(diff.Fields, RevisionFieldChange{Field: "image", From: from.Image, To: to.Image})
+	}
+	if from.NServing != to.NServing {
+		diff.Fields = append(diff.Fields, RevisionFieldChange{Field: "nServing", From: from.NServing, To: to.NServing})
+	}
+	if from.RecipeCategoryId != to.RecipeCategoryId {
+		diff.Fields = append(diff.Fields, RevisionFieldChange{Field: "recipeCategoryId", From: from.RecipeCategoryId, To: to.RecipeCategoryId})
+	}
+
+	fromIngredients := keyRevisionIngredients(from.Ingredients)
+	toIngredients := keyRevisionIngredients(to.Ingredients)
+	for _, key := range sortedKeys(fromIngredients) {
+		old := fromIngredients[key]
+		current, ok := toIngredients[key]
+		if !ok {
+			diff.Ingredients.Removed = append(diff.Ingredients.Removed, old)
+		} else if old != current {
+			diff.Ingredients.Changed = append(diff.Ingredients.Changed, RevisionIngredientChange{Item: current.Item, From: old, To: current})
+		}
+	}
+	for _, key := range sortedKeys(toIngredients) {
+		if _, ok := fromIngredients[key]; !ok {
+			diff.Ingredients.Added = append(diff.Ingredients.Added, toIngredients[key])
+		}
+	}
+
+	fromSteps := make(map[int]RevisionStep)
+	for _, step := range from.Steps {
+		fromSteps[step.StepOrder] = step
+	}
+	toSteps := make(map[int]RevisionStep)
+	for _, step := range to.Steps {
+		toSteps[step.StepOrder] = step
+	}
+	for _, step := range from.Steps {
+		current, ok := toSteps[step.StepOrder]
+		if !ok {
+			diff.Steps.Removed = append(diff.Steps.Removed, step)
+		} else if !sameRevisionStep(step, current) {
+			diff.Steps.Changed = append(diff.Steps.Changed, RevisionStepChange{StepOrder: step.StepOrder, From: step, To: current})
+		}
+	}
+	for _, step := range to.Steps {
+		if _, ok := fromSteps[step.StepOrder]; !ok {
+			diff.Steps.Added = append(diff.Steps.Added, step)
+		}
+	}
+
+	return diff
+}
+
+// sameRevisionStep : steps with the same description and durations, a step timed differently has changed
+func sameRevisionStep(a RevisionStep, b RevisionStep) bool {
+	sameSeconds := func(x *int, y *int) bool {
+		return (x == nil && y == nil) || (x != nil && y != nil && *x == *y)
+	}
+	return a.Description == b.Description && sameSeconds(a.ActiveSeconds, b.ActiveSeconds) && sameSeconds(a.PassiveSeconds, b.PassiveSeconds) && a.DurationSource == b.DurationSource
+}
+
+// keyRevisionIngredients : index ingredients by lower cased item, repeated items get a counter
+func keyRevisionIngredients(ingredients RevisionIngredients) map[string]RevisionIngredient {
+	keyed := make(map[string]RevisionIngredient)
+	seen := make(map[string]int)
+	for _, ingredient := range ingredients {
+		key := strings.ToLower(strings.TrimSpace(ingredient.Item))
+		seen[key]++
+		if seen[key] > 1 {
+			key = fmt.Sprintf("%s#%d", key, seen[key])
+		}
+		keyed[key] = ingredient
+	}
+	return keyed
+}
+
+func sortedKeys(m map[string]RevisionIngredient) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
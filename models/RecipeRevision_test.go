@@ -0,0 +1,55 @@
+package models
+
+import "testing"
+
+func TestDiffRecipeRevisionsSteps(t *testing.T) {
+	seconds := func(n int) *int { return &n }
+	from := RecipeRevision{Revision: 1, Steps: RevisionSteps{
+		{StepOrder: 1, Description: "Tumis bumbu", ActiveSeconds: seconds(120), DurationSource: "extracted"},
+		{StepOrder: 2, Description: "Panggang", PassiveSeconds: seconds(1800), DurationSource: "manual"},
+	}}
+
+	tests := []struct {
+		name    string
+		steps   RevisionSteps
+		changed []int
+	}{
+		{"unchanged", from.Steps, []int{}},
+		{"description", RevisionSteps{
+			{StepOrder: 1, Description: "Tumis bumbu halus", ActiveSeconds: seconds(120), DurationSource: "extracted"},
+			from.Steps[1],
+		}, []int{1}},
+		{"active seconds", RevisionSteps{
+			{StepOrder: 1, Description: "Tumis bumbu", ActiveSeconds: seconds(180), DurationSource: "extracted"},
+			from.Steps[1],
+		}, []int{1}},
+		{"passive seconds left out", RevisionSteps{
+			from.Steps[0],
+			{StepOrder: 2, Description: "Panggang", DurationSource: "manual"},
+		}, []int{2}},
+		{"duration source", RevisionSteps{
+			{StepOrder: 1, Description: "Tumis bumbu", ActiveSeconds: seconds(120), DurationSource: "manual"},
+			from.Steps[1],
+		}, []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffRecipeRevisions(from, RecipeRevision{Revision: 2, Steps: tt.steps})
+			if len(diff.Steps.Added) != 0 || len(diff.Steps.Removed) != 0 {
+				t.Errorf("added %v, removed %v, want none", diff.Steps.Added, diff.Steps.Removed)
+			}
+			if len(diff.Steps.Changed) != len(tt.changed) {
+				t.Fatalf("changed = %+v, want steps %v", diff.Steps.Changed, tt.changed)
+			}
+			for idx, change := range diff.Steps.Changed {
+				if change.StepOrder != tt.changed[idx] {
+					t.Errorf("changed step %d, want %d", change.StepOrder, tt.changed[idx])
+				}
+				if !sameRevisionStep(change.From, from.Steps[change.StepOrder-1]) || !sameRevisionStep(change.To, tt.steps[change.StepOrder-1]) {
+					t.Errorf("change = %+v, want from %+v to %+v", change, from.Steps[change.StepOrder-1], tt.steps[change.StepOrder-1])
+				}
+			}
+		})
+	}
+}
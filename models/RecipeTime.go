@@ -0,0 +1,71 @@
+package models
+
+import (
+	"github.com/nadhirfr/codefood/helpers"
+	"gorm.io/gorm"
+)
+
+// where the durations of a step came from, empty when the step has none
+const (
+	STEP_DURATION_MANUAL    = "manual"
+	STEP_DURATION_EXTRACTED = "extracted"
+)
+
+// RecipeTimeRange : range of the total time of a recipe in minutes, Min inclusive, Max
+// exclusive and open ended when 0 ("120-" is two hours or more)
+type RecipeTimeRange struct {
+	Key string
+	Min int
+	Max int
+}
+
+var RECIPE_TIME_RANGES = []RecipeTimeRange{
+	{Key: "0-15", Min: 0, Max: 15},
+	{Key: "15-30", Min: 15, Max: 30},
+	{Key: "30-60", Min: 30, Max: 60},
+	{Key: "60-120", Min: 60, Max: 120},
+	{Key: "120-", Min: 120},
+}
+
+// SetStepDurations : read the durations of steps sent without any from their descriptions.
+// Steps sent back with durationSource "extracted" are read again, their description may
+// have changed.
+func SetStepDurations(steps []RecipeStep) {
+	for idx := range steps {
+		step := &steps[idx]
+		if step.DurationSource != STEP_DURATION_EXTRACTED && (step.ActiveSeconds != nil || step.PassiveSeconds != nil) {
+			step.DurationSource = STEP_DURATION_MANUAL
+			continue
+		}
+
+		step.ActiveSeconds, step.PassiveSeconds, step.DurationSource = nil, nil, ""
+		duration, ok := helpers.ExtractStepDuration(step.Description)
+		if !ok {
+			continue
+		}
+		step.ActiveSeconds = &duration.ActiveSeconds
+		step.PassiveSeconds = &duration.PassiveSeconds
+		step.DurationSource = STEP_DURATION_EXTRACTED
+	}
+}
+
+// ApplyRecipeTimes : store the times of recipe added up from its steps
+func ApplyRecipeTimes(tx *gorm.DB, recipe *Recipe, steps []RecipeStep) error {
+	recipe.ActiveTime, recipe.PassiveTime = 0, 0
+	for _, step := range steps {
+		if step.ActiveSeconds != nil {
+			recipe.ActiveTime += *step.ActiveSeconds
+		}
+		if step.PassiveSeconds != nil {
+			recipe.PassiveTime += *step.PassiveSeconds
+		}
+	}
+	recipe.TotalTime = recipe.ActiveTime + recipe.PassiveTime
+	recipe.TimesVersion = helpers.STEP_DURATION_RULES_VERSION
+	return tx.Model(recipe).UpdateColumns(map[string]interface{}{
+		"active_time":   recipe.ActiveTime,
+		"passive_time":  recipe.PassiveTime,
+		"total_time":    recipe.TotalTime,
+		"times_version": recipe.TimesVersion,
+	}).Error
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"github.com/nadhirfr/codefood/helpers"
+)
+
+// difficulty of a review, 0 when the cook did not rate it
+const (
+	REVIEW_DIFFICULTY_MIN = 1
+	REVIEW_DIFFICULTY_MAX = 5
+)
+
+// Review : what the cook wrote about a serve they finished and reacted to, one per serve.
+// Hidden reviews are left out of the feed of the recipe, reviews reported often enough are
+// hidden until a moderator looks at them.
+type Review struct {
+	ID       uint `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	ServeID  uint `gorm:"uniqueIndex" form:"serveId" json:"serveId"`
+	RecipeID uint `gorm:"index" form:"recipeId" json:"recipeId"`
+	// RecipeRevision is the revision of the recipe that was cooked
+	RecipeRevision int        `form:"recipeRevision" json:"recipeRevision"`
+	UserID         uint       `gorm:"index" form:"userId" json:"userId"`
+	Text           string     `gorm:"size:2000" form:"text" json:"text"`
+	Difficulty     int        `gorm:"index" form:"difficulty" json:"difficulty"`
+	PhotoKey       string     `gorm:"size:255" form:"-" json:"-"`
+	Hidden         bool       `gorm:"index" form:"hidden" json:"hidden"`
+	NReport        int        `gorm:"index" form:"nReport" json:"nReport"`
+	CreatedAt      time.Time  `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt      time.Time  `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	DeletedAt      *time.Time `form:"deletedAt" json:"-" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+// ReviewReport : a user reporting a review as abusive, every user reports a review once
+type ReviewReport struct {
+	ID        uint      `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	ReviewID  uint      `gorm:"uniqueIndex:idx_review_report" form:"reviewId" json:"reviewId"`
+	UserID    uint      `gorm:"uniqueIndex:idx_review_report" form:"userId" json:"userId"`
+	Reason    string    `gorm:"size:255" form:"reason" json:"reason"`
+	CreatedAt time.Time `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+// ReviewEdit : text and difficulty (1 easy to 5 hard, 0 not rated) of the review of a serve
+type ReviewEdit struct {
+	Text       string `form:"text" json:"text" binding:"max=2000" example:"Enak, tapi kurangi garamnya"`
+	Difficulty int    `form:"difficulty" json:"difficulty" example:"2"`
+}
+
+type ReviewHide struct {
+	Hidden *bool `form:"hidden" json:"hidden" binding:"required" example:"true"`
+}
+
+type ReviewReportCreate struct {
+	Reason string `form:"reason" json:"reason" binding:"required,max=255" example:"spam"`
+}
+
+// ReviewResult : Photo links expire like the pictures of recipes. NReport and ReportReasons
+// are only shown to moderators, UserID and Author are left out of shared serve histories.
+type ReviewResult struct {
+	ID              uint              `json:"id" swaggertype:"integer"`
+	ServeID         uint              `json:"serveId"`
+	RecipeID        uint              `json:"recipeId"`
+	RecipeRevision  int               `json:"recipeRevision"`
+	UserID          uint              `json:"userId,omitempty"`
+	Author          *RecipeAuthor     `json:"author,omitempty"`
+	Reaction        string            `json:"reaction" example:"like"`
+	Text            string            `json:"text"`
+	Difficulty      int               `json:"difficulty" example:"2"`
+	Photo           string            `json:"photo,omitempty"`
+	PhotoThumbnails map[string]string `json:"photoThumbnails,omitempty"`
+	Hidden          bool              `json:"hidden"`
+	NReport         int               `json:"nReport,omitempty"`
+	ReportReasons   []string          `json:"reportReasons,omitempty"`
+	CreatedAt       time.Time         `json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt       time.Time         `json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+// ReviewListResult : Difficulty is the average difficulty of the listed reviews that rate it,
+// over every page, 0 when none does
+type ReviewListResult struct {
+	Total      int            `json:"total"`
+	Difficulty float64        `json:"difficulty" example:"2.5"`
+	Reviews    []ReviewResult `json:"reviews"`
+	helpers.PageCursors
+}
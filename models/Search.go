@@ -0,0 +1,97 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"github.com/nadhirfr/codefood/search"
+	"gorm.io/gorm"
+)
+
+// RecipeSearchDocuments : the full text documents of recipeIds, all recipes when recipeIds is nil.
+// Tags are indexed as well. Ingredients are indexed with the names and translations of their catalog ingredient too,
+// so "shallot" finds a recipe listing "bawang merah".
+func RecipeSearchDocuments(db *gorm.DB, recipeIds []uint) ([]search.Document, error) {
+	var recipes []Recipe
+	query := db.Model(&Recipe{})
+	if recipeIds != nil {
+		query = query.Where("id IN ?", recipeIds)
+	}
+	if err := query.Preload("RecipeIngridients").Preload("RecipeSteps").Find(&recipes).Error; err != nil {
+		return nil, err
+	}
+	if len(recipes) == 0 {
+		return []search.Document{}, nil
+	}
+
+	categoryIds := []uint{}
+	ingredientIds := []uint{}
+	for _, recipe := range recipes {
+		categoryIds = append(categoryIds, recipe.RecipeCategoryId)
+		for _, ingredient := range recipe.RecipeIngridients {
+			if ingredient.IngredientID != nil {
+				ingredientIds = append(ingredientIds, *ingredient.IngredientID)
+			}
+		}
+	}
+
+	var categories []RecipeCategory
+	if err := db.Where("id IN ?", categoryIds).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	categoryNames := make(map[uint]string)
+	for _, category := range categories {
+		categoryNames[category.ID] = category.Name
+	}
+
+	recipeIds = make([]uint, 0, len(recipes))
+	for _, recipe := range recipes {
+		recipeIds = append(recipeIds, recipe.ID)
+	}
+	tagNames, err := RecipeTagNames(db, recipeIds)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogNames := make(map[uint][]string)
+	if len(ingredientIds) > 0 {
+		var ingredients []Ingredient
+		if err := db.Preload("Translations").Where("id IN ?", ingredientIds).Find(&ingredients).Error; err != nil {
+			return nil, err
+		}
+		for _, ingredient := range ingredients {
+			names := []string{ingredient.Name}
+			for _, translation := range ingredient.Translations {
+				names = append(names, translation.Name)
+			}
+			catalogNames[ingredient.ID] = names
+		}
+	}
+
+	documents := make([]search.Document, 0, len(recipes))
+	for _, recipe := range recipes {
+		ingredients := []string{}
+		for _, ingredient := range recipe.RecipeIngridients {
+			ingredients = append(ingredients, ingredient.Item)
+			if ingredient.IngredientID != nil {
+				ingredients = append(ingredients, catalogNames[*ingredient.IngredientID]...)
+			}
+		}
+		steps := []string{}
+		for _, step := range recipe.RecipeSteps {
+			steps = append(steps, step.Description)
+		}
+
+		documents = append(documents, search.Document{
+			ID: recipe.ID,
+			Fields: map[string]string{
+				helpers.SEARCH_FIELD_NAME:        recipe.Name,
+				helpers.SEARCH_FIELD_CATEGORY:    categoryNames[recipe.RecipeCategoryId],
+				helpers.SEARCH_FIELD_TAGS:        strings.Join(tagNames[recipe.ID], "\n"),
+				helpers.SEARCH_FIELD_INGREDIENTS: strings.Join(ingredients, "\n"),
+				helpers.SEARCH_FIELD_STEPS:       strings.Join(steps, "\n"),
+			},
+		})
+	}
+	return documents, nil
+}
@@ -3,18 +3,45 @@ package models
 import (
 	"strings"
 	"time"
+
+	"github.com/nadhirfr/codefood/helpers"
+	"gorm.io/gorm"
 )
 
+// Serve : State is one of SERVE_STATES, ActiveAt when the cook last did something with the history.
+// Histories are private, ShareToken is set while the cook shares a read only link to it.
 type Serve struct {
-	ID         uint        `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
-	NServing   float64     `form:"nServing" json:"nServing" binding:"required"`
-	RecipeID   uint        `form:"recipeId" json:"recipeId"`
-	UserID     uint        `form:"userId" json:"userId"`
-	Reaction   Reaction    `form:"reaction" json:"reaction"`
-	ServeSteps []ServeStep `gorm:"foreignKey:ServeID"`
-	CreatedAt  time.Time   `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	UpdatedAt  time.Time   `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	DeletedAt  *time.Time  `form:"deletedAt" json:"deletedAt" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	ID       uint    `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	NServing float64 `form:"nServing" json:"nServing" binding:"required"`
+	RecipeID uint    `form:"recipeId" json:"recipeId"`
+	// RecipeRevision is the revision of the recipe that was cooked
+	RecipeRevision int         `form:"recipeRevision" json:"recipeRevision"`
+	UserID         uint        `form:"userId" json:"userId"`
+	Reaction       Reaction    `form:"reaction" json:"reaction"`
+	State          string      `gorm:"size:16;index" form:"state" json:"state" example:"in-progress"`
+	ActiveAt       time.Time   `gorm:"index" form:"activeAt" json:"activeAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	ShareToken     *string     `gorm:"size:64;uniqueIndex" form:"-" json:"-"`
+	ServeSteps     []ServeStep `gorm:"foreignKey:ServeID"`
+	CreatedAt      time.Time   `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt      time.Time   `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	DeletedAt      *time.Time  `form:"deletedAt" json:"deletedAt" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+// AfterDelete hook defined for cascade delete
+func (serve *Serve) AfterDelete(tx *gorm.DB) error {
+	err := tx.Where(ServeStep{ServeID: serve.ID}).Delete(&ServeStep{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where(ServeLog{ServeID: serve.ID}).Delete(&ServeLog{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("review_id IN (?)", tx.Session(&gorm.Session{NewDB: true}).Model(&Review{}).Select("id").Where(Review{ServeID: serve.ID})).Delete(&ReviewReport{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where(Review{ServeID: serve.ID}).Delete(&Review{}).Error
 }
 
 // Reaction represent given rating
@@ -60,36 +87,51 @@ type ServeUpdateReaction struct {
 }
 
 type ServeStep struct {
-	ID           uint       `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
-	ServeID      uint       `form:"serveId" json:"-"`
-	RecipeStepID uint       `form:"recipeStepId" json:"recipeStepId"`
-	Done         bool       `json:"done"`
-	CreatedAt    time.Time  `form:"createdAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	UpdatedAt    time.Time  `form:"updatedAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	DeletedAt    *time.Time `form:"deletedAt" json:"-" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	ID           uint `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
+	ServeID      uint `form:"serveId" json:"-"`
+	RecipeStepID uint `form:"recipeStepId" json:"recipeStepId"`
+	Done         bool `json:"done"`
+	// StartedAt is when the cook got to the step, DoneAt when it was marked done
+	StartedAt *time.Time `json:"startedAt"`
+	DoneAt    *time.Time `json:"doneAt"`
+	CreatedAt time.Time  `form:"createdAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt time.Time  `form:"updatedAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	DeletedAt *time.Time `form:"deletedAt" json:"-" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 }
 
 type ServeRecipeStep struct {
-	ID           uint       `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
-	ServeID      uint       `form:"serveId" json:"-"`
-	RecipeStepID uint       `form:"recipeStepId" json:"recipeStepId"`
-	Done         bool       `json:"done"`
-	Description  string     `json:"description" form:"description"`
-	StepOrder    int        `form:"stepOrder" json:"stepOrder" binding:"required"`
-	CreatedAt    time.Time  `form:"createdAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	UpdatedAt    time.Time  `form:"updatedAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
-	DeletedAt    *time.Time `form:"deletedAt" json:"-" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	ID             uint       `gorm:"primaryKey" json:"-" form:"-" swaggertype:"integer"`
+	ServeID        uint       `form:"serveId" json:"-"`
+	RecipeStepID   uint       `form:"recipeStepId" json:"recipeStepId"`
+	Done           bool       `json:"done"`
+	Description    string     `json:"description" form:"description"`
+	StepOrder      int        `form:"stepOrder" json:"stepOrder" binding:"required"`
+	StartedAt      *time.Time `json:"startedAt"`
+	DoneAt         *time.Time `json:"doneAt"`
+	ActiveSeconds  *int       `json:"activeSeconds"`
+	PassiveSeconds *int       `json:"passiveSeconds"`
+	CreatedAt      time.Time  `form:"createdAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt      time.Time  `form:"updatedAt" json:"-" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	DeletedAt      *time.Time `form:"deletedAt" json:"-" gorm:"index" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 }
 
+// ServeStepResult : EndsAt is when the timer of a started step with a known duration rings
 type ServeStepResult struct {
-	StepOrder   int    `json:"stepOrder" form:"stepOrder"`
-	Description string `json:"description" form:"description"`
-	Done        bool   `json:"done"`
+	StepOrder      int        `json:"stepOrder" form:"stepOrder"`
+	Description    string     `json:"description" form:"description"`
+	Done           bool       `json:"done"`
+	ActiveSeconds  *int       `json:"activeSeconds" example:"300"`
+	PassiveSeconds *int       `json:"passiveSeconds" example:"900"`
+	StartedAt      *time.Time `json:"startedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	DoneAt         *time.Time `json:"doneAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	EndsAt         *time.Time `json:"endsAt" swaggertype:"string" example:"2021-04-12T00:59:11.652+07:00"`
 }
 
 type ServeResultGetAll struct {
 	ID                 uint      `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	UserID             uint      `form:"userId" json:"userId"`
 	RecipeID           uint      `form:"recipeId" json:"recipeId"`
+	RecipeRevision     int       `form:"recipeRevision" json:"recipeRevision"`
 	RecipeName         string    `form:"recipeName" json:"recipeName" `
 	RecipeCategoryName string    `form:"recipeCategoryName" json:"recipeCategoryName" `
 	RecipeImage        string    `form:"recipeImage" json:"recipeImage" `
@@ -99,13 +141,22 @@ type ServeResultGetAll struct {
 	NStepDone          float64   `form:"nStepDone" json:"nStepDone" binding:"required"`
 	Reaction           Reaction  `form:"reaction" json:"reaction" `
 	Status             string    `form:"status" json:"status" `
+	State              string    `form:"state" json:"state" example:"in-progress"`
 	CreatedAt          time.Time `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 	UpdatedAt          time.Time `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 }
+
+type ServeListResult struct {
+	Total   int                 `json:"total"`
+	History []ServeResultGetAll `json:"history"`
+	helpers.PageCursors
+}
+
 type ServeResult201 struct {
 	ID                 uint              `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
-	UserID             uint              `form:"userId" json:"userId"`
+	UserID             uint              `form:"userId" json:"userId,omitempty"`
 	RecipeID           uint              `form:"recipeId" json:"recipeId"`
+	RecipeRevision     int               `form:"recipeRevision" json:"recipeRevision"`
 	RecipeName         string            `form:"recipeName" json:"recipeName" `
 	RecipeCategoryName string            `form:"recipeCategoryName" json:"recipeCategoryName" `
 	RecipeImage        string            `form:"recipeImage" json:"recipeImage" `
@@ -116,6 +167,38 @@ type ServeResult201 struct {
 	Steps              []ServeStepResult `form:"steps" json:"steps" binding:"required"`
 	Reaction           Reaction          `form:"reaction" json:"reaction" `
 	Status             string            `form:"status" json:"status" `
+	State              string            `form:"state" json:"state" example:"in-progress"`
+	Review             *ReviewResult     `form:"review" json:"review,omitempty"`
 	CreatedAt          time.Time         `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 	UpdatedAt          time.Time         `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
 }
+
+// ServeShareResult : ShareURL is public, anyone having it reads the history until sharing stops
+type ServeShareResult struct {
+	ShareToken string `json:"shareToken" example:"Zk3o1c9Q2v8m7sYb4Hq0aXwT6nL5pR1e"`
+	ShareURL   string `json:"shareUrl" example:"http://localhost:3030/serve-histories/shared/Zk3o1c9Q2v8m7sYb4Hq0aXwT6nL5pR1e"`
+}
+
+// kinds of live updates of a serve history
+const (
+	SERVE_EVENT_STEP_STARTED = "step-started"
+	SERVE_EVENT_STEP_DONE    = "step-done"
+	SERVE_EVENT_STEP_UNDONE  = "step-undone"
+	SERVE_EVENT_TIMER_ENDED  = "timer-ended"
+	SERVE_EVENT_REACTION     = "reaction"
+	SERVE_EVENT_STATE        = "state"
+	// sent by the streams themselves, once subscribed and to keep the connection alive
+	SERVE_EVENT_READY = "ready"
+	SERVE_EVENT_PING  = "ping"
+)
+
+// ServeEvent : a live update of a serve history. Step is the step it is about, Serve the
+// whole history after steps were done, a reaction was given or the state changed.
+type ServeEvent struct {
+	Type     string           `json:"type" example:"step-done"`
+	ServeID  uint             `json:"serveId" example:"1"`
+	Step     *ServeStepResult `json:"step,omitempty"`
+	Reaction string           `json:"reaction,omitempty" example:"like"`
+	Serve    *ServeResult201  `json:"serve,omitempty"`
+	At       time.Time        `json:"at" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// states of a serve history
+const (
+	SERVE_STATE_IN_PROGRESS = "in-progress"
+	SERVE_STATE_PAUSED      = "paused"
+	// the cook gave up, by hand or by leaving the history untouched for too long
+	SERVE_STATE_ABANDONED = "abandoned"
+	// every step is done, a reaction is missing
+	SERVE_STATE_COMPLETED = "completed"
+	SERVE_STATE_RATED     = "rated"
+)
+
+// SERVE_STATES in the order a serve history usually goes through them
+var SERVE_STATES = []string{SERVE_STATE_IN_PROGRESS, SERVE_STATE_PAUSED, SERVE_STATE_ABANDONED, SERVE_STATE_COMPLETED, SERVE_STATE_RATED}
+
+// serveTransitions : the states a serve history may go to from each state. Completed goes back
+// to in progress when a step is undone, rated back to completed when the reaction is removed.
+var serveTransitions = map[string][]string{
+	SERVE_STATE_IN_PROGRESS: {SERVE_STATE_PAUSED, SERVE_STATE_ABANDONED, SERVE_STATE_COMPLETED},
+	SERVE_STATE_PAUSED:      {SERVE_STATE_IN_PROGRESS, SERVE_STATE_ABANDONED},
+	SERVE_STATE_COMPLETED:   {SERVE_STATE_RATED, SERVE_STATE_IN_PROGRESS},
+	SERVE_STATE_RATED:       {SERVE_STATE_COMPLETED},
+	SERVE_STATE_ABANDONED:   {},
+}
+
+// ServeStateError : a serve history can not go to To from the state it is in
+type ServeStateError struct {
+	State string
+	To    string
+}
+
+func (e ServeStateError) Error() string {
+	return fmt.Sprintf("Serve history is %s, it can not go to %s", e.State, e.To)
+}
+
+// CanTransitionServe : whether a serve history in state from may go to state to
+func CanTransitionServe(from string, to string) bool {
+	for _, state := range serveTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsServeState : whether state is one of SERVE_STATES
+func IsServeState(state string) bool {
+	_, ok := serveTransitions[state]
+	return ok
+}
+
+// ServeStatus : the status serve histories had before they had states, "progress", "need-rating"
+// or "done", and "abandoned"
+func ServeStatus(state string) string {
+	switch state {
+	case SERVE_STATE_COMPLETED:
+		return "need-rating"
+	case SERVE_STATE_RATED:
+		return "done"
+	case SERVE_STATE_ABANDONED:
+		return "abandoned"
+	}
+	return "progress"
+}
+
+// ServeStatusStates : states of a status as filtered by, a state stands for itself. Nil for
+// anything else.
+func ServeStatusStates(status string) []string {
+	switch status {
+	case "progress":
+		return []string{SERVE_STATE_IN_PROGRESS, SERVE_STATE_PAUSED}
+	case "need-rating":
+		return []string{SERVE_STATE_COMPLETED}
+	case "done":
+		return []string{SERVE_STATE_RATED}
+	}
+	if IsServeState(status) {
+		return []string{status}
+	}
+	return nil
+}
+
+// TransitionServe : move serve to state to, logged at now. Fails with a ServeStateError when
+// its state does not allow it or changed in the meantime.
+func TransitionServe(tx *gorm.DB, serve *Serve, to string, now time.Time) error {
+	if !CanTransitionServe(serve.State, to) {
+		return ServeStateError{State: serve.State, To: to}
+	}
+
+	result := tx.Model(&Serve{}).Where("id = ? AND state = ?", serve.ID, serve.State).UpdateColumns(map[string]interface{}{
+		"state":      to,
+		"active_at":  now,
+		"updated_at": now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ServeStateError{State: serve.State, To: to}
+	}
+
+	from := serve.State
+	serve.State, serve.ActiveAt, serve.UpdatedAt = to, now, now
+	return LogServe(tx, ServeLog{ServeID: serve.ID, Type: SERVE_LOG_STATE, State: to, PreviousState: from, CreatedAt: now})
+}
+
+// TouchServe : the cook did something with the serve history at now, it is not stale. Fails
+// with a ServeStateError when the serve history left the state it was read in meanwhile, e.g.
+// it was paused from another device, the step changes made in tx are then rolled back with it.
+func TouchServe(tx *gorm.DB, serve *Serve, now time.Time) error {
+	var current Serve
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "state").Where("id = ?", serve.ID).First(&current).Error; err != nil {
+		return err
+	}
+	if current.State != serve.State {
+		return ServeStateError{State: current.State, To: serve.State}
+	}
+
+	serve.ActiveAt = now
+	return tx.Model(&Serve{}).Where("id = ?", serve.ID).UpdateColumn("active_at", now).Error
+}
+
+// AbandonStaleServes : abandon the serve histories in progress or paused without any activity
+// since before, returns how many were abandoned
+func AbandonStaleServes(db *gorm.DB, before time.Time, now time.Time) (int, error) {
+	abandoned := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var serves []Serve
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("state IN ? AND active_at < ?", []string{SERVE_STATE_IN_PROGRESS, SERVE_STATE_PAUSED}, before).
+			Find(&serves).Error
+		if err != nil {
+			return err
+		}
+		for idx := range serves {
+			if err := TransitionServe(tx, &serves[idx], SERVE_STATE_ABANDONED, now); err != nil {
+				return err
+			}
+			abandoned++
+		}
+		return nil
+	})
+	return abandoned, err
+}
+
+// DeleteServe : delete a serve history for good, its reaction is taken off the counters of the
+// recipe. The key of the photo of its review is returned, removing the stored files is left to
+// the caller.
+func DeleteServe(db *gorm.DB, serveID uint) (string, error) {
+	var photoKey string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var serve Serve
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", serveID).First(&serve).Error; err != nil {
+			return err
+		}
+		if err := moveReactionCounters(tx, serve.RecipeID, serve.Reaction, ReactionUnknown); err != nil {
+			return err
+		}
+
+		var review Review
+		if err := tx.Where(Review{ServeID: serve.ID}).Limit(1).Find(&review).Error; err != nil {
+			return err
+		}
+		photoKey = review.PhotoKey
+
+		// steps, log and review go with the serve in its AfterDelete hook
+		return tx.Delete(&serve).Error
+	})
+	return photoKey, err
+}
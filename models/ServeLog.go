@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// changes of a serve history only found in its log, the others are named like the live updates
+const (
+	SERVE_LOG_CREATED = "created"
+	// a step started on its own has not started after all when the step before is undone
+	SERVE_LOG_STEP_RESET = "step-reset"
+	// the state of the history changed, also when the history was abandoned for being stale
+	SERVE_LOG_STATE = "state"
+	// a read only link to the history was handed out or taken back
+	SERVE_LOG_SHARED   = "shared"
+	SERVE_LOG_UNSHARED = "unshared"
+)
+
+// ServeLog : one change of a serve history, kept in the order it happened. StepOrder is set
+// for changes of a step, Reaction and PreviousReaction for changes of the reaction ("" is none),
+// State and PreviousState for changes of the state.
+type ServeLog struct {
+	ID               uint      `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	ServeID          uint      `gorm:"index" form:"serveId" json:"serveId"`
+	Type             string    `gorm:"size:32" form:"type" json:"type" example:"step-done"`
+	StepOrder        *int      `form:"stepOrder" json:"stepOrder,omitempty" example:"2"`
+	Reaction         string    `gorm:"size:16" form:"reaction" json:"reaction,omitempty" example:"like"`
+	PreviousReaction string    `gorm:"size:16" form:"previousReaction" json:"previousReaction,omitempty"`
+	State            string    `gorm:"size:16" form:"state" json:"state,omitempty" example:"paused"`
+	PreviousState    string    `gorm:"size:16" form:"previousState" json:"previousState,omitempty"`
+	CreatedAt        time.Time `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+// NewServeStepLog : log entry of a change of step stepOrder at
+func NewServeStepLog(serveID uint, logType string, stepOrder int, at time.Time) ServeLog {
+	return ServeLog{ServeID: serveID, Type: logType, StepOrder: &stepOrder, CreatedAt: at}
+}
+
+// LogServe : append logs to the log of their serve histories
+func LogServe(db *gorm.DB, logs ...ServeLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return db.Create(&logs).Error
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// kinds of tags, browse pages group tags by them
+const (
+	TAG_KIND_GENERAL = "general"
+	TAG_KIND_CUISINE = "cuisine"
+	TAG_KIND_DIET    = "diet"
+	TAG_KIND_FLAVOR  = "flavor"
+)
+
+var TAG_KINDS = []string{TAG_KIND_GENERAL, TAG_KIND_CUISINE, TAG_KIND_DIET, TAG_KIND_FLAVOR}
+
+// Tag labels recipes across categories, e.g. "pedas", "halal" or "jawa timur". Name is
+// normalized with TagName, tags named on a recipe that do not exist yet are created.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
+	Name      string    `gorm:"size:191;uniqueIndex" json:"name" form:"name" example:"pedas"`
+	Kind      string    `gorm:"size:32;index" json:"kind" form:"kind" example:"flavor"`
+	NRecipe   int64     `gorm:"-" json:"nRecipe" form:"-"`
+	CreatedAt time.Time `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+	UpdatedAt time.Time `form:"updatedAt" json:"updatedAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
+}
+
+type RecipeTag struct {
+	RecipeID uint `gorm:"primaryKey;autoIncrement:false" json:"recipeId"`
+	TagID    uint `gorm:"primaryKey;autoIncrement:false;index" json:"tagId"`
+}
+
+type TagCreate struct {
+	Name string `form:"name" json:"name" binding:"required" example:"pedas"`
+	Kind string `form:"kind" json:"kind" example:"flavor"`
+}
+
+// TagResult : Weight ranks the tag from 1 to 5 by its usage, for the font size in a tag cloud
+type TagResult struct {
+	Tag
+	Weight int `json:"weight"`
+}
+
+// TagName : tags are lower case with single spaces, "Jawa  Timur" and "jawa timur" are one tag
+func TagName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+func IsTagKind(kind string) bool {
+	for _, tagKind := range TAG_KINDS {
+		if kind == tagKind {
+			return true
+		}
+	}
+	return false
+}
+
+// RecipeTagIds : ids of the tags named names, creating the missing ones as general tags.
+// Recipes saved at the same time may add the same tag, the insert skips a tag that exists
+// and the tag is read back locked so the one that was committed first is seen.
+func RecipeTagIds(tx *gorm.DB, names []string) ([]uint, error) {
+	ids := []uint{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = TagName(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Tag{Name: name, Kind: TAG_KIND_GENERAL}).Error; err != nil {
+			return nil, err
+		}
+		var tag Tag
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", name).First(&tag).Error; err != nil {
+			return nil, err
+		}
+		ids = append(ids, tag.ID)
+	}
+	return ids, nil
+}
+
+// RecipeTagNames : names of the tags of every recipe in recipeIds
+func RecipeTagNames(db *gorm.DB, recipeIds []uint) (map[uint][]string, error) {
+	names := make(map[uint][]string)
+	if len(recipeIds) == 0 {
+		return names, nil
+	}
+
+	var rows []struct {
+		RecipeID uint
+		Name     string
+	}
+	err := db.Model(&RecipeTag{}).Select("recipe_tags.recipe_id, tags.name").
+		Joins("INNER JOIN tags ON tags.id = recipe_tags.tag_id").
+		Where("recipe_tags.recipe_id IN ?", recipeIds).Order("tags.name asc").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		names[row.RecipeID] = append(names[row.RecipeID], row.Name)
+	}
+	return names, nil
+}
@@ -13,6 +13,7 @@ type User struct {
 	ID              uint              `gorm:"primaryKey" json:"id" form:"id" swaggertype:"integer"`
 	Username        string            `gorm:"type:varchar(300);unique_index" form:"username" json:"username" binding:"required,max=300" swaggertype:"string" example:"rozam"`
 	Password        string            `gorm:"size:300" form:"password" json:"password,omitempty" binding:"required,min=6,max=300"`
+	Role            string            `gorm:"size:50;default:personal" form:"-" json:"role"`
 	Serves          []Serve           `gorm:"foreignKey:UserID"`
 	UserLoginFailed []UserLoginFailed `gorm:"foreignKey:UserID"`
 	CreatedAt       time.Time         `form:"createdAt" json:"createdAt" swaggertype:"string" example:"2021-04-12T00:39:11.652+07:00"`
@@ -48,7 +49,21 @@ type UserLogin struct {
 	Password string `gorm:"size:72" form:"password" json:"password,omitempty" binding:"required,min=6,max=300"`
 }
 
+type UserRefreshToken struct {
+	RefreshToken string `form:"refreshToken" json:"refreshToken" binding:"required" swaggertype:"string" example:"xxxxxx.xxxxx.xxx"`
+}
+
+type UserTokenResult200 struct {
+	Token        string `json:"token" swaggertype:"string" example:"xxxxxx.xxxxx.xxx"`
+	RefreshToken string `json:"refreshToken" swaggertype:"string" example:"xxxxxx.xxxxx.xxx"`
+}
+
+type UserUpdateRole struct {
+	Role string `form:"role" json:"role" binding:"required,oneof=personal admin" swaggertype:"string" example:"admin"`
+}
+
 type UserResult201 struct {
 	ID       uint   `json:"id" swaggertype:"integer" example:"12345"`
 	Username string `json:"username" swaggertype:"string" example:"account name"`
+	Role     string `json:"role" swaggertype:"string" example:"personal"`
 }
@@ -21,8 +21,8 @@ func SetupRouter() *gin.Engine {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"POST", "HEAD", "PATCH", "OPTIONS", "GET", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With", "If-Match"},
+		ExposeHeaders:    []string{"Content-Length", "ETag"},
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
 			return true
@@ -30,44 +30,119 @@ func SetupRouter() *gin.Engine {
 		MaxAge: 12 * time.Hour,
 	}))
 
+	r.GET("/.well-known/jwks.json", controllers.JWKSGet)
+	r.GET("/media/*key", controllers.MediaGet)
+
 	user := r.Group("/auth")
 	{
 		user.POST("/login", controllers.UserLogin)
 		user.POST("/register", controllers.UserRegister)
+		user.POST("/refresh", controllers.UserRefreshToken)
+		user.POST("/logout", helpers.TokenAuthMiddleware(), controllers.UserLogout)
+		user.POST("/logout-all", helpers.TokenAuthMiddleware(), controllers.UserLogoutAll)
 		user.GET("/detail", helpers.TokenAuthMiddleware(), controllers.UserGetByUserID)
+		user.GET("/allergies", helpers.TokenAuthMiddleware(), controllers.UserAllergiesGet)
+		user.PUT("/allergies", helpers.TokenAuthMiddleware(), controllers.UserAllergiesEdit)
+	}
+
+	users := r.Group("/users", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN))
+	{
+		users.PUT("/:user_id/role", controllers.UserEditRoleByUserID)
 	}
 
 	recipe := r.Group("/recipes")
 	{
-		recipe.POST("", controllers.RecipeCreate)
-		recipe.GET("", controllers.RecipeGetAll)
-		recipe.DELETE("/:recipe_id", controllers.RecipeDeleteByRecipeID)
-		recipe.PUT("/:recipe_id", controllers.RecipeEditByRecipeID)
-		recipe.GET("/:recipe_id", controllers.RecipeGetByRecipeID)
+		recipe.POST("", helpers.TokenAuthMiddleware(), controllers.RecipeCreate)
+		recipe.GET("", helpers.OptionalTokenAuthMiddleware(), controllers.RecipeGetAll)
+		// owner or admin, checked in the controller
+		recipe.DELETE("/:recipe_id", helpers.TokenAuthMiddleware(), controllers.RecipeDeleteByRecipeID)
+		recipe.PUT("/:recipe_id", helpers.TokenAuthMiddleware(), controllers.RecipeEditByRecipeID)
+		recipe.PATCH("/:recipe_id", helpers.TokenAuthMiddleware(), controllers.RecipePatchByRecipeID)
+		recipe.GET("/:recipe_id", helpers.OptionalTokenAuthMiddleware(), controllers.RecipeGetByRecipeID)
 		recipe.GET("/:recipe_id/steps", controllers.RecipeStepsGetByRecipeID)
+		recipe.GET("/:recipe_id/reviews", helpers.OptionalTokenAuthMiddleware(), controllers.RecipeReviewGetAll)
+		recipe.POST("/:recipe_id/image", helpers.TokenAuthMiddleware(), controllers.RecipeImageUpload)
+		recipe.GET("/:recipe_id/revisions", controllers.RecipeRevisionGetAll)
+		recipe.GET("/:recipe_id/revisions/:revision", controllers.RecipeRevisionGetByRevision)
+		recipe.GET("/:recipe_id/revisions/:revision/diff", controllers.RecipeRevisionDiff)
+		recipe.POST("/:recipe_id/revisions/:revision/restore", helpers.TokenAuthMiddleware(), controllers.RecipeRevisionRestore)
+	}
+
+	ingredients := r.Group("/ingredients")
+	{
+		ingredients.POST("/parse", controllers.IngredientParse)
+		ingredients.GET("", controllers.IngredientGetAll)
+		ingredients.POST("", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.IngredientCreate)
+		ingredients.GET("/:ingredient_id", controllers.IngredientGetByIngredientID)
+		ingredients.PUT("/:ingredient_id", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.IngredientEditByIngredientID)
+		ingredients.GET("/:ingredient_id/recipes", controllers.IngredientRecipesGetByIngredientID)
+		ingredients.POST("/:ingredient_id/merge", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.IngredientMergeByIngredientID)
+	}
+
+	tags := r.Group("/tags")
+	{
+		tags.GET("", controllers.TagGetAll)
+		tags.POST("", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.TagCreate)
+		tags.GET("/:tag_id", controllers.TagGetByTagID)
+		tags.PUT("/:tag_id", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.TagEditByTagID)
+		tags.DELETE("/:tag_id", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.TagDeleteByTagID)
 	}
 
 	search := r.Group("/search")
 	{
 		search.GET("/recipes", controllers.RecipeSearch)
+		search.GET("/recipes/by-ingredients", controllers.RecipeSearchByIngredients)
 	}
 
 	recipeCategories := r.Group("/recipe-categories")
 	{
-		recipeCategories.POST("", controllers.RecipeCategoryCreate)
+		recipeCategories.POST("", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.RecipeCategoryCreate)
 		recipeCategories.GET("", controllers.RecipeCategoryGetAll)
-		recipeCategories.DELETE("/:recipeCategory_id", controllers.RecipeCategoryDeleteByRecipeCategoryID)
-		recipeCategories.PUT("/:recipeCategory_id", controllers.RecipeCategoryEditByRecipeCategoryID)
+		recipeCategories.DELETE("/:recipeCategory_id", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.RecipeCategoryDeleteByRecipeCategoryID)
+		recipeCategories.PUT("/:recipeCategory_id", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.RecipeCategoryEditByRecipeCategoryID)
+	}
+
+	nutrition := r.Group("/nutrition")
+	{
+		nutrition.GET("/foods", controllers.NutritionFoodGetAll)
+		nutrition.GET("/foods/:food_id", controllers.NutritionFoodGetByFoodID)
+		nutrition.GET("/mappings", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.NutritionMappingGetAll)
+		nutrition.PUT("/mappings", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.NutritionMappingSave)
+		nutrition.DELETE("/mappings/:mapping_id", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.NutritionMappingDeleteByMappingID)
+		nutrition.GET("/unmatched", helpers.TokenAuthMiddleware(), helpers.RequireRole(helpers.ROLE_ADMIN), controllers.NutritionUnmatchedGetAll)
 	}
 
 	serveHistories := r.Group("/serve-histories")
 	{
 		serveHistories.POST("", helpers.TokenAuthMiddleware(), controllers.ServeCreate)
-		serveHistories.GET("", controllers.ServeGetAll)
+		// histories of the caller, admins pick another user with userId
+		serveHistories.GET("", helpers.TokenAuthMiddleware(), controllers.ServeGetAll)
+		serveHistories.GET("/shared/:share_token", controllers.ServeSharedGet)
 		serveHistories.PUT("/:serve_id/done-step", helpers.TokenAuthMiddleware(), controllers.ServeEditStepByServeID)
+		serveHistories.PUT("/:serve_id/start-step", helpers.TokenAuthMiddleware(), controllers.ServeStartStepByServeID)
+		serveHistories.PUT("/:serve_id/undo-step", helpers.TokenAuthMiddleware(), controllers.ServeUndoStepByServeID)
 		serveHistories.POST("/:serve_id/reaction", helpers.TokenAuthMiddleware(), controllers.ServeCreateReactionByServeID)
-		serveHistories.GET("/:serve_id", controllers.ServeGetByServeID)
+		serveHistories.DELETE("/:serve_id/reaction", helpers.TokenAuthMiddleware(), controllers.ServeDeleteReactionByServeID)
+		serveHistories.GET("/:serve_id/log", helpers.TokenAuthMiddleware(), controllers.ServeLogGetByServeID)
+		serveHistories.PUT("/:serve_id/pause", helpers.TokenAuthMiddleware(), controllers.ServePauseByServeID)
+		serveHistories.PUT("/:serve_id/resume", helpers.TokenAuthMiddleware(), controllers.ServeResumeByServeID)
+		serveHistories.PUT("/:serve_id/abandon", helpers.TokenAuthMiddleware(), controllers.ServeAbandonByServeID)
+		serveHistories.GET("/:serve_id", helpers.TokenAuthMiddleware(), controllers.ServeGetByServeID)
+		serveHistories.DELETE("/:serve_id", helpers.TokenAuthMiddleware(), controllers.ServeDeleteByServeID)
+		serveHistories.POST("/:serve_id/share", helpers.TokenAuthMiddleware(), controllers.ServeShareCreateByServeID)
+		serveHistories.DELETE("/:serve_id/share", helpers.TokenAuthMiddleware(), controllers.ServeShareDeleteByServeID)
+		serveHistories.PUT("/:serve_id/review", helpers.TokenAuthMiddleware(), controllers.ServeReviewEditByServeID)
+		serveHistories.POST("/:serve_id/review/photo", helpers.TokenAuthMiddleware(), controllers.ServeReviewPhotoUpload)
+		serveHistories.GET("/:serve_id/events", helpers.StreamTokenAuthMiddleware(), controllers.ServeEventsStream)
+		serveHistories.GET("/:serve_id/ws", helpers.StreamTokenAuthMiddleware(), controllers.ServeEventsSocket)
+	}
 
+	reviews := r.Group("/reviews", helpers.TokenAuthMiddleware())
+	{
+		reviews.GET("/reported", helpers.RequireRole(helpers.ROLE_ADMIN), controllers.ReviewReportedGetAll)
+		// author of the recipe or admin, checked in the controller
+		reviews.PUT("/:review_id/hidden", controllers.ReviewHideByReviewID)
+		reviews.POST("/:review_id/report", controllers.ReviewReportByReviewID)
 	}
 
 	return r
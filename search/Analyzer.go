@@ -0,0 +1,64 @@
+// Package search is a small in-process full text index. Documents are split into terms by
+// Tokenize, terms are matched exactly, by their Indonesian or English stem, by prefix and,
+// to survive typos, by edit distance. Hits are ranked with BM25 over weighted fields.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+var STOPWORDS = map[string]bool{
+	"dan": true, "yang": true, "di": true, "ke": true, "dari": true, "dengan": true, "untuk": true,
+	"atau": true, "ini": true, "itu": true, "lalu": true, "agar": true, "juga": true, "pada": true,
+	"the": true, "a": true, "an": true, "and": true, "or": true, "of": true, "to": true, "with": true,
+	"for": true, "in": true, "on": true, "into": true, "then": true,
+}
+
+var foldedLetters = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ä': 'a', 'ã': 'a', 'å': 'a',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'ö': 'o', 'õ': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u',
+	'ç': 'c', 'ñ': 'n',
+}
+
+// Tokenize : lower case terms of text without accents and stopwords
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]string, 0, len(fields))
+	for _, field := range fields {
+		token := strings.Map(func(r rune) rune {
+			if folded, ok := foldedLetters[r]; ok {
+				return folded
+			}
+			return r
+		}, field)
+		if STOPWORDS[token] {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// Stems : base forms token may have been derived from, token itself excluded. Both the
+// Indonesian and the English stemmer are tried, recipes mix both languages freely.
+func Stems(token string) []string {
+	candidates := append(stemIndonesian(token), stemEnglish(token))
+
+	stems := []string{}
+	seen := map[string]bool{token: true}
+	for _, candidate := range candidates {
+		if candidate == "" || seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		stems = append(stems, candidate)
+	}
+	return stems
+}
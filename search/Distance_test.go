@@ -0,0 +1,30 @@
+package search
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"goreng", "goreng", 2, 0},
+		{"goreng", "gorng", 2, 1},
+		{"goreng", "goreang", 2, 1},
+		{"goreng", "gorenk", 2, 1},
+		{"goreng", "gorneg", 2, 1},
+		{"rendang", "rednag", 2, 2},
+		{"bawang", "bwaang", 2, 1},
+		{"ayam", "ikan", 2, 3},
+		{"ayam", "ayampanggang", 2, 3},
+		{"sate", "soto", 1, 2},
+		{"", "nasi", 4, 4},
+		{"café", "cafe", 1, 1},
+	}
+
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("Distance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// weights of the ways a query term can match an indexed term
+const (
+	WEIGHT_EXACT  = 1.0
+	WEIGHT_STEM   = 0.9
+	WEIGHT_PREFIX = 0.8
+	WEIGHT_TYPO_1 = 0.7
+	WEIGHT_TYPO_2 = 0.5
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Field : Weight multiplies the score of matches in the field, a name counts more than a step
+type Field struct {
+	Name   string
+	Weight float64
+}
+
+// Document : text of every field, fields the index does not know are ignored
+type Document struct {
+	ID     uint
+	Fields map[string]string
+}
+
+// Hit : Fields names the fields the query matched in
+type Hit struct {
+	ID     uint
+	Score  float64
+	Fields []string
+}
+
+// postings : documents containing a term with the number of occurrences per field
+type postings map[uint][]int
+
+// Index is safe for concurrent use, searches share a read lock
+type Index struct {
+	mu     sync.RWMutex
+	fields []Field
+	docs   map[uint]*entry
+	terms  map[string]postings
+	stems  map[string]postings
+	// lengths sums the field lengths of all documents, for the BM25 averages
+	lengths []int
+	// vocabulary holds the terms sorted for prefix lookups, termsByLength groups them by
+	// their number of letters for typo lookups
+	vocabulary    []string
+	termsByLength map[int]map[string]bool
+	// version counts the calls to Put and Remove, changed holds the version of the last one per document
+	version uint64
+	changed map[uint]uint64
+}
+
+type entry struct {
+	doc     Document
+	terms   []string
+	stems   []string
+	lengths []int
+}
+
+func NewIndex(fields ...Field) *Index {
+	idx := &Index{fields: fields, changed: make(map[uint]uint64)}
+	idx.reset()
+	return idx
+}
+
+func (idx *Index) reset() {
+	idx.docs = make(map[uint]*entry)
+	idx.terms = make(map[string]postings)
+	idx.stems = make(map[string]postings)
+	idx.lengths = make([]int, len(idx.fields))
+	idx.vocabulary = []string{}
+	idx.termsByLength = make(map[int]map[string]bool)
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Put : add doc, replacing an earlier version with the same id
+func (idx *Index) Put(doc Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.touch(doc.ID)
+	idx.remove(doc.ID)
+	idx.put(doc)
+}
+
+func (idx *Index) Remove(id uint) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.touch(id)
+	idx.remove(id)
+}
+
+// Version : take it before reading the documents given to Replace
+func (idx *Index) Version() uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.version
+}
+
+// Replace : swap the whole content of the index for docs at once. Documents put or removed
+// after version, while docs were being read, are newer than docs and stay as they are.
+func (idx *Index) Replace(docs []Document, version uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// newer documents to keep, nil for the removed ones
+	newer := make(map[uint]*Document)
+	for id, changed := range idx.changed {
+		if changed <= version {
+			delete(idx.changed, id)
+			continue
+		}
+		newer[id] = nil
+		if e, ok := idx.docs[id]; ok {
+			newer[id] = &e.doc
+		}
+	}
+
+	idx.reset()
+	for _, doc := range docs {
+		if _, ok := newer[doc.ID]; !ok {
+			idx.put(doc)
+		}
+	}
+	for _, doc := range newer {
+		if doc != nil {
+			idx.put(*doc)
+		}
+	}
+}
+
+func (idx *Index) touch(id uint) {
+	idx.version++
+	idx.changed[id] = idx.version
+}
+
+func (idx *Index) put(doc Document) {
+	e := &entry{doc: doc, lengths: make([]int, len(idx.fields))}
+	exact := make(map[string][]int)
+	stemmed := make(map[string][]int)
+
+	for f, field := range idx.fields {
+		tokens := Tokenize(doc.Fields[field.Name])
+		e.lengths[f] = len(tokens)
+		idx.lengths[f] += len(tokens)
+		for _, token := range tokens {
+			countIn(exact, token, f, len(idx.fields))
+			countIn(stemmed, token, f, len(idx.fields))
+			for _, stem := range Stems(token) {
+				countIn(stemmed, stem, f, len(idx.fields))
+			}
+		}
+	}
+
+	for term, counts := range exact {
+		if idx.terms[term] == nil {
+			idx.addTerm(term)
+		}
+		addPosting(idx.terms, term, doc.ID, counts)
+		e.terms = append(e.terms, term)
+	}
+	for term, counts := range stemmed {
+		addPosting(idx.stems, term, doc.ID, counts)
+		e.stems = append(e.stems, term)
+	}
+	idx.docs[doc.ID] = e
+}
+
+func countIn(counts map[string][]int, term string, field int, nFields int) {
+	if counts[term] == nil {
+		counts[term] = make([]int, nFields)
+	}
+	counts[term][field]++
+}
+
+func addPosting(index map[string]postings, term string, id uint, counts []int) {
+	if index[term] == nil {
+		index[term] = make(postings)
+	}
+	index[term][id] = counts
+}
+
+func (idx *Index) remove(id uint) {
+	e, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range e.terms {
+		removePosting(idx.terms, term, id)
+		if idx.terms[term] == nil {
+			idx.dropTerm(term)
+		}
+	}
+	for _, term := range e.stems {
+		removePosting(idx.stems, term, id)
+	}
+	for f, length := range e.lengths {
+		idx.lengths[f] -= length
+	}
+	delete(idx.docs, id)
+}
+
+func removePosting(index map[string]postings, term string, id uint) {
+	delete(index[term], id)
+	if len(index[term]) == 0 {
+		delete(index, term)
+	}
+}
+
+func (idx *Index) addTerm(term string) {
+	at := sort.SearchStrings(idx.vocabulary, term)
+	idx.vocabulary = append(idx.vocabulary, "")
+	copy(idx.vocabulary[at+1:], idx.vocabulary[at:])
+	idx.vocabulary[at] = term
+
+	length := len([]rune(term))
+	if idx.termsByLength[length] == nil {
+		idx.termsByLength[length] = make(map[string]bool)
+	}
+	idx.termsByLength[length][term] = true
+}
+
+func (idx *Index) dropTerm(term string) {
+	if at := sort.SearchStrings(idx.vocabulary, term); at < len(idx.vocabulary) && idx.vocabulary[at] == term {
+		idx.vocabulary = append(idx.vocabulary[:at], idx.vocabulary[at+1:]...)
+	}
+
+	length := len([]rune(term))
+	delete(idx.termsByLength[length], term)
+	if len(idx.termsByLength[length]) == 0 {
+		delete(idx.termsByLength, length)
+	}
+}
+
+// candidate : indexed term a query token matched and how well
+type candidate struct {
+	postings postings
+	weight   float64
+}
+
+type match struct {
+	score  float64
+	fields []bool
+}
+
+// Search : documents matching query, the best first. Every query term has to match, when no
+// document matches them all the documents matching most of them are returned instead.
+// With prefix the last term also matches longer terms, for search as you type.
+func (idx *Index) Search(query string, prefix bool) []Hit {
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return []Hit{}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	matchesPerToken := make([]map[uint]*match, 0, len(tokens))
+	for i, token := range tokens {
+		candidates := idx.candidates(token, prefix && i == len(tokens)-1)
+		matchesPerToken = append(matchesPerToken, idx.score(candidates))
+	}
+
+	hits := idx.combine(matchesPerToken, true)
+	if len(hits) == 0 && len(tokens) > 1 {
+		hits = idx.combine(matchesPerToken, false)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
+
+func (idx *Index) candidates(token string, prefix bool) []candidate {
+	candidates := []candidate{}
+	if p, ok := idx.terms[token]; ok {
+		candidates = append(candidates, candidate{postings: p, weight: WEIGHT_EXACT})
+	}
+	for _, stem := range append([]string{token}, Stems(token)...) {
+		if p, ok := idx.stems[stem]; ok {
+			candidates = append(candidates, candidate{postings: p, weight: WEIGHT_STEM})
+		}
+	}
+
+	length := len([]rune(token))
+	maxDistance := 0
+	switch {
+	case length >= 8:
+		maxDistance = 2
+	case length >= 4:
+		maxDistance = 1
+	}
+
+	// longer terms starting with token follow it in the sorted vocabulary
+	prefixed := make(map[string]bool)
+	if prefix && length >= 2 {
+		for at := sort.SearchStrings(idx.vocabulary, token); at < len(idx.vocabulary) && strings.HasPrefix(idx.vocabulary[at], token); at++ {
+			if term := idx.vocabulary[at]; term != token {
+				prefixed[term] = true
+				candidates = append(candidates, candidate{postings: idx.terms[term], weight: WEIGHT_PREFIX})
+			}
+		}
+	}
+
+	// a term within maxDistance edits differs in length by at most maxDistance letters
+	for l := length - maxDistance; maxDistance > 0 && l <= length+maxDistance; l++ {
+		for term := range idx.termsByLength[l] {
+			if term == token || prefixed[term] {
+				continue
+			}
+			if distance := Distance(token, term, maxDistance); distance == 1 {
+				candidates = append(candidates, candidate{postings: idx.terms[term], weight: WEIGHT_TYPO_1})
+			} else if distance == 2 && maxDistance >= 2 {
+				candidates = append(candidates, candidate{postings: idx.terms[term], weight: WEIGHT_TYPO_2})
+			}
+		}
+	}
+	return candidates
+}
+
+// score : BM25 of every document for one query token, the best matching candidate counts
+func (idx *Index) score(candidates []candidate) map[uint]*match {
+	matches := make(map[uint]*match)
+	n := float64(len(idx.docs))
+	for _, c := range candidates {
+		df := float64(len(c.postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for id, counts := range c.postings {
+			e := idx.docs[id]
+			score := 0.0
+			fields := make([]bool, len(idx.fields))
+			for f, count := range counts {
+				if count == 0 {
+					continue
+				}
+				fields[f] = true
+				average := float64(idx.lengths[f]) / n
+				if average == 0 {
+					average = 1
+				}
+				tf := float64(count)
+				norm := tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(e.lengths[f])/average))
+				score += idx.fields[f].Weight * norm
+			}
+			score *= c.weight * idf
+
+			if m, ok := matches[id]; !ok || score > m.score {
+				matches[id] = &match{score: score, fields: fields}
+			}
+		}
+	}
+	return matches
+}
+
+// combine : add up the scores of the query tokens. With all every token has to match, otherwise
+// scores are lowered by the share of tokens that did not match.
+func (idx *Index) combine(matchesPerToken []map[uint]*match, all bool) []Hit {
+	type total struct {
+		score   float64
+		matched int
+		fields  []bool
+	}
+	totals := make(map[uint]*total)
+	for _, matches := range matchesPerToken {
+		for id, m := range matches {
+			t, ok := totals[id]
+			if !ok {
+				t = &total{fields: make([]bool, len(idx.fields))}
+				totals[id] = t
+			}
+			t.score += m.score
+			t.matched++
+			for f, matched := range m.fields {
+				t.fields[f] = t.fields[f] || matched
+			}
+		}
+	}
+
+	hits := []Hit{}
+	for id, t := range totals {
+		if all && t.matched < len(matchesPerToken) {
+			continue
+		}
+		hit := Hit{ID: id, Score: t.score * float64(t.matched) / float64(len(matchesPerToken)), Fields: []string{}}
+		for f, matched := range t.fields {
+			if matched {
+				hit.Fields = append(hit.Fields, idx.fields[f].Name)
+			}
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
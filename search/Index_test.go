@@ -0,0 +1,142 @@
+package search
+
+import "testing"
+
+func testIndex() *Index {
+	idx := NewIndex(Field{Name: "name", Weight: 4}, Field{Name: "steps", Weight: 0.5})
+	idx.Replace([]Document{
+		{ID: 1, Fields: map[string]string{"name": "Tumis Kangkung", "steps": "Tumis bawang putih, masukkan kangkung."}},
+		{ID: 2, Fields: map[string]string{"name": "Ayam Goreng", "steps": "Goreng ayam hingga kecokelatan."}},
+		{ID: 3, Fields: map[string]string{"name": "Nasi Goreng", "steps": "Menumis bumbu, masukkan nasi dan ayam."}},
+		{ID: 4, Fields: map[string]string{"name": "Onion Rings", "steps": "Slice the onions into rings, dip in batter."}},
+		{ID: 5, Fields: map[string]string{"name": "Tomato Salad", "steps": "Combine chopped tomatoes with basil."}},
+	}, idx.Version())
+	return idx
+}
+
+func hitIds(hits []Hit) []uint {
+	ids := []uint{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	idx := testIndex()
+	tests := []struct {
+		name   string
+		query  string
+		prefix bool
+		want   []uint
+	}{
+		{"exact", "kangkung", false, []uint{1}},
+		{"prefixed verb finds its root", "menumis", false, []uint{1, 3}},
+		{"root finds prefixed verb", "tumis", false, []uint{1, 3}},
+		{"plural", "tomato", false, []uint{5}},
+		{"chopped", "chop", false, []uint{5}},
+		{"singular finds plural", "onion", false, []uint{4}},
+		{"one typo", "kangkong", false, []uint{1}},
+		{"swapped letters", "ayma", false, []uint{2, 3}},
+		{"two typos in a long word", "kecoklatn", false, []uint{2}},
+		{"short words tolerate no typo", "nsi", false, []uint{}},
+		{"every term has to match", "nasi ayam", false, []uint{3}},
+		{"most terms when none matches all", "ayam rendang", false, []uint{2, 3}},
+		{"prefix of the last term", "tomato sal", true, []uint{5}},
+		{"no prefix without the flag", "sal", false, []uint{}},
+		{"stopwords only", "dan yang", false, []uint{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[uint]bool{}
+			for _, id := range hitIds(idx.Search(tt.query, tt.prefix)) {
+				got[id] = true
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Search(%q) = %v, want %v", tt.query, hitIds(idx.Search(tt.query, tt.prefix)), tt.want)
+			}
+			for _, id := range tt.want {
+				if !got[id] {
+					t.Fatalf("Search(%q) = %v, want %v", tt.query, hitIds(idx.Search(tt.query, tt.prefix)), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	idx := testIndex()
+
+	// goreng is in the name of 2 and 3, the shorter name ranks first on a tie of weights
+	hits := idx.Search("goreng", false)
+	if len(hits) != 2 || hits[0].ID != 2 || hits[1].ID != 3 {
+		t.Errorf("Search(goreng) = %v, want [2 3]", hitIds(hits))
+	}
+
+	// ayam is in the name of 2 and only in the steps of 3
+	hits = idx.Search("ayam", false)
+	if len(hits) != 2 || hits[0].ID != 2 || hits[0].Score <= hits[1].Score {
+		t.Errorf("Search(ayam) = %+v, want 2 first", hits)
+	}
+	if len(hits[1].Fields) != 1 || hits[1].Fields[0] != "steps" {
+		t.Errorf("Search(ayam) fields of 3 = %v, want [steps]", hits[1].Fields)
+	}
+
+	// an exact match beats a typo
+	hits = idx.Search("rings", false)
+	typo := idx.Search("ringz", false)
+	if len(hits) != 1 || len(typo) != 1 || typo[0].Score >= hits[0].Score {
+		t.Errorf("Search(ringz) = %+v, want below Search(rings) = %+v", typo, hits)
+	}
+}
+
+func TestPutAndRemove(t *testing.T) {
+	idx := testIndex()
+	idx.Put(Document{ID: 1, Fields: map[string]string{"name": "Tumis Buncis"}})
+	if hits := idx.Search("kangkung", false); len(hits) != 0 {
+		t.Errorf("Search(kangkung) after Put = %v, want none", hitIds(hits))
+	}
+	if hits := idx.Search("bunc", true); len(hits) != 1 || hits[0].ID != 1 {
+		t.Errorf("Search(bunc) after Put = %v, want [1]", hitIds(hits))
+	}
+
+	idx.Remove(1)
+	if hits := idx.Search("buncis", false); len(hits) != 0 {
+		t.Errorf("Search(buncis) after Remove = %v, want none", hitIds(hits))
+	}
+	if idx.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", idx.Len())
+	}
+}
+
+func TestReplaceKeepsNewerChanges(t *testing.T) {
+	idx := testIndex()
+
+	// documents read from the database before 1 was edited and 2 removed
+	version := idx.Version()
+	stale := []Document{
+		{ID: 1, Fields: map[string]string{"name": "Tumis Kangkung"}},
+		{ID: 2, Fields: map[string]string{"name": "Ayam Goreng"}},
+		{ID: 6, Fields: map[string]string{"name": "Soto Ayam"}},
+	}
+	idx.Put(Document{ID: 1, Fields: map[string]string{"name": "Tumis Buncis"}})
+	idx.Remove(2)
+	idx.Replace(stale, version)
+
+	if hits := idx.Search("buncis", false); len(hits) != 1 || hits[0].ID != 1 {
+		t.Errorf("Search(buncis) = %v, want the edit of 1 kept", hitIds(hits))
+	}
+	if hits := idx.Search("goreng", false); len(hits) != 0 {
+		t.Errorf("Search(goreng) = %v, want 2 to stay removed", hitIds(hits))
+	}
+	if hits := idx.Search("soto", false); len(hits) != 1 || hits[0].ID != 6 {
+		t.Errorf("Search(soto) = %v, want [6]", hitIds(hits))
+	}
+
+	// the next rebuild reads 1 after its edit and 2 removed
+	idx.Replace([]Document{{ID: 1, Fields: map[string]string{"name": "Tumis Kacang"}}}, idx.Version())
+	if hits := idx.Search("kacang", false); len(hits) != 1 || idx.Len() != 1 {
+		t.Errorf("Search(kacang) = %v with %d documents, want the rebuild applied", hitIds(hits), idx.Len())
+	}
+}
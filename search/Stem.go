@@ -0,0 +1,143 @@
+package search
+
+import "strings"
+
+// words shorter than this are never stemmed, "ikan" or "nasi" are roots already
+const minStemmedLength = 4
+
+var indonesianParticles = []string{"lah", "kah", "tah", "pun"}
+var indonesianPossessives = []string{"nya", "ku", "mu"}
+var indonesianSuffixes = []string{"kan", "an", "i"}
+
+// stemIndonesian : roots token may come from after removing affixes, after Nazief and Adriani.
+// Prefixes whose first letter melts into the root (memotong from potong, menanak from tanak)
+// are ambiguous without a dictionary, so every plausible root is returned.
+func stemIndonesian(token string) []string {
+	word := token
+	word = trimSuffixOf(word, indonesianParticles)
+	word = trimSuffixOf(word, indonesianPossessives)
+
+	// the last letters may be part of the root, mencuci comes from cuci and not from cuc
+	roots := []string{word}
+	if root := trimSuffixOf(word, indonesianSuffixes); root != word {
+		roots = append(roots, root)
+	}
+	// at most two prefixes, "diperkecil"
+	frontier := roots
+	for round := 0; round < 2 && len(frontier) > 0; round++ {
+		next := []string{}
+		for _, root := range frontier {
+			next = append(next, stripIndonesianPrefix(root)...)
+		}
+		roots = append(roots, next...)
+		frontier = next
+	}
+	return roots
+}
+
+func trimSuffixOf(word string, suffixes []string) string {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= minStemmedLength {
+			return strings.TrimSuffix(word, suffix)
+		}
+	}
+	return word
+}
+
+// stripIndonesianPrefix : candidate roots of word without its first prefix, none when it has no prefix
+func stripIndonesianPrefix(word string) []string {
+	candidates := []string{}
+	add := func(root string) {
+		if len(root) >= minStemmedLength {
+			candidates = append(candidates, root)
+		}
+	}
+
+	for _, prefix := range []string{"me", "pe"} {
+		if !strings.HasPrefix(word, prefix) {
+			continue
+		}
+		rest := word[len(prefix):]
+		switch {
+		case strings.HasPrefix(rest, "ny") && startsWithVowel(rest[2:]):
+			add("s" + rest[2:])
+		case strings.HasPrefix(rest, "ng") && startsWithVowel(rest[2:]):
+			add(rest[2:])
+			add("k" + rest[2:])
+		case strings.HasPrefix(rest, "ng"):
+			add(rest[2:])
+		case strings.HasPrefix(rest, "m") && startsWithVowel(rest[1:]):
+			add("p" + rest[1:])
+			add("m" + rest[1:])
+		case strings.HasPrefix(rest, "m") && strings.IndexByte("bpf", byteAt(rest, 1)) >= 0:
+			add(rest[1:])
+		case strings.HasPrefix(rest, "n") && startsWithVowel(rest[1:]):
+			add("t" + rest[1:])
+			add("n" + rest[1:])
+		case strings.HasPrefix(rest, "n") && strings.IndexByte("cdjtz", byteAt(rest, 1)) >= 0:
+			add(rest[1:])
+		case prefix == "pe" && strings.HasPrefix(rest, "r"):
+			add(rest[1:])
+		case strings.IndexByte("lrwy", byteAt(rest, 0)) >= 0:
+			add(rest)
+		}
+		return candidates
+	}
+
+	// ke- and se- are left alone, too many roots start with them (kecap, selada)
+	for _, prefix := range []string{"ber", "ter", "di"} {
+		if strings.HasPrefix(word, prefix) {
+			add(word[len(prefix):])
+			return candidates
+		}
+	}
+	return candidates
+}
+
+func startsWithVowel(word string) bool {
+	return word != "" && strings.IndexByte("aeiou", word[0]) >= 0
+}
+
+func byteAt(word string, idx int) byte {
+	if idx >= len(word) {
+		return 0
+	}
+	return word[idx]
+}
+
+// stemEnglish : light English stemmer for plurals, -ing, -ed and -ly, enough for ingredient
+// lists and cooking steps ("chopped onions" finds "chop onion")
+func stemEnglish(token string) string {
+	word := token
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "oes") || strings.HasSuffix(word, "ches") || strings.HasSuffix(word, "shes") || strings.HasSuffix(word, "xes"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is") && len(word) > 3:
+		word = word[:len(word)-1]
+	}
+
+	for _, suffix := range []string{"ing", "ed"} {
+		if !strings.HasSuffix(word, suffix) {
+			continue
+		}
+		stem := word[:len(word)-len(suffix)]
+		if len(stem) < 3 || !strings.ContainsAny(stem, "aeiouy") {
+			break
+		}
+		// chopped, chopping
+		if n := len(stem); n > 3 && stem[n-1] == stem[n-2] && strings.IndexByte("bdgmnprt", stem[n-1]) >= 0 {
+			stem = stem[:n-1]
+		}
+		word = stem
+		break
+	}
+
+	if strings.HasSuffix(word, "ly") && len(word) > 5 {
+		word = word[:len(word)-2]
+	}
+	return word
+}
@@ -0,0 +1,53 @@
+package search
+
+import "testing"
+
+func TestStems(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		// Indonesian prefixes melting into the root
+		{"menumis", "tumis"},
+		{"memotong", "potong"},
+		{"menanak", "tanak"},
+		{"mengupas", "kupas"},
+		{"menyangrai", "sangrai"},
+		{"mencuci", "cuci"},
+		{"digoreng", "goreng"},
+		{"diperkecil", "kecil"},
+		{"bertabur", "tabur"},
+		{"tumisan", "tumis"},
+		{"bumbunya", "bumbu"},
+		// English plurals, -ing and -ed
+		{"onions", "onion"},
+		{"tomatoes", "tomato"},
+		{"berries", "berry"},
+		{"chopped", "chop"},
+		{"chopping", "chop"},
+		{"sliced", "slic"},
+		{"roasted", "roast"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			stems := Stems(tt.token)
+			for _, stem := range stems {
+				if stem == tt.want {
+					return
+				}
+			}
+			t.Errorf("Stems(%q) = %q, want it to contain %q", tt.token, stems, tt.want)
+		})
+	}
+}
+
+func TestStemsKeepShortRoots(t *testing.T) {
+	for _, token := range []string{"ikan", "nasi", "kecap", "selada"} {
+		for _, stem := range Stems(token) {
+			if len(stem) < minStemmedLength {
+				t.Errorf("Stems(%q) contains %q, shorter than a root", token, stem)
+			}
+		}
+	}
+}
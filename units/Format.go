@@ -0,0 +1,78 @@
+package units
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FRACTIONS : denominators used when writing kitchen amounts, an eighth is as precise as cooking gets
+var FRACTIONS = []int{2, 3, 4, 8}
+
+// Format : human friendly amount such as "1 1/2 sdm" or "250 g"
+func Format(q Quantity) string {
+	fractions := true
+	if unit, ok := Lookup(q.Unit); ok {
+		fractions = unit.Fractions
+	}
+	value := FormatValue(q.Value, fractions)
+	if q.Unit == "" {
+		return value
+	}
+	return value + " " + q.Unit
+}
+
+// FormatValue : with fractions 0.3333 reads "1/3" and 2.5 reads "2 1/2",
+// without them large amounts are whole numbers and small ones keep up to two decimals
+func FormatValue(value float64, fractions bool) string {
+	if value < 0 {
+		return "-" + FormatValue(-value, fractions)
+	}
+	if !fractions {
+		return formatDecimal(RoundValue(value, false))
+	}
+
+	whole := math.Floor(value)
+	rest := value - whole
+	bestNumerator, bestDenominator, bestError := 0, 1, rest
+	if 1-rest < bestError {
+		bestNumerator, bestDenominator, bestError = 1, 1, 1-rest
+	}
+	for _, denominator := range FRACTIONS {
+		numerator := int(math.Round(rest * float64(denominator)))
+		if numerator <= 0 || numerator >= denominator {
+			continue
+		}
+		if err := math.Abs(rest - float64(numerator)/float64(denominator)); err < bestError-1e-9 {
+			bestNumerator, bestDenominator, bestError = numerator, denominator, err
+		}
+	}
+
+	if bestDenominator == 1 {
+		whole += float64(bestNumerator)
+		if whole == 0 {
+			// too small for an eighth, a fraction would read as nothing
+			return formatDecimal(RoundValue(value, false))
+		}
+		return strconv.FormatFloat(whole, 'f', 0, 64)
+	}
+	fraction := strconv.Itoa(bestNumerator) + "/" + strconv.Itoa(bestDenominator)
+	if whole == 0 {
+		return fraction
+	}
+	return strconv.FormatFloat(whole, 'f', 0, 64) + " " + fraction
+}
+
+// RoundValue : the number sent along the formatted amount
+func RoundValue(value float64, fractions bool) float64 {
+	if !fractions && math.Abs(value) >= 10 {
+		return math.Round(value)
+	}
+	return math.Round(value*100) / 100
+}
+
+func formatDecimal(value float64) string {
+	s := strconv.FormatFloat(value, 'f', 2, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return s
+}
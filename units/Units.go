@@ -0,0 +1,170 @@
+// Package units knows the measures used in ingredient lists, converts quantities
+// between metric, imperial and Indonesian kitchen units and formats them for people.
+package units
+
+import (
+	"math"
+	"strings"
+)
+
+type Dimension string
+
+const (
+	MASS   Dimension = "mass"
+	VOLUME Dimension = "volume"
+	COUNT  Dimension = "count"
+)
+
+type System string
+
+const (
+	METRIC   System = "metric"
+	IMPERIAL System = "imperial"
+	// KITCHEN are the spoons and glasses of Indonesian recipes
+	KITCHEN System = "kitchen"
+)
+
+// Unit : Factor converts one unit to the base of its dimension (gram, millilitre or piece).
+// Units on a ladder are candidates when normalizing, MinValue is the smallest amount worth
+// writing in that unit (half a glass reads fine, 0.3 kg does not).
+type Unit struct {
+	Symbol    string
+	Dimension Dimension
+	System    System
+	Factor    float64
+	Ladder    bool
+	MinValue  float64
+	Fractions bool
+	Aliases   []string
+}
+
+var UNITS = []Unit{
+	{Symbol: "mg", Dimension: MASS, System: METRIC, Factor: 0.001, Aliases: []string{"miligram", "milligram"}},
+	{Symbol: "g", Dimension: MASS, System: METRIC, Factor: 1, Ladder: true, MinValue: 1, Aliases: []string{"gr", "gram", "grams", "gramm"}},
+	{Symbol: "kg", Dimension: MASS, System: METRIC, Factor: 1000, Ladder: true, MinValue: 1, Aliases: []string{"kilo", "kilogram", "kilograms"}},
+	{Symbol: "ons", Dimension: MASS, System: METRIC, Factor: 100, Fractions: true},
+	{Symbol: "oz", Dimension: MASS, System: IMPERIAL, Factor: 28.349523125, Ladder: true, MinValue: 0, Fractions: true, Aliases: []string{"ounce", "ounces"}},
+	{Symbol: "lb", Dimension: MASS, System: IMPERIAL, Factor: 453.59237, Ladder: true, MinValue: 1, Fractions: true, Aliases: []string{"lbs", "pound", "pounds"}},
+
+	{Symbol: "ml", Dimension: VOLUME, System: METRIC, Factor: 1, Ladder: true, MinValue: 0, Aliases: []string{"cc", "mililiter", "milliliter", "millilitre"}},
+	{Symbol: "l", Dimension: VOLUME, System: METRIC, Factor: 1000, Ladder: true, MinValue: 1, Aliases: []string{"lt", "ltr", "liter", "litre", "liters", "litres"}},
+	{Symbol: "sdt", Dimension: VOLUME, System: KITCHEN, Factor: 5, Ladder: true, MinValue: 0, Fractions: true, Aliases: []string{"sendok teh", "sdt."}},
+	{Symbol: "sdm", Dimension: VOLUME, System: KITCHEN, Factor: 15, Ladder: true, MinValue: 1, Fractions: true, Aliases: []string{"sendok makan", "sdm."}},
+	{Symbol: "gelas", Dimension: VOLUME, System: KITCHEN, Factor: 240, Ladder: true, MinValue: 0.5, Fractions: true, Aliases: []string{"glass", "gls"}},
+	{Symbol: "tsp", Dimension: VOLUME, System: IMPERIAL, Factor: 4.92892159375, Ladder: true, MinValue: 0, Fractions: true, Aliases: []string{"teaspoon", "teaspoons"}},
+	{Symbol: "tbsp", Dimension: VOLUME, System: IMPERIAL, Factor: 14.78676478125, Ladder: true, MinValue: 1, Fractions: true, Aliases: []string{"tablespoon", "tablespoons", "tbs"}},
+	{Symbol: "cup", Dimension: VOLUME, System: IMPERIAL, Factor: 236.5882365, Ladder: true, MinValue: 0.25, Fractions: true, Aliases: []string{"cups", "cangkir"}},
+	{Symbol: "fl oz", Dimension: VOLUME, System: IMPERIAL, Factor: 29.5735295625, Fractions: true, Aliases: []string{"fluid ounce", "fluid ounces"}},
+
+	{Symbol: "butir", Dimension: COUNT, Factor: 1, Fractions: true},
+	{Symbol: "buah", Dimension: COUNT, Factor: 1, Fractions: true},
+	{Symbol: "biji", Dimension: COUNT, Factor: 1, Fractions: true},
+	{Symbol: "siung", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"clove", "cloves"}},
+	{Symbol: "lembar", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"lbr", "sheet", "sheets", "leaf", "leaves"}},
+	{Symbol: "batang", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"btg", "stalk", "stalks", "stick", "sticks"}},
+	{Symbol: "ekor", Dimension: COUNT, Factor: 1, Fractions: true},
+	{Symbol: "potong", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"ptg", "iris"}},
+	{Symbol: "ruas", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"knob", "knobs"}},
+	{Symbol: "ikat", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"bunch", "bunches"}},
+	{Symbol: "bungkus", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"bks", "sachet", "saset", "pack", "packs", "packet", "packets"}},
+	{Symbol: "genggam", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"handful", "handfuls"}},
+	{Symbol: "jumput", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"sejumput", "pinch", "pinches"}},
+	{Symbol: "pcs", Dimension: COUNT, Factor: 1, Fractions: true, Aliases: []string{"pc", "piece", "pieces", "slice", "slices"}},
+}
+
+var unitsByName map[string]Unit
+
+func init() {
+	unitsByName = make(map[string]Unit)
+	for _, unit := range UNITS {
+		unitsByName[unit.Symbol] = unit
+		for _, alias := range unit.Aliases {
+			unitsByName[alias] = unit
+		}
+	}
+}
+
+// Lookup : unit by symbol or alias, case insensitive
+func Lookup(name string) (Unit, bool) {
+	unit, ok := unitsByName[strings.Join(strings.Fields(strings.ToLower(name)), " ")]
+	return unit, ok
+}
+
+// ParseSystem : metric, imperial or kitchen, anything else keeps the units a recipe was written in
+func ParseSystem(name string) (System, bool) {
+	switch System(strings.ToLower(name)) {
+	case METRIC:
+		return METRIC, true
+	case IMPERIAL:
+		return IMPERIAL, true
+	case KITCHEN:
+		return KITCHEN, true
+	}
+	return "", false
+}
+
+// Quantity : Unit is kept as written when it is not a known unit
+type Quantity struct {
+	Value float64
+	Unit  string
+}
+
+func (q Quantity) Scale(factor float64) Quantity {
+	return Quantity{Value: q.Value * factor, Unit: q.Unit}
+}
+
+// Base : amount in grams, millilitres or pieces
+func (q Quantity) Base() (float64, Dimension, bool) {
+	unit, ok := Lookup(q.Unit)
+	if !ok {
+		return 0, "", false
+	}
+	return q.Value * unit.Factor, unit.Dimension, true
+}
+
+// Convert : express q in system, an empty system keeps the system q is written in.
+// The result is normalized to the most readable unit of the system, 1000 g becomes 1 kg.
+// Counts and unknown units are returned unchanged.
+func Convert(q Quantity, system System) Quantity {
+	unit, ok := Lookup(q.Unit)
+	if !ok || unit.Dimension == COUNT {
+		return q
+	}
+	if system == "" {
+		system = unit.System
+	}
+	// there are no kitchen units for mass
+	if system == KITCHEN && unit.Dimension == MASS {
+		system = METRIC
+	}
+
+	ladder := unitLadder(unit.Dimension, system)
+	if len(ladder) == 0 {
+		return q
+	}
+	if system == unit.System && !unit.Ladder {
+		// units such as ons are kept, people wrote them on purpose
+		return q
+	}
+
+	base := q.Value * unit.Factor
+	best := ladder[0]
+	for _, candidate := range ladder {
+		if math.Abs(base)/candidate.Factor >= candidate.MinValue-1e-9 {
+			best = candidate
+		}
+	}
+	return Quantity{Value: base / best.Factor, Unit: best.Symbol}
+}
+
+// unitLadder : units of dimension in system from the smallest to the largest
+func unitLadder(dimension Dimension, system System) []Unit {
+	ladder := []Unit{}
+	for _, unit := range UNITS {
+		if unit.Ladder && unit.Dimension == dimension && unit.System == system {
+			ladder = append(ladder, unit)
+		}
+	}
+	// UNITS is ordered by size within every system
+	return ladder
+}
@@ -0,0 +1,93 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     Quantity
+		system System
+		want   Quantity
+	}{
+		{"grams become kilograms", Quantity{1000, "g"}, "", Quantity{1, "kg"}},
+		{"half a kilo reads in grams", Quantity{0.5, "kg"}, "", Quantity{500, "g"}},
+		{"alias", Quantity{250, "gram"}, "", Quantity{250, "g"}},
+		{"kilograms to pounds", Quantity{1, "kg"}, IMPERIAL, Quantity{2.20462, "lb"}},
+		{"ounces to grams", Quantity{8, "oz"}, METRIC, Quantity{226.796, "g"}},
+		{"little meat in ounces", Quantity{3, "ons"}, IMPERIAL, Quantity{10.5822, "oz"}},
+		{"ons is kept in metric", Quantity{3, "ons"}, METRIC, Quantity{3, "ons"}},
+		{"no kitchen units for mass", Quantity{1, "kg"}, KITCHEN, Quantity{1, "kg"}},
+		{"millilitres become litres", Quantity{1500, "ml"}, "", Quantity{1.5, "l"}},
+		{"cup to millilitres", Quantity{1, "cup"}, METRIC, Quantity{236.588, "ml"}},
+		{"three teaspoons are a tablespoon", Quantity{3, "tsp"}, "", Quantity{1, "tbsp"}},
+		{"small amounts stay teaspoons", Quantity{2, "tsp"}, "", Quantity{2, "tsp"}},
+		{"tablespoons to cups", Quantity{8, "tbsp"}, "", Quantity{0.5, "cup"}},
+		{"sendok makan to millilitres", Quantity{2, "sdm"}, METRIC, Quantity{30, "ml"}},
+		{"millilitres to sendok makan", Quantity{15, "ml"}, KITCHEN, Quantity{1, "sdm"}},
+		{"half a glass", Quantity{120, "ml"}, KITCHEN, Quantity{0.5, "gelas"}},
+		{"sendok teh add up to sendok makan", Quantity{6, "sdt"}, "", Quantity{2, "sdm"}},
+		{"glass to cups", Quantity{1, "gelas"}, IMPERIAL, Quantity{1.01442, "cup"}},
+		{"counts are kept", Quantity{3, "butir"}, METRIC, Quantity{3, "butir"}},
+		{"unknown units are kept", Quantity{1, "secukupnya"}, METRIC, Quantity{1, "secukupnya"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Convert(tt.in, tt.system)
+			if got.Unit != tt.want.Unit || math.Abs(got.Value-tt.want.Value) > 1e-4*math.Max(1, tt.want.Value) {
+				t.Errorf("Convert(%v, %q) = %v, want %v", tt.in, tt.system, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"sdm", "sdm"},
+		{"Sendok  Makan", "sdm"},
+		{"tablespoons", "tbsp"},
+		{"cloves", "siung"},
+		{"fl oz", "fl oz"},
+	}
+
+	for _, tt := range tests {
+		unit, ok := Lookup(tt.name)
+		if !ok || unit.Symbol != tt.want {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", tt.name, unit.Symbol, ok, tt.want)
+		}
+	}
+	if _, ok := Lookup("secukupnya"); ok {
+		t.Error("secukupnya is not a unit")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		in   Quantity
+		want string
+	}{
+		{Quantity{1.5, "sdm"}, "1 1/2 sdm"},
+		{Quantity{0.3333, "gelas"}, "1/3 gelas"},
+		{Quantity{0.125, "sdt"}, "1/8 sdt"},
+		{Quantity{2.20462, "lb"}, "2 1/4 lb"},
+		{Quantity{0.99, "cup"}, "1 cup"},
+		{Quantity{0.05, "sdt"}, "0.05 sdt"},
+		{Quantity{226.796, "g"}, "227 g"},
+		{Quantity{1.25, "kg"}, "1.25 kg"},
+		{Quantity{0.5, "potong"}, "1/2 potong"},
+		{Quantity{2, ""}, "2"},
+		{Quantity{-1.5, "sdm"}, "-1 1/2 sdm"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.in); got != tt.want {
+			t.Errorf("Format(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}